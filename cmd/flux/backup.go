@@ -0,0 +1,336 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	autov1 "github.com/fluxcd/image-automation-controller/api/v1beta1"
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	notificationv1 "github.com/fluxcd/notification-controller/api/v1beta2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the Flux custom resources",
+	Long: `The backup command writes the Flux custom resources of all namespaces to a directory
+or to a tar.gz archive, in the form of 'flux export', to restore them with 'flux restore'
+after an uninstall or on another cluster.`,
+	Example: `  # Back up the Flux custom resources to a directory
+  flux backup --path=./flux-backup
+
+  # Back up the Flux custom resources and the Secrets they reference to an archive
+  flux backup --path=flux-backup.tar.gz --with-secrets`,
+	RunE: backupCmdRun,
+}
+
+type backupFlags struct {
+	path        string
+	withSecrets bool
+}
+
+var backupArgs backupFlags
+
+func init() {
+	backupCmd.Flags().StringVar(&backupArgs.path, "path", "",
+		"path to the directory, or to the archive if it ends with .tar.gz or .tgz, the objects are written to")
+	backupCmd.Flags().BoolVar(&backupArgs.withSecrets, "with-secrets", false,
+		"include the Secrets referenced by the custom resources, the Secrets are written unencrypted")
+
+	rootCmd.AddCommand(backupCmd)
+}
+
+// backupKind is a Flux kind backed up to the file of the same name.
+type backupKind struct {
+	kind string
+	file string
+	list exportableList
+}
+
+// backupKinds returns the backed up kinds, in the order they are resumed
+// on restore.
+func backupKinds() []backupKind {
+	return []backupKind{
+		{sourcev1.GitRepositoryKind, "gitrepositories.yaml", gitRepositoryListAdapter{&sourcev1.GitRepositoryList{}}},
+		{sourcev1.OCIRepositoryKind, "ocirepositories.yaml", ociRepositoryListAdapter{&sourcev1.OCIRepositoryList{}}},
+		{sourcev1.BucketKind, "buckets.yaml", bucketListAdapter{&sourcev1.BucketList{}}},
+		{sourcev1.HelmRepositoryKind, "helmrepositories.yaml", helmRepositoryListAdapter{&sourcev1.HelmRepositoryList{}}},
+		{kustomizev1.KustomizationKind, "kustomizations.yaml", kustomizationListAdapter{&kustomizev1.KustomizationList{}}},
+		{helmv2.HelmReleaseKind, "helmreleases.yaml", helmReleaseListAdapter{&helmv2.HelmReleaseList{}}},
+		{imagev1.ImageRepositoryKind, "imagerepositories.yaml", imageRepositoryListAdapter{&imagev1.ImageRepositoryList{}}},
+		{imagev1.ImagePolicyKind, "imagepolicies.yaml", imagePolicyListAdapter{&imagev1.ImagePolicyList{}}},
+		{autov1.ImageUpdateAutomationKind, "imageupdateautomations.yaml", imageUpdateAutomationListAdapter{&autov1.ImageUpdateAutomationList{}}},
+		{notificationv1.ProviderKind, "providers.yaml", alertProviderListAdapter{&notificationv1.ProviderList{}}},
+		{notificationv1.AlertKind, "alerts.yaml", alertListAdapter{&notificationv1.AlertList{}}},
+		{notificationv1.ReceiverKind, "receivers.yaml", receiverListAdapter{&notificationv1.ReceiverList{}}},
+	}
+}
+
+const backupSecretsFile = "secrets.yaml"
+
+func backupCmdRun(cmd *cobra.Command, args []string) error {
+	if backupArgs.path == "" {
+		return fmt.Errorf("--path is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
+	logger.Actionf("backing up the Flux custom resources in all namespaces")
+	files := map[string][]byte{}
+	secrets := map[types.NamespacedName]bool{}
+	for _, k := range backupKinds() {
+		if err := kubeClient.List(ctx, k.list.asClientList()); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return fmt.Errorf("unable to list %s objects: %w", k.kind, err)
+		}
+		if k.list.len() == 0 {
+			continue
+		}
+
+		var docs []string
+		for i := 0; i < k.list.len(); i++ {
+			data, err := yaml.Marshal(k.list.exportItem(i))
+			if err != nil {
+				return err
+			}
+			docs = append(docs, resourceToString(data))
+			if backupArgs.withSecrets {
+				refs, err := referencedSecrets(data)
+				if err != nil {
+					return err
+				}
+				for _, ref := range refs {
+					secrets[ref] = true
+				}
+			}
+		}
+		files[k.file] = []byte(joinYAMLDocuments(docs))
+		logger.Successf("%d %s objects", len(docs), k.kind)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no Flux custom resources found")
+	}
+
+	if len(secrets) > 0 {
+		keys := make([]types.NamespacedName, 0, len(secrets))
+		for key := range secrets {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		var docs []string
+		for _, key := range keys {
+			var secret corev1.Secret
+			if err := kubeClient.Get(ctx, key, &secret); err != nil {
+				if apierrors.IsNotFound(err) {
+					logger.Warningf("Secret %s not found", key)
+					continue
+				}
+				return fmt.Errorf("failed to retrieve secret %s: %w", key, err)
+			}
+			data, err := yaml.Marshal(exportSecret(&secret))
+			if err != nil {
+				return err
+			}
+			docs = append(docs, resourceToString(data))
+		}
+		if len(docs) > 0 {
+			files[backupSecretsFile] = []byte(joinYAMLDocuments(docs))
+			logger.Warningf("%d Secret objects, the backup contains unencrypted credentials", len(docs))
+		}
+	}
+
+	if err := writeBackup(backupArgs.path, files); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	logger.Successf("backup written to %s", backupArgs.path)
+	return nil
+}
+
+// referencedSecrets returns the Secrets referenced by the exported object,
+// in the secretRef fields of its spec and in the values of a HelmRelease.
+func referencedSecrets(data []byte) ([]types.NamespacedName, error) {
+	var obj struct {
+		Metadata metav1.ObjectMeta      `json:"metadata"`
+		Spec     map[string]interface{} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				if key == "secretRef" || strings.HasSuffix(key, "SecretRef") {
+					if ref, ok := value.(map[string]interface{}); ok {
+						if name, ok := ref["name"].(string); ok && name != "" {
+							names[name] = true
+						}
+					}
+					continue
+				}
+				if key == "valuesFrom" {
+					if refs, ok := value.([]interface{}); ok {
+						for _, r := range refs {
+							ref, ok := r.(map[string]interface{})
+							if !ok || ref["kind"] != "Secret" {
+								continue
+							}
+							if name, ok := ref["name"].(string); ok && name != "" {
+								names[name] = true
+							}
+						}
+					}
+					continue
+				}
+				walk(value)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(obj.Spec)
+
+	refs := make([]types.NamespacedName, 0, len(names))
+	for name := range names {
+		refs = append(refs, types.NamespacedName{Namespace: obj.Metadata.Namespace, Name: name})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+func exportSecret(secret *corev1.Secret) corev1.Secret {
+	return corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Namespace:   secret.Namespace,
+			Labels:      secret.Labels,
+			Annotations: secret.Annotations,
+		},
+		Data: secret.Data,
+		Type: secret.Type,
+	}
+}
+
+func joinYAMLDocuments(docs []string) string {
+	var sb strings.Builder
+	for _, doc := range docs {
+		sb.WriteString("---\n")
+		sb.WriteString(doc)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// isBackupArchive returns true if the backup path is a tar.gz archive.
+func isBackupArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// writeBackup writes the files to the directory or to the archive at path.
+func writeBackup(path string, files map[string][]byte) error {
+	if !isBackupArchive(path) {
+		if err := os.MkdirAll(path, 0o700); err != nil {
+			return err
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(path, name), data, 0o600); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeBackupArchive(f, files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeBackupArchive(w io.Writer, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0o600,
+			Size:     int64(len(files[name])),
+			ModTime:  time.Now(),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
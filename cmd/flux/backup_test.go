@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestReferencedSecrets(t *testing.T) {
+	hr := `apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: apps
+spec:
+  kubeConfig:
+    secretRef:
+      name: kubeconfig
+  valuesFrom:
+  - kind: ConfigMap
+    name: values
+  - kind: Secret
+    name: secret-values
+`
+	refs, err := referencedSecrets([]byte(hr))
+	if err != nil {
+		t.Fatalf("referencedSecrets() error = %v", err)
+	}
+	want := []types.NamespacedName{
+		{Namespace: "apps", Name: "kubeconfig"},
+		{Namespace: "apps", Name: "secret-values"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("referencedSecrets() = %v, want %v", refs, want)
+	}
+
+	repo := `apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: HelmRepository
+metadata:
+  name: podinfo
+  namespace: flux-system
+spec:
+  certSecretRef:
+    name: ca
+  secretRef:
+    name: auth
+`
+	refs, err = referencedSecrets([]byte(repo))
+	if err != nil {
+		t.Fatalf("referencedSecrets() error = %v", err)
+	}
+	want = []types.NamespacedName{
+		{Namespace: "flux-system", Name: "auth"},
+		{Namespace: "flux-system", Name: "ca"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("referencedSecrets() = %v, want %v", refs, want)
+	}
+}
+
+func TestBackupArchive(t *testing.T) {
+	ks := `apiVersion: kustomize.toolkit.fluxcd.io/v1beta2
+kind: Kustomization
+metadata:
+  name: apps
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./apps
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: flux-system
+`
+	files := map[string][]byte{"kustomizations.yaml": []byte(joinYAMLDocuments([]string{ks, ks}))}
+	for _, path := range []string{
+		filepath.Join(t.TempDir(), "backup"),
+		filepath.Join(t.TempDir(), "backup.tar.gz"),
+	} {
+		if err := writeBackup(path, files); err != nil {
+			t.Fatalf("writeBackup(%s) error = %v", path, err)
+		}
+		objects, err := readBackup(path)
+		if err != nil {
+			t.Fatalf("readBackup(%s) error = %v", path, err)
+		}
+		if len(objects) != 2 || objects[0].GetKind() != "Kustomization" || objects[0].GetName() != "apps" {
+			t.Errorf("unexpected objects read from %s: %v", path, objects)
+		}
+	}
+}
@@ -19,12 +19,16 @@ package main
 import (
 	"crypto/elliptic"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/fluxcd/flux2/internal/flags"
 	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/bootstrap"
+	"github.com/fluxcd/flux2/pkg/log"
 	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
 )
@@ -72,7 +76,21 @@ type bootstrapFlags struct {
 	gpgPassphrase  string
 	gpgKeyID       string
 
+	sshSigningKeyPath       string
+	sshSigningKeyPassphrase string
+	sshSigningAgent         bool
+
 	commitMessageAppendix string
+
+	patchFiles []string
+	patchesDir string
+
+	journalFile string
+	restart     bool
+
+	sopsAge bool
+
+	bundle string
 }
 
 const (
@@ -127,8 +145,31 @@ func init() {
 	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.gpgPassphrase, "gpg-passphrase", "", "passphrase for decrypting GPG private key")
 	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.gpgKeyID, "gpg-key-id", "", "key id for selecting a particular key")
 
+	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.sshSigningKeyPath, "ssh-signing-key", "",
+		"path to SSH private key for signing commits, or to the public key when --ssh-signing-agent is set")
+	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.sshSigningKeyPassphrase, "ssh-signing-key-passphrase", "", "passphrase for decrypting the SSH signing key")
+	bootstrapCmd.PersistentFlags().BoolVar(&bootstrapArgs.sshSigningAgent, "ssh-signing-agent", false,
+		"when enabled, commits are signed by the SSH agent with the key matching --ssh-signing-key")
+
 	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.commitMessageAppendix, "commit-message-appendix", "", "string to add to the commit messages, e.g. '[ci skip]'")
 
+	bootstrapCmd.PersistentFlags().StringSliceVar(&bootstrapArgs.patchFiles, "patch-file", nil,
+		"list of Kustomize patch files to apply to the Flux components, accepts comma-separated values")
+	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.patchesDir, "patches-dir", "",
+		"path to a directory with Kustomize patch files to apply to the Flux components")
+
+	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.journalFile, "journal-file", "",
+		"path to a local file to record the completed bootstrap steps in, instead of a ConfigMap in the Flux namespace")
+	bootstrapCmd.PersistentFlags().BoolVar(&bootstrapArgs.restart, "restart", false,
+		"ignore the steps recorded by a previous failed bootstrap run, and run all steps again")
+
+	bootstrapCmd.PersistentFlags().BoolVar(&bootstrapArgs.sopsAge, "sops-age", false,
+		"generate an age key in the '"+bootstrap.SOPSAgeSecretName+"' Secret, enable SOPS decryption in the sync Kustomization, "+
+			"and commit a .sops.yaml encrypting the Secrets in the sync path with the age public key")
+
+	bootstrapCmd.PersistentFlags().StringVar(&bootstrapArgs.bundle, "bundle", "",
+		"path to an install bundle created with 'flux install --export-bundle', to install the components without network access")
+
 	bootstrapCmd.PersistentFlags().MarkHidden("manifests")
 
 	rootCmd.AddCommand(bootstrapCmd)
@@ -145,7 +186,35 @@ func NewBootstrapFlags() bootstrapFlags {
 }
 
 func bootstrapComponents() []string {
-	return append(bootstrapArgs.defaultComponents, bootstrapArgs.extraComponents...)
+	components := make([]string, 0, len(bootstrapArgs.defaultComponents)+len(bootstrapArgs.extraComponents))
+	components = append(components, bootstrapArgs.defaultComponents...)
+	return append(components, bootstrapArgs.extraComponents...)
+}
+
+// bootstrapManifestsBase resolves the version to bootstrap and returns the
+// directory with the manifests of the version, which is extracted from the
+// install bundle if set, or is empty if the manifests must be downloaded.
+func bootstrapManifestsBase() (string, error) {
+	if bootstrapArgs.bundle == "" {
+		ver, err := getVersion(bootstrapArgs.version)
+		if err != nil {
+			return "", err
+		}
+		bootstrapArgs.version = ver
+		return buildEmbeddedManifestBase()
+	}
+
+	tmpBaseDir, err := manifestgen.MkdirTempAbs("", "flux-manifests-")
+	if err != nil {
+		return "", err
+	}
+	ver, err := extractInstallBundle(bootstrapArgs.bundle, bootstrapArgs.version, bootstrapComponents(), tmpBaseDir)
+	if err != nil {
+		os.RemoveAll(tmpBaseDir)
+		return "", err
+	}
+	bootstrapArgs.version = ver
+	return tmpBaseDir, nil
 }
 
 func buildEmbeddedManifestBase() (string, error) {
@@ -177,6 +246,55 @@ func bootstrapValidate() error {
 	return nil
 }
 
+// bootstrapCommitSigner returns the signer for the bootstrap commits
+// configured by the GPG or SSH signing flags, or nil if none are set.
+func bootstrapCommitSigner() (bootstrap.CommitSigner, error) {
+	if bootstrapArgs.gpgKeyRingPath != "" && bootstrapArgs.sshSigningKeyPath != "" {
+		return nil, fmt.Errorf("--gpg-key-ring and --ssh-signing-key are mutually exclusive")
+	}
+	if bootstrapArgs.sshSigningAgent && bootstrapArgs.sshSigningKeyPath == "" {
+		return nil, fmt.Errorf("--ssh-signing-agent requires --ssh-signing-key to be set to the public key")
+	}
+
+	switch {
+	case bootstrapArgs.sshSigningAgent:
+		return bootstrap.LoadSSHAgentSignerFromPath(bootstrapArgs.sshSigningKeyPath)
+	case bootstrapArgs.sshSigningKeyPath != "":
+		return bootstrap.LoadSSHSignerFromPath(bootstrapArgs.sshSigningKeyPath, bootstrapArgs.sshSigningKeyPassphrase)
+	case bootstrapArgs.gpgKeyRingPath != "":
+		entityList, err := bootstrap.LoadEntityListFromPath(bootstrapArgs.gpgKeyRingPath)
+		if err != nil {
+			return nil, err
+		}
+		return bootstrap.NewOpenPGPSigner(entityList, bootstrapArgs.gpgPassphrase, bootstrapArgs.gpgKeyID), nil
+	default:
+		return nil, nil
+	}
+}
+
+// bootstrapRunOptions returns the options for recording the completed
+// bootstrap steps, so that a failed bootstrap can be resumed. The journal
+// file of a fleet cluster is suffixed with the cluster name.
+func bootstrapRunOptions(kubeClient client.Client, clusterName string, logger log.Logger) []bootstrap.RunOption {
+	var store bootstrap.JournalStore = bootstrap.NewConfigMapJournalStore(kubeClient,
+		bootstrap.JournalConfigMapName, *kubeconfigArgs.Namespace)
+	if journalFile := bootstrapArgs.journalFile; journalFile != "" {
+		if clusterName != "" {
+			journalFile = fmt.Sprintf("%s.%s", journalFile, clusterName)
+		}
+		store = bootstrap.NewFileJournalStore(journalFile)
+	}
+
+	opts := []bootstrap.RunOption{
+		bootstrap.WithJournal(store),
+		bootstrap.WithRunLogger(logger),
+	}
+	if bootstrapArgs.restart {
+		opts = append(opts, bootstrap.WithRestart())
+	}
+	return opts
+}
+
 func mapTeamSlice(s []string, defaultPermission string) map[string]string {
 	m := make(map[string]string, len(s))
 	for _, v := range s {
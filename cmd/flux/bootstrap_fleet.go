@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/pkg/log"
+	"github.com/fluxcd/flux2/pkg/printers"
+)
+
+// fleetCluster is a cluster bootstrapped into a path of a fleet repository.
+type fleetCluster struct {
+	// Name of the cluster, defaults to the base name of the path.
+	Name string `json:"name,omitempty"`
+	// Context is the kubeconfig context of the cluster.
+	Context string `json:"context"`
+	// Path relative to the repository root the cluster sync is scoped to.
+	Path string `json:"path"`
+}
+
+// fleetConfig is the format of the file passed to --fleet-config.
+type fleetConfig struct {
+	Clusters []fleetCluster `json:"clusters"`
+}
+
+// loadFleetClusters returns the clusters from the fleet config file and
+// the '<kube-context>=<path>' values, or nil if neither is set.
+func loadFleetClusters(configPath string, values []string) ([]fleetCluster, error) {
+	var clusters []fleetCluster
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read fleet config: %w", err)
+		}
+		var cfg fleetConfig
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse fleet config: %w", err)
+		}
+		clusters = append(clusters, cfg.Clusters...)
+	}
+	for _, v := range values {
+		i := strings.LastIndex(v, "=")
+		if i < 1 || i == len(v)-1 {
+			return nil, fmt.Errorf("invalid fleet cluster %q, expected format '<kube-context>=<path>'", v)
+		}
+		clusters = append(clusters, fleetCluster{Context: v[:i], Path: v[i+1:]})
+	}
+
+	contexts := map[string]bool{}
+	paths := map[string]bool{}
+	names := map[string]bool{}
+	for i := range clusters {
+		c := &clusters[i]
+		if c.Context == "" || c.Path == "" {
+			return nil, fmt.Errorf("fleet cluster %d must have a context and a path", i+1)
+		}
+		var p flags.SafeRelativePath
+		if err := p.Set(c.Path); err != nil {
+			return nil, fmt.Errorf("invalid path of fleet cluster %q: %w", c.Context, err)
+		}
+		c.Path = p.String()
+		if c.Name == "" {
+			c.Name = path.Base(p.ToSlash())
+		}
+		if contexts[c.Context] {
+			return nil, fmt.Errorf("duplicate fleet cluster context %q", c.Context)
+		}
+		if paths[c.Path] {
+			return nil, fmt.Errorf("duplicate fleet cluster path %q", c.Path)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate fleet cluster name %q", c.Name)
+		}
+		contexts[c.Context], paths[c.Path], names[c.Name] = true, true, true
+	}
+	return clusters, nil
+}
+
+// fleetResult is the outcome of the bootstrap of a fleet cluster.
+type fleetResult struct {
+	cluster  fleetCluster
+	err      error
+	duration time.Duration
+}
+
+// bootstrapFleet runs the bootstrap function for each cluster, with at most
+// parallelism clusters at a time, and prints a combined report at the end.
+// The Git operations of the clusters are serialized by the lock passed to
+// the bootstrap function, as the clusters share one Git clone.
+func bootstrapFleet(clusters []fleetCluster, parallelism int,
+	fn func(cluster fleetCluster, logger log.Logger, gitLock sync.Locker) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var gitLock sync.Mutex
+	results := make([]fleetResult, len(clusters))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cluster fleetCluster) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			clusterLogger := prefixLogger{logger: logger, prefix: fmt.Sprintf("[%s]", cluster.Name)}
+			clusterLogger.Actionf("bootstrapping cluster %q into %q", cluster.Context, cluster.Path)
+			start := time.Now()
+			err := fn(cluster, clusterLogger, &gitLock)
+			if err != nil {
+				clusterLogger.Failuref("bootstrap failed: %s", err)
+			}
+			results[i] = fleetResult{cluster: cluster, err: err, duration: time.Since(start)}
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	var failed int
+	var rows [][]string
+	for _, r := range results {
+		status, message := "Ready", "bootstrap finished"
+		if r.err != nil {
+			failed++
+			status, message = "Failed", r.err.Error()
+		}
+		rows = append(rows, []string{r.cluster.Name, r.cluster.Context, r.cluster.Path, status,
+			r.duration.Round(time.Second).String(), message})
+	}
+	if err := printers.TablePrinter([]string{"cluster", "context", "path", "status", "duration", "message"}).
+		Print(rootCmd.OutOrStdout(), rows); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("bootstrap failed for %d of %d cluster(s)", failed, len(clusters))
+	}
+	logger.Successf("bootstrap finished for %d cluster(s)", len(clusters))
+	return nil
+}
+
+// kubeconfigArgsForContext returns the kubeconfig flags for the given
+// context, or the global kubeconfig flags if the context is empty.
+func kubeconfigArgsForContext(kubeContext string) *genericclioptions.ConfigFlags {
+	if kubeContext == "" {
+		return kubeconfigArgs
+	}
+	cfg := genericclioptions.NewConfigFlags(false)
+	cfg.KubeConfig = kubeconfigArgs.KubeConfig
+	cfg.Namespace = kubeconfigArgs.Namespace
+	cfg.Impersonate = kubeconfigArgs.Impersonate
+	cfg.ImpersonateGroup = kubeconfigArgs.ImpersonateGroup
+	cfg.Context = &kubeContext
+	return cfg
+}
+
+// prefixLogger prefixes the messages of the wrapped logger, to tell apart
+// the output of the fleet clusters.
+type prefixLogger struct {
+	logger log.Logger
+	prefix string
+}
+
+func (l prefixLogger) Actionf(format string, a ...interface{}) {
+	l.logger.Actionf("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
+
+func (l prefixLogger) Generatef(format string, a ...interface{}) {
+	l.logger.Generatef("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
+
+func (l prefixLogger) Waitingf(format string, a ...interface{}) {
+	l.logger.Waitingf("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
+
+func (l prefixLogger) Successf(format string, a ...interface{}) {
+	l.logger.Successf("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
+
+func (l prefixLogger) Warningf(format string, a ...interface{}) {
+	l.logger.Warningf("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
+
+func (l prefixLogger) Failuref(format string, a ...interface{}) {
+	l.logger.Failuref("%s %s", l.prefix, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fluxcd/flux2/pkg/log"
+)
+
+func TestLoadFleetClusters(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "fleet.yaml")
+	if err := os.WriteFile(config, []byte(`clusters:
+- name: stg
+  context: kind-staging
+  path: clusters/staging
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		values  []string
+		want    []fleetCluster
+		wantErr string
+	}{
+		{
+			name:   "config file and flag values",
+			config: config,
+			values: []string{"arn:aws:eks:eu-west-1:123:cluster/prod=clusters/production"},
+			want: []fleetCluster{
+				{Name: "stg", Context: "kind-staging", Path: "./clusters/staging"},
+				{Name: "production", Context: "arn:aws:eks:eu-west-1:123:cluster/prod", Path: "./clusters/production"},
+			},
+		},
+		{
+			name:    "missing path",
+			values:  []string{"kind-dev="},
+			wantErr: "expected format",
+		},
+		{
+			name:    "duplicate path",
+			values:  []string{"kind-dev=clusters/dev", "kind-dev2=./clusters/dev"},
+			wantErr: "duplicate fleet cluster path",
+		},
+		{
+			name:   "path outside repository is flattened",
+			values: []string{"kind-dev=../dev"},
+			want:   []fleetCluster{{Name: "dev", Context: "kind-dev", Path: "./dev"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadFleetClusters(tt.config, tt.values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadFleetClusters() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clusters %v != %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBootstrapFleet(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+
+	clusters := []fleetCluster{
+		{Name: "staging", Context: "kind-staging", Path: "./clusters/staging"},
+		{Name: "production", Context: "kind-production", Path: "./clusters/production"},
+	}
+
+	var mu sync.Mutex
+	var bootstrapped []string
+	err := bootstrapFleet(clusters, 2, func(cluster fleetCluster, _ log.Logger, gitLock sync.Locker) error {
+		gitLock.Lock()
+		defer gitLock.Unlock()
+		mu.Lock()
+		bootstrapped = append(bootstrapped, cluster.Name)
+		mu.Unlock()
+		if cluster.Name == "production" {
+			return errors.New("health check timeout")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 cluster(s)") {
+		t.Errorf("expected error for failed cluster, got %v", err)
+	}
+	if len(bootstrapped) != 2 {
+		t.Errorf("expected all clusters to be bootstrapped, got %v", bootstrapped)
+	}
+
+	report := out.String()
+	for _, want := range []string{"staging", "Ready", "production", "Failed", "health check timeout"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected report to contain %q:\n%s", want, report)
+		}
+	}
+}
@@ -22,21 +22,26 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
+	kustypes "sigs.k8s.io/kustomize/api/types"
 
 	"github.com/fluxcd/flux2/internal/flags"
 	"github.com/fluxcd/flux2/internal/utils"
 	"github.com/fluxcd/flux2/pkg/bootstrap"
+	"github.com/fluxcd/flux2/pkg/log"
 	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sync"
 	"github.com/fluxcd/pkg/git"
 	"github.com/fluxcd/pkg/git/gogit"
+	"github.com/fluxcd/pkg/git/repository"
 )
 
 var bootstrapGitCmd = &cobra.Command{
@@ -66,6 +71,13 @@ command will perform an upgrade if needed.`,
 
   # Run bootstrap for a Git repository on Azure Devops
   flux bootstrap git --url=ssh://git@ssh.dev.azure.com/v3/<org>/<project>/<repository> --ssh-key-algorithm=rsa --ssh-rsa-bits=4096 --path=clusters/my-cluster
+
+  # Run bootstrap for multiple clusters into one Git repository, two clusters at a time
+  flux bootstrap git --url=ssh://git@example.com/fleet.git --silent \
+    --fleet=staging=clusters/staging,production=clusters/production --fleet-parallelism=2
+
+  # Run bootstrap for the clusters listed in a fleet config file
+  flux bootstrap git --url=ssh://git@example.com/fleet.git --fleet-config=./fleet.yaml
 `,
 	RunE: bootstrapGitCmdRun,
 }
@@ -78,6 +90,9 @@ type gitFlags struct {
 	password            string
 	silent              bool
 	insecureHttpAllowed bool
+	fleet               []string
+	fleetConfig         string
+	fleetParallelism    int
 }
 
 const (
@@ -94,6 +109,10 @@ func init() {
 	bootstrapGitCmd.Flags().StringVarP(&gitArgs.password, "password", "p", "", "basic authentication password")
 	bootstrapGitCmd.Flags().BoolVarP(&gitArgs.silent, "silent", "s", false, "assumes the deploy key is already setup, skips confirmation")
 	bootstrapGitCmd.Flags().BoolVar(&gitArgs.insecureHttpAllowed, "allow-insecure-http", false, "allows insecure HTTP connections")
+	bootstrapGitCmd.Flags().StringSliceVar(&gitArgs.fleet, "fleet", nil,
+		"list of clusters to bootstrap into the repository in the format '<kube-context>=<path>', accepts comma-separated values")
+	bootstrapGitCmd.Flags().StringVar(&gitArgs.fleetConfig, "fleet-config", "", "path to a file with the list of clusters to bootstrap into the repository")
+	bootstrapGitCmd.Flags().IntVar(&gitArgs.fleetParallelism, "fleet-parallelism", 1, "number of fleet clusters to bootstrap in parallel")
 
 	bootstrapCmd.AddCommand(bootstrapGitCmd)
 }
@@ -138,21 +157,20 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
-	defer cancel()
-
-	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	clusters, err := loadFleetClusters(gitArgs.fleetConfig, gitArgs.fleet)
 	if err != nil {
 		return err
 	}
+	if len(clusters) > 0 && gitArgs.path != "" {
+		return fmt.Errorf("--path cannot be combined with --fleet or --fleet-config")
+	}
+	if len(clusters) > 1 && gitArgs.fleetParallelism > 1 &&
+		!gitArgs.silent && !bootstrapArgs.tokenAuth && bootstrapArgs.privateKeyFile == "" {
+		return fmt.Errorf("parallel fleet bootstrap requires one of --silent, --token-auth or --private-key-file")
+	}
 
 	// Manifest base
-	if ver, err := getVersion(bootstrapArgs.version); err != nil {
-		return err
-	} else {
-		bootstrapArgs.version = ver
-	}
-	manifestsBase, err := buildEmbeddedManifestBase()
+	manifestsBase, err := bootstrapManifestsBase()
 	if err != nil {
 		return err
 	}
@@ -187,12 +205,69 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create a Git client: %w", err)
 	}
 
+	// The options shared by the fleet clusters are built once, before the
+	// clusters are bootstrapped concurrently
+	componentPatches, err := kustomization.LoadPatches(append(append([]string{}, bootstrapArgs.patchFiles...), bootstrapArgs.patchesDir)...)
+	if err != nil {
+		return err
+	}
+	shared := bootstrapGitShared{
+		gitClient:        gitClient,
+		repositoryURL:    *repositoryURL,
+		caBundle:         caBundle,
+		manifestsBase:    manifestsBase,
+		components:       bootstrapComponents(),
+		componentPatches: componentPatches,
+	}
+
+	if len(clusters) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+		defer cancel()
+
+		return bootstrapGitCluster(ctx, shared, fleetCluster{
+			Path: gitArgs.path.String(),
+		}, logger, nil)
+	}
+	return bootstrapFleet(clusters, gitArgs.fleetParallelism, func(cluster fleetCluster, logger log.Logger, gitLock gosync.Locker) error {
+		// Each cluster gets the full --timeout
+		ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+		defer cancel()
+
+		return bootstrapGitCluster(ctx, shared, cluster, logger, gitLock)
+	})
+}
+
+// bootstrapGitShared is the configuration shared by the clusters of a
+// fleet, which must not be modified by the cluster bootstraps.
+type bootstrapGitShared struct {
+	gitClient        repository.Client
+	repositoryURL    url.URL
+	caBundle         []byte
+	manifestsBase    string
+	components       []string
+	componentPatches []kustypes.Patch
+}
+
+// bootstrapGitCluster bootstraps the cluster of the given kubeconfig context
+// using the (shared) Git client, with the cluster sync scoped to the path.
+func bootstrapGitCluster(ctx context.Context, shared bootstrapGitShared, cluster fleetCluster,
+	logger log.Logger, gitLock gosync.Locker) error {
+	repositoryURL := shared.repositoryURL
+	caBundle := shared.caBundle
+	path := flags.SafeRelativePath(cluster.Path)
+	rcg := kubeconfigArgsForContext(cluster.Context)
+
+	kubeClient, err := utils.KubeClient(rcg, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
 	// Install manifest config
 	installOptions := install.Options{
 		BaseURL:                rootArgs.defaults.BaseURL,
 		Version:                bootstrapArgs.version,
 		Namespace:              *kubeconfigArgs.Namespace,
-		Components:             bootstrapComponents(),
+		Components:             append([]string{}, shared.components...),
 		Registry:               bootstrapArgs.registry,
 		ImagePullSecret:        bootstrapArgs.imagePullSecret,
 		WatchAllNamespaces:     bootstrapArgs.watchAllNamespaces,
@@ -201,7 +276,7 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 		NotificationController: rootArgs.defaults.NotificationController,
 		ManifestFile:           rootArgs.defaults.ManifestFile,
 		Timeout:                rootArgs.timeout,
-		TargetPath:             gitArgs.path.ToSlash(),
+		TargetPath:             path.ToSlash(),
 		ClusterDomain:          bootstrapArgs.clusterDomain,
 		TolerationKeys:         bootstrapArgs.tolerationKeys,
 	}
@@ -213,7 +288,7 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 	secretOpts := sourcesecret.Options{
 		Name:         bootstrapArgs.secretName,
 		Namespace:    *kubeconfigArgs.Namespace,
-		TargetPath:   gitArgs.path.String(),
+		TargetPath:   path.String(),
 		ManifestFile: sourcesecret.MakeDefaultOptions().ManifestFile,
 	}
 	if bootstrapArgs.tokenAuth {
@@ -269,12 +344,12 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 		URL:               repositoryURL.String(),
 		Branch:            bootstrapArgs.branch,
 		Secret:            bootstrapArgs.secretName,
-		TargetPath:        gitArgs.path.ToSlash(),
+		TargetPath:        path.ToSlash(),
 		ManifestFile:      sync.MakeDefaultOptions().ManifestFile,
 		RecurseSubmodules: bootstrapArgs.recurseSubmodules,
 	}
 
-	entityList, err := bootstrap.LoadEntityListFromPath(bootstrapArgs.gpgKeyRingPath)
+	commitSigner, err := bootstrapCommitSigner()
 	if err != nil {
 		return err
 	}
@@ -285,20 +360,28 @@ func bootstrapGitCmdRun(cmd *cobra.Command, args []string) error {
 		bootstrap.WithBranch(bootstrapArgs.branch),
 		bootstrap.WithSignature(bootstrapArgs.authorName, bootstrapArgs.authorEmail),
 		bootstrap.WithCommitMessageAppendix(bootstrapArgs.commitMessageAppendix),
-		bootstrap.WithKubeconfig(kubeconfigArgs, kubeclientOptions),
+		bootstrap.WithKubeconfig(rcg, kubeclientOptions),
 		bootstrap.WithPostGenerateSecretFunc(promptPublicKey),
 		bootstrap.WithLogger(logger),
-		bootstrap.WithGitCommitSigning(entityList, bootstrapArgs.gpgPassphrase, bootstrapArgs.gpgKeyID),
+		bootstrap.WithGitLock(gitLock),
+		bootstrap.WithCommitSigner(commitSigner),
+		bootstrap.WithComponentPatches(shared.componentPatches),
+	}
+	if bootstrapArgs.sopsAge {
+		syncOpts.DecryptionProvider = "sops"
+		syncOpts.DecryptionSecret = bootstrap.SOPSAgeSecretName
+		bootstrapOpts = append(bootstrapOpts, bootstrap.WithSOPSAge())
 	}
 
 	// Setup bootstrapper with constructed configs
-	b, err := bootstrap.NewPlainGitProvider(gitClient, kubeClient, bootstrapOpts...)
+	b, err := bootstrap.NewPlainGitProvider(shared.gitClient, kubeClient, bootstrapOpts...)
 	if err != nil {
 		return err
 	}
 
 	// Run
-	return bootstrap.Run(ctx, b, manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout)
+	return bootstrap.Run(ctx, b, shared.manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout,
+		bootstrapRunOptions(kubeClient, cluster.Name, logger)...)
 }
 
 // getAuthOpts retruns a AuthOptions based on the scheme
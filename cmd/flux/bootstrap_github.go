@@ -32,6 +32,7 @@ import (
 	"github.com/fluxcd/flux2/pkg/bootstrap/provider"
 	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sync"
 )
@@ -129,12 +130,7 @@ func bootstrapGitHubCmdRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// Manifest base
-	if ver, err := getVersion(bootstrapArgs.version); err != nil {
-		return err
-	} else {
-		bootstrapArgs.version = ver
-	}
-	manifestsBase, err := buildEmbeddedManifestBase()
+	manifestsBase, err := bootstrapManifestsBase()
 	if err != nil {
 		return err
 	}
@@ -233,7 +229,12 @@ func bootstrapGitHubCmdRun(cmd *cobra.Command, args []string) error {
 		RecurseSubmodules: bootstrapArgs.recurseSubmodules,
 	}
 
-	entityList, err := bootstrap.LoadEntityListFromPath(bootstrapArgs.gpgKeyRingPath)
+	commitSigner, err := bootstrapCommitSigner()
+	if err != nil {
+		return err
+	}
+
+	componentPatches, err := kustomization.LoadPatches(append(bootstrapArgs.patchFiles, bootstrapArgs.patchesDir)...)
 	if err != nil {
 		return err
 	}
@@ -249,7 +250,13 @@ func bootstrapGitHubCmdRun(cmd *cobra.Command, args []string) error {
 		bootstrap.WithReadWriteKeyPermissions(githubArgs.readWriteKey),
 		bootstrap.WithKubeconfig(kubeconfigArgs, kubeclientOptions),
 		bootstrap.WithLogger(logger),
-		bootstrap.WithGitCommitSigning(entityList, bootstrapArgs.gpgPassphrase, bootstrapArgs.gpgKeyID),
+		bootstrap.WithCommitSigner(commitSigner),
+		bootstrap.WithComponentPatches(componentPatches),
+	}
+	if bootstrapArgs.sopsAge {
+		syncOpts.DecryptionProvider = "sops"
+		syncOpts.DecryptionSecret = bootstrap.SOPSAgeSecretName
+		bootstrapOpts = append(bootstrapOpts, bootstrap.WithSOPSAge())
 	}
 	if bootstrapArgs.sshHostname != "" {
 		bootstrapOpts = append(bootstrapOpts, bootstrap.WithSSHHostname(bootstrapArgs.sshHostname))
@@ -271,5 +278,6 @@ func bootstrapGitHubCmdRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// Run
-	return bootstrap.Run(ctx, b, manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout)
+	return bootstrap.Run(ctx, b, manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout,
+		bootstrapRunOptions(kubeClient, "", logger)...)
 }
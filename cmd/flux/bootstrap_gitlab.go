@@ -34,6 +34,7 @@ import (
 	"github.com/fluxcd/flux2/pkg/bootstrap/provider"
 	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sync"
 )
@@ -146,12 +147,7 @@ func bootstrapGitLabCmdRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// Manifest base
-	if ver, err := getVersion(bootstrapArgs.version); err != nil {
-		return err
-	} else {
-		bootstrapArgs.version = ver
-	}
-	manifestsBase, err := buildEmbeddedManifestBase()
+	manifestsBase, err := bootstrapManifestsBase()
 	if err != nil {
 		return err
 	}
@@ -266,7 +262,12 @@ func bootstrapGitLabCmdRun(cmd *cobra.Command, args []string) error {
 		RecurseSubmodules: bootstrapArgs.recurseSubmodules,
 	}
 
-	entityList, err := bootstrap.LoadEntityListFromPath(bootstrapArgs.gpgKeyRingPath)
+	commitSigner, err := bootstrapCommitSigner()
+	if err != nil {
+		return err
+	}
+
+	componentPatches, err := kustomization.LoadPatches(append(bootstrapArgs.patchFiles, bootstrapArgs.patchesDir)...)
 	if err != nil {
 		return err
 	}
@@ -282,7 +283,13 @@ func bootstrapGitLabCmdRun(cmd *cobra.Command, args []string) error {
 		bootstrap.WithReadWriteKeyPermissions(gitlabArgs.readWriteKey),
 		bootstrap.WithKubeconfig(kubeconfigArgs, kubeclientOptions),
 		bootstrap.WithLogger(logger),
-		bootstrap.WithGitCommitSigning(entityList, bootstrapArgs.gpgPassphrase, bootstrapArgs.gpgKeyID),
+		bootstrap.WithCommitSigner(commitSigner),
+		bootstrap.WithComponentPatches(componentPatches),
+	}
+	if bootstrapArgs.sopsAge {
+		syncOpts.DecryptionProvider = "sops"
+		syncOpts.DecryptionSecret = bootstrap.SOPSAgeSecretName
+		bootstrapOpts = append(bootstrapOpts, bootstrap.WithSOPSAge())
 	}
 	if bootstrapArgs.sshHostname != "" {
 		bootstrapOpts = append(bootstrapOpts, bootstrap.WithSSHHostname(bootstrapArgs.sshHostname))
@@ -307,5 +314,6 @@ func bootstrapGitLabCmdRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// Run
-	return bootstrap.Run(ctx, b, manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout)
+	return bootstrap.Run(ctx, b, manifestsBase, installOptions, secretOpts, syncOpts, rootArgs.pollInterval, rootArgs.timeout,
+		bootstrapRunOptions(kubeClient, "", logger)...)
 }
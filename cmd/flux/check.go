@@ -18,22 +18,15 @@ package main
 
 import (
 	"context"
-	"os"
+	"encoding/json"
+	"fmt"
+	"io"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/spf13/cobra"
-	v1 "k8s.io/api/apps/v1"
-	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
-	"k8s.io/client-go/kubernetes"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-
-	"github.com/fluxcd/pkg/version"
 
 	"github.com/fluxcd/flux2/internal/utils"
-	"github.com/fluxcd/flux2/pkg/manifestgen"
-	"github.com/fluxcd/flux2/pkg/manifestgen/install"
-	"github.com/fluxcd/flux2/pkg/status"
+	"github.com/fluxcd/flux2/pkg/check"
 )
 
 var checkCmd = &cobra.Command{
@@ -45,15 +38,23 @@ the local environment is configured correctly and if the installed components ar
   flux check --pre
 
   # Run installation checks
-  flux check`,
+  flux check
+
+  # Run installation checks and diagnose common misconfigurations
+  flux check --deep
+
+  # Run installation checks and print the results as JSON
+  flux check -o json`,
 	RunE: runCheckCmd,
 }
 
 type checkFlags struct {
 	pre             bool
+	deep            bool
 	components      []string
 	extraComponents []string
 	pollInterval    time.Duration
+	output          string
 }
 
 var kubernetesConstraints = []string{
@@ -65,191 +66,136 @@ var checkArgs checkFlags
 func init() {
 	checkCmd.Flags().BoolVarP(&checkArgs.pre, "pre", "", false,
 		"only run pre-installation checks")
+	checkCmd.Flags().BoolVar(&checkArgs.deep, "deep", false,
+		"run diagnostic checks for the tenants RBAC, network policies, webhook receivers, CRD stored versions and clock skew")
 	checkCmd.Flags().StringSliceVar(&checkArgs.components, "components", rootArgs.defaults.Components,
 		"list of components, accepts comma-separated values")
 	checkCmd.Flags().StringSliceVar(&checkArgs.extraComponents, "components-extra", nil,
 		"list of components in addition to those supplied or defaulted, accepts comma-separated values")
 	checkCmd.Flags().DurationVar(&checkArgs.pollInterval, "poll-interval", 5*time.Second,
 		"how often the health checker should poll the cluster for the latest state of the resources.")
+	checkCmd.Flags().StringVarP(&checkArgs.output, "output", "o", "",
+		"the format of the results, can be 'json' for a machine-readable report on stdout")
 	rootCmd.AddCommand(checkCmd)
 }
 
 func runCheckCmd(cmd *cobra.Command, args []string) error {
-	logger.Actionf("checking prerequisites")
-	checkFailed := false
-
-	fluxCheck()
-
-	if !kubernetesCheck(kubernetesConstraints) {
-		checkFailed = true
-	}
-
-	if checkArgs.pre {
-		if checkFailed {
-			os.Exit(1)
-		}
-		logger.Successf("prerequisites checks passed")
-		return nil
+	switch checkArgs.output {
+	case "", "json":
+	default:
+		return fmt.Errorf("--output must be json, not %s", checkArgs.output)
 	}
 
-	logger.Actionf("checking controllers")
-	if !componentsCheck() {
-		checkFailed = true
-	}
-
-	logger.Actionf("checking crds")
-	if !crdsCheck() {
-		checkFailed = true
-	}
-
-	if checkFailed {
-		logger.Failuref("check failed")
-		os.Exit(1)
-	}
-
-	logger.Successf("all checks passed")
-	return nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
 
-func fluxCheck() {
-	curSv, err := version.ParseVersion(VERSION)
-	if err != nil {
-		return
-	}
-	// Exclude development builds.
-	if curSv.Prerelease() != "" {
-		return
-	}
-	latest, err := install.GetLatestVersion()
+	kubeConfig, err := utils.KubeConfig(kubeconfigArgs, kubeclientOptions)
 	if err != nil {
-		return
+		return fmt.Errorf("Kubernetes client initialization failed: %s", err.Error())
 	}
-	latestSv, err := version.ParseVersion(latest)
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
 	if err != nil {
-		return
+		return fmt.Errorf("Kubernetes client initialization failed: %s", err.Error())
 	}
-	if latestSv.GreaterThan(curSv) {
-		logger.Failuref("flux %s <%s (new version is available, please upgrade)", curSv, latestSv)
-	}
-}
 
-func kubernetesCheck(constraints []string) bool {
-	cfg, err := utils.KubeConfig(kubeconfigArgs, kubeclientOptions)
-	if err != nil {
-		logger.Failuref("Kubernetes client initialization failed: %s", err.Error())
-		return false
-	}
+	opts := check.MakeDefaultOptions()
+	opts.Namespace = *kubeconfigArgs.Namespace
+	opts.KubernetesConstraints = kubernetesConstraints
+	opts.PollInterval = checkArgs.pollInterval
+	opts.Timeout = rootArgs.timeout
+	checker := check.NewChecker(kubeConfig, kubeClient, opts)
 
-	clientSet, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		logger.Failuref("Kubernetes client initialization failed: %s", err.Error())
-		return false
+	var results []check.Result
+	report := func(action string, checkResults []check.Result) {
+		results = append(results, checkResults...)
+		if checkArgs.output != "" {
+			return
+		}
+		if action != "" {
+			logger.Actionf(action)
+		}
+		for _, r := range checkResults {
+			printCheckResult(r)
+		}
 	}
 
-	kv, err := clientSet.Discovery().ServerVersion()
-	if err != nil {
-		logger.Failuref("Kubernetes API call failed: %s", err.Error())
-		return false
+	var preResults []check.Result
+	if r, ok := check.FluxVersion(VERSION); ok && r.Status != check.StatusPass {
+		preResults = append(preResults, r)
 	}
+	preResults = append(preResults, checker.Kubernetes(ctx)...)
+	report("checking prerequisites", preResults)
 
-	v, err := version.ParseVersion(kv.String())
-	if err != nil {
-		logger.Failuref("Kubernetes version can't be determined")
-		return false
-	}
-
-	var valid bool
-	var vrange string
-	for _, constraint := range constraints {
-		c, _ := semver.NewConstraint(constraint)
-		if c.Check(v) {
-			valid = true
-			vrange = constraint
-			break
+	if checkArgs.pre {
+		if checkArgs.output == "json" {
+			return printCheckResults(cmd.OutOrStdout(), results)
 		}
+		if check.Failed(results) {
+			return fmt.Errorf("prerequisites checks failed")
+		}
+		logger.Successf("prerequisites checks passed")
+		return nil
 	}
 
-	if !valid {
-		logger.Failuref("Kubernetes version %s does not match %s", v.Original(), constraints[0])
-		return false
+	report("checking controllers", checker.Components(ctx))
+	report("checking crds", checker.CRDs(ctx))
+	if checkArgs.deep {
+		report("running diagnostic checks", checker.Diagnostics(ctx))
 	}
 
-	logger.Successf("Kubernetes %s %s", v.String(), vrange)
-	return true
-}
-
-func componentsCheck() bool {
-	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
-	defer cancel()
-
-	kubeConfig, err := utils.KubeConfig(kubeconfigArgs, kubeclientOptions)
-	if err != nil {
-		return false
+	if checkArgs.output == "json" {
+		return printCheckResults(cmd.OutOrStdout(), results)
 	}
-
-	statusChecker, err := status.NewStatusChecker(kubeConfig, checkArgs.pollInterval, rootArgs.timeout, logger)
-	if err != nil {
-		return false
+	if check.Failed(results) {
+		return fmt.Errorf("check failed")
 	}
+	logger.Successf("all checks passed")
+	return nil
+}
 
-	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
-	if err != nil {
-		return false
-	}
-
-	ok := true
-	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
-	var list v1.DeploymentList
-	ns := *kubeconfigArgs.Namespace
-	if err := kubeClient.List(ctx, &list, client.InNamespace(ns), selector); err == nil {
-		if len(list.Items) == 0 {
-			logger.Failuref("no controllers found in the '%s' namespace with the label selector '%s=%s'",
-				ns, manifestgen.PartOfLabelKey, manifestgen.PartOfLabelValue)
-			return false
-		}
-
-		for _, d := range list.Items {
-			if ref, err := buildComponentObjectRefs(d.Name); err == nil {
-				if err := statusChecker.Assess(ref...); err != nil {
-					ok = false
-				}
-			}
-			for _, c := range d.Spec.Template.Spec.Containers {
-				logger.Actionf(c.Image)
-			}
-		}
+// printCheckResult logs the result of a check, the results of the diagnostic
+// checks are prefixed with the name of the check.
+func printCheckResult(r check.Result) {
+	msg := r.Message
+	switch r.Name {
+	case "flux", "kubernetes", "components", "crds", "drift", "modifications":
+	default:
+		msg = fmt.Sprintf("%s: %s", r.Name, msg)
+	}
+	if r.Hint != "" {
+		msg = fmt.Sprintf("%s (hint: %s)", msg, r.Hint)
+	}
+	switch r.Status {
+	case check.StatusPass:
+		logger.Successf("%s", msg)
+	case check.StatusWarn:
+		logger.Warningf("%s", msg)
+	default:
+		logger.Failuref("%s", msg)
+	}
+	for _, image := range r.Images {
+		logger.Actionf(image)
 	}
-	return ok
 }
 
-func crdsCheck() bool {
-	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
-	defer cancel()
-
-	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+// printCheckResults writes the results as JSON, it returns an error if any
+// of the checks failed.
+func printCheckResults(w io.Writer, results []check.Result) error {
+	if results == nil {
+		results = []check.Result{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Checks []check.Result `json:"checks"`
+		Passed bool           `json:"passed"`
+	}{results, !check.Failed(results)}, "", "  ")
 	if err != nil {
-		return false
+		return err
 	}
-
-	ok := true
-	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
-	var list apiextensionsv1.CustomResourceDefinitionList
-	if err := kubeClient.List(ctx, &list, client.InNamespace(*kubeconfigArgs.Namespace), selector); err == nil {
-		if len(list.Items) == 0 {
-			logger.Failuref("no crds found with the label selector '%s=%s'",
-				manifestgen.PartOfLabelKey, manifestgen.PartOfLabelValue)
-			return false
-		}
-
-		for _, crd := range list.Items {
-			versions := crd.Status.StoredVersions
-			if len(versions) > 0 {
-				logger.Successf(crd.Name + "/" + versions[len(versions)-1])
-			} else {
-				ok = false
-				logger.Failuref("no stored versions for %s", crd.Name)
-			}
-		}
+	if _, err := fmt.Fprintln(w, string(data)); err != nil {
+		return err
 	}
-	return ok
+	if check.Failed(results) {
+		return fmt.Errorf("check failed")
+	}
+	return nil
 }
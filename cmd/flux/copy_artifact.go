@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	oci "github.com/fluxcd/pkg/oci/client"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/artifact"
+	"github.com/fluxcd/flux2/internal/flags"
+)
+
+var copyArtifactCmd = &cobra.Command{
+	Use:   "artifact",
+	Short: "Copy artifact",
+	Long: `The copy artifact command copies an artifact with its cosign signatures, attestations and SBOM from a source to a destination.
+The source and the destination are either an OCI repository URL prefixed with 'oci://' or the path of a local OCI image layout directory.
+The manifests are copied unchanged, the digest, the annotations and the signatures of the artifact are preserved.
+If the destination URL has no tag, the tag of the source is used. When the source is a layout containing several artifacts, the artifact is selected by the tag of the destination URL.
+The command can read the credentials from '~/.docker/config.json' but they can also be passed with --src-creds and --dst-creds. It can also login to a supported provider with the --src-provider and --dst-provider flags.`,
+	Example: `  # Promote an artifact from the staging to the production registry
+  flux copy artifact oci://ghcr.io/org/staging/app:v1.0.0 oci://registry.example.com/production/app \
+	--dst-creds=flux:$PROD_TOKEN
+
+  # Copy an artifact from ECR to GHCR
+  flux copy artifact oci://123456789.dkr.ecr.us-east-1.amazonaws.com/app:v1.0.0 oci://ghcr.io/org/app:v1.0.0 \
+	--src-provider=aws \
+	--dst-creds=flux:$GITHUB_TOKEN
+
+  # Carry an artifact into an air-gapped environment
+  flux copy artifact oci://ghcr.io/org/app:v1.0.0 ./airgap/app
+  flux copy artifact ./airgap/app oci://registry.internal/org/app
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: copyArtifactCmdRun,
+}
+
+type copyArtifactFlags struct {
+	srcCreds    string
+	srcProvider flags.SourceOCIProvider
+	dstCreds    string
+	dstProvider flags.SourceOCIProvider
+}
+
+var copyArtifactArgs = newCopyArtifactFlags()
+
+func newCopyArtifactFlags() copyArtifactFlags {
+	return copyArtifactFlags{
+		srcProvider: flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+		dstProvider: flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+	}
+}
+
+func init() {
+	copyArtifactCmd.Flags().StringVar(&copyArtifactArgs.srcCreds, "src-creds", "",
+		"credentials for the source OCI registry in the format <username>[:<password>] if --src-provider is generic")
+	copyArtifactCmd.Flags().Var(&copyArtifactArgs.srcProvider, "src-provider", copyArtifactArgs.srcProvider.Description())
+	copyArtifactCmd.Flags().StringVar(&copyArtifactArgs.dstCreds, "dst-creds", "",
+		"credentials for the destination OCI registry in the format <username>[:<password>] if --dst-provider is generic")
+	copyArtifactCmd.Flags().Var(&copyArtifactArgs.dstProvider, "dst-provider", copyArtifactArgs.dstProvider.Description())
+
+	copyCmd.AddCommand(copyArtifactCmd)
+}
+
+func copyArtifactCmdRun(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	src, err := artifactLocation(ctx, args[0], copyArtifactArgs.srcCreds, copyArtifactArgs.srcProvider)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dst, err := artifactLocation(ctx, args[1], copyArtifactArgs.dstCreds, copyArtifactArgs.dstProvider)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	logger.Actionf("copying artifact from %s to %s", args[0], args[1])
+	digest, err := artifact.Copy(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	logger.Successf("artifact copied with digest %s", digest)
+	return nil
+}
+
+// artifactLocation returns the location of an 'oci://' URL with a client
+// logged in with the given credentials or provider, or the location of a
+// local OCI image layout.
+func artifactLocation(ctx context.Context, arg, creds string, provider flags.SourceOCIProvider) (artifact.Location, error) {
+	if !strings.HasPrefix(arg, sourcev1.OCIRepositoryPrefix) {
+		return artifact.Location{Layout: arg}, nil
+	}
+
+	url, err := oci.ParseArtifactURL(arg)
+	if err != nil {
+		return artifact.Location{}, err
+	}
+	ociClient := artifact.NewClient()
+
+	if provider.String() == sourcev1.GenericOCIProvider && creds != "" {
+		logger.Actionf("logging in to registry with credentials")
+		if err := ociClient.LoginWithCredentials(creds); err != nil {
+			return artifact.Location{}, fmt.Errorf("could not login with credentials: %w", err)
+		}
+	}
+
+	if provider.String() != sourcev1.GenericOCIProvider {
+		logger.Actionf("logging in to registry with provider credentials")
+		ociProvider, err := provider.ToOCIProvider()
+		if err != nil {
+			return artifact.Location{}, fmt.Errorf("provider not supported: %w", err)
+		}
+
+		if err := ociClient.LoginWithProvider(ctx, url, ociProvider); err != nil {
+			return artifact.Location{}, fmt.Errorf("error during login with provider: %w", err)
+		}
+	}
+	return artifact.Location{Client: ociClient, URL: url}, nil
+}
@@ -0,0 +1,84 @@
+//go:build unit
+// +build unit
+
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyArtifact(t *testing.T) {
+	output, err := executeCommand(fmt.Sprintf("push artifact oci://%s/staging/podinfo:v1.0.0 --path=./testdata/diff-artifact/deployment.yaml --source=test --revision=v1.0.0 -o json",
+		dockerReg))
+	if err != nil {
+		t.Fatalf("push failed: %s", err)
+	}
+	var info struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("invalid output %q: %s", output, err)
+	}
+
+	layout := filepath.Join(t.TempDir(), "airgap")
+	assertDigest := func(output string, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(output, info.Digest) {
+			return fmt.Errorf("expected the digest %s to be preserved, got:\n%s", info.Digest, output)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name   string
+		args   string
+		assert assertFunc
+	}{
+		{
+			name:   "registry to layout",
+			args:   fmt.Sprintf("copy artifact oci://%s/staging/podinfo:v1.0.0 %s", dockerReg, layout),
+			assert: assertDigest,
+		},
+		{
+			name:   "layout to registry",
+			args:   fmt.Sprintf("copy artifact %s oci://%s/production/podinfo", layout, dockerReg),
+			assert: assertDigest,
+		},
+		{
+			name:   "list the copied artifact",
+			args:   fmt.Sprintf("list artifacts oci://%s/production/podinfo", dockerReg),
+			assert: assertDigest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assert,
+			}
+			cmd.runTestCmd(t)
+		})
+	}
+}
@@ -0,0 +1,410 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	"github.com/fluxcd/pkg/apis/meta"
+	oci "github.com/fluxcd/pkg/oci/client"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/artifact"
+	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
+)
+
+var createDeploymentOCICmd = &cobra.Command{
+	Use:   "oci [name]",
+	Short: "Push manifests to an OCI repository and deploy them with Flux",
+	Long: `The create deployment oci command pushes the manifests at --path to the OCI repository of --url with the given tag,
+and generates the OCIRepository and the Kustomization that deploy them, both named after the deployment.
+With --username and --password, the command also generates an image pull secret named '<name>-auth', used by the OCIRepository
+and to push the artifact. Without --path, the artifact must already exist in the repository.
+All the inputs are validated and the artifact is pushed before any resource is applied. If one of the resources fails
+to be applied, the resources created by the command are deleted and the ones it updated are restored, the pushed
+artifact is kept in the repository.
+With --export, the resources are printed in YAML format to stdout instead of being applied, to be committed to Git.`,
+	Example: `  # Push the manifests of an application to GHCR and deploy them
+  flux create deployment oci podinfo \
+    --url=oci://ghcr.io/org/manifests/podinfo \
+    --tag=latest \
+    --path=./kustomize \
+    --username=flux \
+    --password=${GITHUB_TOKEN} \
+    --target-namespace=default
+
+  # Push the manifests and generate the Flux resources to be committed to Git
+  flux create deployment oci podinfo \
+    --url=oci://ghcr.io/org/manifests/podinfo \
+    --tag=latest \
+    --path=./kustomize \
+    --source="$(git config --get remote.origin.url)" \
+    --revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)" \
+    --export > ./clusters/production/podinfo.yaml`,
+	RunE: createDeploymentOCICmdRun,
+}
+
+type deploymentOCIFlags struct {
+	url             string
+	tag             string
+	path            string
+	source          string
+	revision        string
+	username        string
+	password        string
+	provider        flags.SourceOCIProvider
+	ksPath          flags.SafeRelativePath
+	targetNamespace string
+	prune           bool
+	wait            bool
+}
+
+var deploymentOCIArgs = newDeploymentOCIFlags()
+
+func newDeploymentOCIFlags() deploymentOCIFlags {
+	return deploymentOCIFlags{
+		provider: flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+		ksPath:   "./",
+		prune:    true,
+	}
+}
+
+func init() {
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.url, "url", "", "the OCI repository URL, in the format 'oci://<registry>/<repository>'")
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.tag, "tag", "", "the tag of the artifact")
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.path, "path", "", "local path to the directory or file of the manifests to push")
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.source, "source", "",
+		"the source address of the pushed artifact, e.g. the Git URL, defaults to --url")
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.revision, "revision", "",
+		"the source revision of the pushed artifact in the format '<branch|tag>@sha1:<commit-sha>', defaults to --tag")
+	createDeploymentOCICmd.Flags().StringVarP(&deploymentOCIArgs.username, "username", "u", "", "the registry username")
+	createDeploymentOCICmd.Flags().StringVarP(&deploymentOCIArgs.password, "password", "p", "", "the registry password")
+	createDeploymentOCICmd.Flags().Var(&deploymentOCIArgs.provider, "provider", deploymentOCIArgs.provider.Description())
+	createDeploymentOCICmd.Flags().Var(&deploymentOCIArgs.ksPath, "ks-path", "path to the directory of the artifact containing a kustomization.yaml file or plain manifests")
+	createDeploymentOCICmd.Flags().StringVar(&deploymentOCIArgs.targetNamespace, "target-namespace", "", "overrides the namespace of all the objects reconciled by the Kustomization")
+	createDeploymentOCICmd.Flags().BoolVar(&deploymentOCIArgs.prune, "prune", deploymentOCIArgs.prune, "enable garbage collection")
+	createDeploymentOCICmd.Flags().BoolVar(&deploymentOCIArgs.wait, "wait", false, "enable health checking of all the applied resources")
+
+	createDeploymentCmd.AddCommand(createDeploymentOCICmd)
+}
+
+func createDeploymentOCICmdRun(cmd *cobra.Command, args []string) error {
+	deploymentName := args[0]
+
+	if deploymentOCIArgs.url == "" {
+		return fmt.Errorf("--url is required")
+	}
+	if !strings.HasPrefix(deploymentOCIArgs.url, sourcev1.OCIRepositoryPrefix) {
+		return fmt.Errorf("invalid URL '%s', must start with %s", deploymentOCIArgs.url, sourcev1.OCIRepositoryPrefix)
+	}
+	if deploymentOCIArgs.tag == "" {
+		return fmt.Errorf("--tag is required")
+	}
+	artifactURL, err := oci.ParseArtifactURL(fmt.Sprintf("%s:%s", deploymentOCIArgs.url, deploymentOCIArgs.tag))
+	if err != nil {
+		return err
+	}
+	ref, err := name.ParseReference(artifactURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL '%s': %w", deploymentOCIArgs.url, err)
+	}
+	if (deploymentOCIArgs.username == "") != (deploymentOCIArgs.password == "") {
+		return fmt.Errorf("--username and --password must be set together")
+	}
+	withSecret := deploymentOCIArgs.username != ""
+	if withSecret && deploymentOCIArgs.provider.String() != sourcev1.GenericOCIProvider {
+		return fmt.Errorf("--username and --password can't be used with --provider=%s", deploymentOCIArgs.provider.String())
+	}
+	if !strings.HasPrefix(deploymentOCIArgs.ksPath.String(), "./") {
+		return fmt.Errorf("--ks-path must begin with ./")
+	}
+	if deploymentOCIArgs.path != "" {
+		if _, err := os.Stat(deploymentOCIArgs.path); err != nil {
+			return fmt.Errorf("invalid path '%s', must point to an existing directory or file: %w", deploymentOCIArgs.path, err)
+		}
+	}
+
+	objLabels, err := parseLabels()
+	if err != nil {
+		return err
+	}
+	namespace := *kubeconfigArgs.Namespace
+
+	var secret *corev1.Secret
+	secretContent := ""
+	if withSecret {
+		manifest, err := sourcesecret.Generate(sourcesecret.Options{
+			Name:      fmt.Sprintf("%s-auth", deploymentName),
+			Namespace: namespace,
+			Registry:  ref.Context().RegistryStr(),
+			Username:  deploymentOCIArgs.username,
+			Password:  deploymentOCIArgs.password,
+		})
+		if err != nil {
+			return err
+		}
+		secret = &corev1.Secret{}
+		if err := yaml.Unmarshal([]byte(manifest.Content), secret); err != nil {
+			return err
+		}
+		secretContent = manifest.Content
+	}
+
+	repository := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: namespace,
+			Labels:    objLabels,
+		},
+		Spec: sourcev1.OCIRepositorySpec{
+			Provider: deploymentOCIArgs.provider.String(),
+			URL:      deploymentOCIArgs.url,
+			Interval: metav1.Duration{
+				Duration: createArgs.interval,
+			},
+			Reference: &sourcev1.OCIRepositoryRef{
+				Tag: deploymentOCIArgs.tag,
+			},
+		},
+	}
+	if secret != nil {
+		repository.Spec.SecretRef = &meta.LocalObjectReference{
+			Name: secret.Name,
+		}
+	}
+
+	kustomization := &kustomizev1.Kustomization{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: namespace,
+			Labels:    objLabels,
+		},
+		Spec: kustomizev1.KustomizationSpec{
+			Interval: metav1.Duration{
+				Duration: createArgs.interval,
+			},
+			Path:  deploymentOCIArgs.ksPath.ToSlash(),
+			Prune: deploymentOCIArgs.prune,
+			SourceRef: kustomizev1.CrossNamespaceSourceReference{
+				Kind: sourcev1.OCIRepositoryKind,
+				Name: deploymentName,
+			},
+			TargetNamespace: deploymentOCIArgs.targetNamespace,
+			Wait:            deploymentOCIArgs.wait,
+		},
+	}
+
+	if deploymentOCIArgs.path != "" {
+		if err := pushDeploymentArtifact(artifactURL, ref); err != nil {
+			return err
+		}
+	}
+
+	if createArgs.export {
+		if secretContent != "" {
+			rootCmd.Println(strings.TrimSpace(secretContent))
+		}
+		if err := printExport(exportOCIRepository(repository)); err != nil {
+			return err
+		}
+		return printExport(exportKs(kustomization))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := applyDeploymentObjects(ctx, kubeClient, secret, repository, kustomization); err != nil {
+		return err
+	}
+
+	logger.Waitingf("waiting for OCIRepository reconciliation")
+	repositoryName := client.ObjectKeyFromObject(repository)
+	if err := wait.PollImmediate(rootArgs.pollInterval, rootArgs.timeout,
+		isOCIRepositoryReady(ctx, kubeClient, repositoryName, repository)); err != nil {
+		return err
+	}
+	if repository.Status.Artifact == nil {
+		return fmt.Errorf("no artifact was found")
+	}
+	logger.Successf("fetched revision: %s", repository.Status.Artifact.Revision)
+
+	logger.Waitingf("waiting for Kustomization reconciliation")
+	kustomizationName := client.ObjectKeyFromObject(kustomization)
+	if err := wait.PollImmediate(rootArgs.pollInterval, rootArgs.timeout,
+		isKustomizationReady(ctx, kubeClient, kustomizationName, kustomization)); err != nil {
+		return err
+	}
+	logger.Successf("applied revision %s", kustomization.Status.LastAppliedRevision)
+	return nil
+}
+
+// pushDeploymentArtifact builds an artifact from the manifests at --path
+// and pushes it to the given URL.
+func pushDeploymentArtifact(artifactURL string, ref name.Reference) error {
+	tmpDir, err := os.MkdirTemp("", "oci")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tarball := filepath.Join(tmpDir, "artifact.tgz")
+	if err := artifact.Build(tarball, deploymentOCIArgs.path, nil); err != nil {
+		return fmt.Errorf("building artifact failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	ociClient := artifact.NewClient()
+	if deploymentOCIArgs.username != "" {
+		if err := ociClient.LoginWithCredentials(fmt.Sprintf("%s:%s", deploymentOCIArgs.username, deploymentOCIArgs.password)); err != nil {
+			return fmt.Errorf("could not login with credentials: %w", err)
+		}
+	}
+	if deploymentOCIArgs.provider.String() != sourcev1.GenericOCIProvider {
+		ociProvider, err := deploymentOCIArgs.provider.ToOCIProvider()
+		if err != nil {
+			return fmt.Errorf("provider not supported: %w", err)
+		}
+		if err := ociClient.LoginWithProvider(ctx, artifactURL, ociProvider); err != nil {
+			return fmt.Errorf("error during login with provider: %w", err)
+		}
+	}
+
+	source := deploymentOCIArgs.source
+	if source == "" {
+		source = deploymentOCIArgs.url
+	}
+	revision := deploymentOCIArgs.revision
+	if revision == "" {
+		revision = deploymentOCIArgs.tag
+	}
+	created, err := artifactCreated(false)
+	if err != nil {
+		return err
+	}
+
+	logger.Actionf("pushing artifact to %s", ref.String())
+	digestURL, err := ociClient.Push(ctx, artifactURL, tarball, oci.Metadata{
+		Created:  created,
+		Source:   source,
+		Revision: revision,
+	})
+	if err != nil {
+		return fmt.Errorf("pushing artifact failed: %w", err)
+	}
+	logger.Successf("artifact successfully pushed to %s", digestURL)
+	return nil
+}
+
+// applyDeploymentObjects creates or updates the image pull secret, if not
+// nil, the OCIRepository and the Kustomization. If one of them fails to be
+// applied, the objects created before it are deleted and the objects updated
+// before it are restored to their previous state.
+func applyDeploymentObjects(ctx context.Context, kubeClient client.Client,
+	secret *corev1.Secret, repository *sourcev1.OCIRepository, kustomization *kustomizev1.Kustomization) error {
+	type step struct {
+		kind string
+		obj  client.Object
+		// previous receives the object in the cluster before the apply
+		previous client.Object
+		apply    func() error
+	}
+	var steps []step
+	if secret != nil {
+		steps = append(steps, step{"Secret", secret, &corev1.Secret{}, func() error {
+			return upsertSecret(ctx, kubeClient, *secret)
+		}})
+	}
+	steps = append(steps,
+		step{sourcev1.OCIRepositoryKind, repository, &sourcev1.OCIRepository{}, func() error {
+			_, err := upsertOCIRepository(ctx, kubeClient, repository)
+			return err
+		}},
+		step{kustomizev1.KustomizationKind, kustomization, &kustomizev1.Kustomization{}, func() error {
+			_, err := upsertKustomization(ctx, kubeClient, kustomization)
+			return err
+		}},
+	)
+
+	var applied []step
+	for _, s := range steps {
+		logger.Actionf("applying %s %s", s.kind, s.obj.GetName())
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(s.obj), s.previous)
+		switch {
+		case apierrors.IsNotFound(err):
+			s.previous = nil
+			err = s.apply()
+		case err != nil:
+			err = fmt.Errorf("unable to get %s %s: %w", s.kind, s.obj.GetName(), err)
+		default:
+			err = s.apply()
+		}
+		if err != nil {
+			for i := len(applied) - 1; i >= 0; i-- {
+				a := applied[i]
+				if a.previous == nil {
+					logger.Actionf("deleting %s %s", a.kind, a.obj.GetName())
+					if err := kubeClient.Delete(ctx, a.obj); err != nil && !apierrors.IsNotFound(err) {
+						logger.Failuref("unable to delete %s %s: %s", a.kind, a.obj.GetName(), err.Error())
+					}
+					continue
+				}
+				logger.Actionf("restoring %s %s", a.kind, a.obj.GetName())
+				if err := restoreObject(ctx, kubeClient, a.previous); err != nil {
+					logger.Failuref("unable to restore %s %s: %s", a.kind, a.obj.GetName(), err.Error())
+				}
+			}
+			return fmt.Errorf("applying %s %s failed: %w", s.kind, s.obj.GetName(), err)
+		}
+		applied = append(applied, s)
+	}
+	return nil
+}
+
+// restoreObject updates the object in the cluster to the given previous
+// state.
+func restoreObject(ctx context.Context, kubeClient client.Client, previous client.Object) error {
+	current := previous.DeepCopyObject().(client.Object)
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(previous), current); err != nil {
+		return err
+	}
+	previous.SetResourceVersion(current.GetResourceVersion())
+	previous.SetManagedFields(nil)
+	return kubeClient.Update(ctx, previous)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+)
+
+func TestCreateDeploymentOCI(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := fmt.Sprintf("%s/manifests/podinfo", u.Host)
+
+	tests := []struct {
+		name       string
+		args       string
+		assertFunc assertFunc
+	}{
+		{
+			name:       "NoArgs",
+			args:       "create deployment oci",
+			assertFunc: assertError("name is required"),
+		},
+		{
+			name:       "NoURL",
+			args:       "create deployment oci podinfo --tag=latest",
+			assertFunc: assertError("--url is required"),
+		},
+		{
+			name:       "NoTag",
+			args:       "create deployment oci podinfo --url=oci://ghcr.io/org/manifests/podinfo",
+			assertFunc: assertError("--tag is required"),
+		},
+		{
+			name:       "username without password",
+			args:       "create deployment oci podinfo --url=oci://ghcr.io/org/manifests/podinfo --tag=latest --username=flux",
+			assertFunc: assertError("--username and --password must be set together"),
+		},
+		{
+			name:       "export manifests",
+			args:       "create deployment oci podinfo --url=oci://ghcr.io/org/manifests/podinfo --tag=latest --ks-path=./deploy --target-namespace=default --interval=10m --export",
+			assertFunc: assertGoldenFile("./testdata/oci/export_deployment.golden"),
+		},
+		{
+			name:       "export manifests with secret",
+			args:       "create deployment oci podinfo --url=oci://ghcr.io/org/manifests/podinfo --tag=latest --username=flux --password=secret --interval=10m --export",
+			assertFunc: assertGoldenFile("./testdata/oci/export_deployment_with_secret.golden"),
+		},
+		{
+			name: "push and export manifests",
+			args: fmt.Sprintf("create deployment oci podinfo --url=oci://%s --tag=v1.0.0 --path=./testdata/build-kustomization/podinfo --interval=10m --export", repo),
+			assertFunc: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, fmt.Sprintf("url: oci://%s", repo)) {
+					return fmt.Errorf("expected the OCIRepository of %s, got:\n%s", repo, output)
+				}
+				if _, err := crane.Manifest(repo + ":v1.0.0"); err != nil {
+					return fmt.Errorf("expected the artifact to be pushed: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assertFunc,
+			}
+
+			cmd.runTestCmd(t)
+		})
+	}
+}
+
+// failingKsClient fails to create Kustomizations.
+type failingKsClient struct {
+	client.Client
+}
+
+func (c failingKsClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*kustomizev1.Kustomization); ok {
+		return fmt.Errorf("admission webhook denied the request")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestApplyDeploymentObjects_Rollback(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "flux-system"}
+	}
+	existing := &corev1.Secret{ObjectMeta: meta("podinfo-auth"), Data: map[string][]byte{"key": []byte("previous")}}
+	kubeClient := failingKsClient{fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(existing).Build()}
+
+	secret := &corev1.Secret{ObjectMeta: meta("podinfo-auth"), StringData: map[string]string{"key": "value"}}
+	repository := &sourcev1.OCIRepository{ObjectMeta: meta("podinfo")}
+	kustomization := &kustomizev1.Kustomization{ObjectMeta: meta("podinfo")}
+
+	ctx := context.Background()
+	err := applyDeploymentObjects(ctx, kubeClient, secret, repository, kustomization)
+	if err == nil || !strings.Contains(err.Error(), "applying Kustomization podinfo failed") {
+		t.Fatalf("applyDeploymentObjects() error = %v", err)
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(repository), &sourcev1.OCIRepository{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the created OCIRepository to be deleted, got %v", err)
+	}
+	var restored corev1.Secret
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(secret), &restored); err != nil {
+		t.Fatalf("expected the existing secret to be kept, got %v", err)
+	}
+	if got := string(restored.Data["key"]); got != "previous" || len(restored.StringData) > 0 {
+		t.Errorf("expected the existing secret to be restored, got data %q and string data %v", got, restored.StringData)
+	}
+}
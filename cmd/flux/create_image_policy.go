@@ -108,64 +108,73 @@ func createImagePolicyRun(cmd *cobra.Command, args []string) error {
 		},
 	}
 
+	if err := setImagePolicySpec(&policy.Spec, imagePolicyArgs); err != nil {
+		return err
+	}
+
+	if createArgs.export {
+		return printExport(exportImagePolicy(&policy))
+	}
+
+	var existing imagev1.ImagePolicy
+	copyName(&existing, &policy)
+	err = imagePolicyType.upsertAndWait(imagePolicyAdapter{&existing}, func() error {
+		existing.Spec = policy.Spec
+		existing.SetLabels(policy.Labels)
+		return nil
+	})
+	return err
+}
+
+// setImagePolicySpec sets the policy and the tag filter of the spec from
+// the given flags.
+func setImagePolicySpec(spec *imagev1.ImagePolicySpec, args imagePolicyFlags) error {
 	switch {
-	case imagePolicyArgs.semver != "" && imagePolicyArgs.alpha != "":
-	case imagePolicyArgs.semver != "" && imagePolicyArgs.numeric != "":
-	case imagePolicyArgs.alpha != "" && imagePolicyArgs.numeric != "":
+	case args.semver != "" && args.alpha != "":
+	case args.semver != "" && args.numeric != "":
+	case args.alpha != "" && args.numeric != "":
 		return fmt.Errorf("only one of --select-semver, --select-alpha or --select-numeric can be specified")
-	case imagePolicyArgs.semver != "":
-		policy.Spec.Policy.SemVer = &imagev1.SemVerPolicy{
-			Range: imagePolicyArgs.semver,
+	case args.semver != "":
+		spec.Policy.SemVer = &imagev1.SemVerPolicy{
+			Range: args.semver,
 		}
-	case imagePolicyArgs.alpha != "":
-		if imagePolicyArgs.alpha != "desc" && imagePolicyArgs.alpha != "asc" {
+	case args.alpha != "":
+		if args.alpha != "desc" && args.alpha != "asc" {
 			return fmt.Errorf("--select-alpha must be one of [\"asc\", \"desc\"]")
 		}
-		policy.Spec.Policy.Alphabetical = &imagev1.AlphabeticalPolicy{
-			Order: imagePolicyArgs.alpha,
+		spec.Policy.Alphabetical = &imagev1.AlphabeticalPolicy{
+			Order: args.alpha,
 		}
-	case imagePolicyArgs.numeric != "":
-		if imagePolicyArgs.numeric != "desc" && imagePolicyArgs.numeric != "asc" {
+	case args.numeric != "":
+		if args.numeric != "desc" && args.numeric != "asc" {
 			return fmt.Errorf("--select-numeric must be one of [\"asc\", \"desc\"]")
 		}
-		policy.Spec.Policy.Numerical = &imagev1.NumericalPolicy{
-			Order: imagePolicyArgs.numeric,
+		spec.Policy.Numerical = &imagev1.NumericalPolicy{
+			Order: args.numeric,
 		}
 	default:
 		return fmt.Errorf("a policy must be provided with either --select-semver or --select-alpha")
 	}
 
-	if imagePolicyArgs.filterRegex != "" {
-		exp, err := syntax.Parse(imagePolicyArgs.filterRegex, syntax.Perl)
+	if args.filterRegex != "" {
+		exp, err := syntax.Parse(args.filterRegex, syntax.Perl)
 		if err != nil {
 			return fmt.Errorf("--filter-regex is an invalid regex pattern")
 		}
-		policy.Spec.FilterTags = &imagev1.TagFilter{
-			Pattern: imagePolicyArgs.filterRegex,
+		spec.FilterTags = &imagev1.TagFilter{
+			Pattern: args.filterRegex,
 		}
 
-		if imagePolicyArgs.filterExtract != "" {
-			if err := validateExtractStr(imagePolicyArgs.filterExtract, exp.CapNames()); err != nil {
+		if args.filterExtract != "" {
+			if err := validateExtractStr(args.filterExtract, exp.CapNames()); err != nil {
 				return err
 			}
-			policy.Spec.FilterTags.Extract = imagePolicyArgs.filterExtract
+			spec.FilterTags.Extract = args.filterExtract
 		}
-	} else if imagePolicyArgs.filterExtract != "" {
+	} else if args.filterExtract != "" {
 		return fmt.Errorf("cannot specify --filter-extract without specifying --filter-regex")
 	}
-
-	if createArgs.export {
-		return printExport(exportImagePolicy(&policy))
-	}
-
-	var existing imagev1.ImagePolicy
-	copyName(&existing, &policy)
-	err = imagePolicyType.upsertAndWait(imagePolicyAdapter{&existing}, func() error {
-		existing.Spec = policy.Spec
-		existing.SetLabels(policy.Labels)
-		return nil
-	})
-	return err
+	return nil
 }
 
 // Performs a dry-run of the extract function in Regexp to validate the template
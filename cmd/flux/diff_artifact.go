@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/fluxcd/flux2/internal/artifact"
 	"github.com/fluxcd/flux2/internal/flags"
 	oci "github.com/fluxcd/pkg/oci/client"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
@@ -30,9 +31,16 @@ import (
 var diffArtifactCmd = &cobra.Command{
 	Use:   "artifact",
 	Short: "Diff Artifact",
-	Long:  `The diff artifact command computes the diff between the remote OCI artifact and a local directory or file`,
+	Long: `The diff artifact command computes the diff between the remote OCI artifact and a local directory or file.
+The differences are printed per file, as a dyff report for the YAML files and as a unified diff for the other files,
+where the remote artifact is 'a/' and the local files are 'b/'.
+The command exits with 1 if there are differences and with 2 if the comparison failed, e.g. on invalid arguments or on login, fetch or signature verification errors.
+With --verify, the cosign signature of the artifact is verified with the public key of --verify-key before the comparison.`,
 	Example: `# Check if local files differ from remote
-flux diff artifact oci://ghcr.io/stefanprodan/manifests:podinfo:6.2.0 --path=./kustomize`,
+flux diff artifact oci://ghcr.io/stefanprodan/manifests:podinfo:6.2.0 --path=./kustomize
+
+# Check if local files differ from a signed remote artifact
+flux diff artifact oci://ghcr.io/stefanprodan/manifests:podinfo:6.2.0 --path=./kustomize --verify --verify-key=cosign.pub`,
 	RunE: diffArtifactCmdRun,
 }
 
@@ -41,6 +49,8 @@ type diffArtifactFlags struct {
 	creds       string
 	provider    flags.SourceOCIProvider
 	ignorePaths []string
+	verify      bool
+	verifyKey   string
 }
 
 var diffArtifactArgs = newDiffArtifactArgs()
@@ -56,37 +66,45 @@ func init() {
 	diffArtifactCmd.Flags().StringVar(&diffArtifactArgs.creds, "creds", "", "credentials for OCI registry in the format <username>[:<password>] if --provider is generic")
 	diffArtifactCmd.Flags().Var(&diffArtifactArgs.provider, "provider", sourceOCIRepositoryArgs.provider.Description())
 	diffArtifactCmd.Flags().StringSliceVar(&diffArtifactArgs.ignorePaths, "ignore-paths", excludeOCI, "set paths to ignore in .gitignore format")
+	diffArtifactCmd.Flags().BoolVar(&diffArtifactArgs.verify, "verify", false,
+		"verify the cosign signature of the artifact with the public key of --verify-key before the comparison")
+	diffArtifactCmd.Flags().StringVar(&diffArtifactArgs.verifyKey, "verify-key", "", "path to the cosign public key")
 	diffCmd.AddCommand(diffArtifactCmd)
 }
 
 func diffArtifactCmdRun(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("artifact URL is required")
+		return &RequestError{StatusCode: 2, Err: fmt.Errorf("artifact URL is required")}
 	}
 	ociURL := args[0]
 
 	if diffArtifactArgs.path == "" {
-		return fmt.Errorf("invalid path %q", diffArtifactArgs.path)
+		return &RequestError{StatusCode: 2, Err: fmt.Errorf("invalid path %q", diffArtifactArgs.path)}
 	}
 
 	url, err := oci.ParseArtifactURL(ociURL)
 	if err != nil {
-		return err
+		return &RequestError{StatusCode: 2, Err: err}
 	}
 
 	if _, err := os.Stat(diffArtifactArgs.path); err != nil {
-		return fmt.Errorf("invalid path '%s', must point to an existing directory or file", diffArtifactArgs.path)
+		return &RequestError{StatusCode: 2, Err: fmt.Errorf("invalid path '%s', must point to an existing directory or file", diffArtifactArgs.path)}
+	}
+
+	verifyKey, err := loadVerifyKey(diffArtifactArgs.verify, diffArtifactArgs.verifyKey)
+	if err != nil {
+		return &RequestError{StatusCode: 2, Err: err}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
 
-	ociClient := oci.NewLocalClient()
+	ociClient := artifact.NewClient()
 
 	if diffArtifactArgs.provider.String() == sourcev1.GenericOCIProvider && diffArtifactArgs.creds != "" {
 		logger.Actionf("logging in to registry with credentials")
 		if err := ociClient.LoginWithCredentials(diffArtifactArgs.creds); err != nil {
-			return fmt.Errorf("could not login with credentials: %w", err)
+			return &RequestError{StatusCode: 2, Err: fmt.Errorf("could not login with credentials: %w", err)}
 		}
 	}
 
@@ -94,18 +112,31 @@ func diffArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		logger.Actionf("logging in to registry with provider credentials")
 		ociProvider, err := diffArtifactArgs.provider.ToOCIProvider()
 		if err != nil {
-			return fmt.Errorf("provider not supported: %w", err)
+			return &RequestError{StatusCode: 2, Err: fmt.Errorf("provider not supported: %w", err)}
 		}
 
 		if err := ociClient.LoginWithProvider(ctx, url, ociProvider); err != nil {
-			return fmt.Errorf("error during login with provider: %w", err)
+			return &RequestError{StatusCode: 2, Err: fmt.Errorf("error during login with provider: %w", err)}
+		}
+	}
+
+	if verifyKey != nil {
+		if url, err = verifyArtifact(ctx, ociClient, url, verifyKey); err != nil {
+			return &RequestError{StatusCode: 2, Err: err}
 		}
 	}
 
-	if err := ociClient.Diff(ctx, url, diffArtifactArgs.path, diffArtifactArgs.ignorePaths); err != nil {
-		return err
+	diffs, err := ociClient.Diff(ctx, url, diffArtifactArgs.path, diffArtifactArgs.ignorePaths)
+	if err != nil {
+		return &RequestError{StatusCode: 2, Err: err}
+	}
+	if len(diffs) == 0 {
+		logger.Successf("no changes detected")
+		return nil
 	}
 
-	logger.Successf("no changes detected")
-	return nil
+	if err := artifact.WriteDiff(cmd.OutOrStdout(), diffs); err != nil {
+		return &RequestError{StatusCode: 2, Err: err}
+	}
+	return &RequestError{StatusCode: 1, Err: fmt.Errorf("the remote artifact contents differs from the local one")}
 }
@@ -30,9 +30,10 @@ import (
 	_ "github.com/distribution/distribution/v3/registry/auth/htpasswd"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	"github.com/phayes/freeport"
-	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// dockerReg is the address of the registry started once by TestMain for
+// all the tests.
 var dockerReg string
 
 func setupRegistryServer(ctx context.Context) error {
@@ -46,7 +47,10 @@ func setupRegistryServer(ctx context.Context) error {
 	dockerReg = fmt.Sprintf("localhost:%d", port)
 	config.HTTP.Addr = fmt.Sprintf("127.0.0.1:%d", port)
 	config.HTTP.DrainTimeout = time.Duration(10) * time.Second
-	config.Storage = map[string]configuration.Parameters{"inmemory": map[string]interface{}{}}
+	config.Storage = map[string]configuration.Parameters{
+		"inmemory": map[string]interface{}{},
+		"delete":   map[string]interface{}{"enabled": true},
+	}
 	dockerRegistry, err := registry.NewRegistry(ctx, config)
 	if err != nil {
 		return fmt.Errorf("failed to create docker registry: %w", err)
@@ -85,12 +89,6 @@ func TestDiffArtifact(t *testing.T) {
 		},
 	}
 
-	ctx := ctrl.SetupSignalHandler()
-	err := setupRegistryServer(ctx)
-	if err != nil {
-		panic(fmt.Sprintf("failed to start docker registry: %s", err))
-	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.url = fmt.Sprintf(tt.url, dockerReg)
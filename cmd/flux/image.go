@@ -17,12 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"github.com/spf13/cobra"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	autov1 "github.com/fluxcd/image-automation-controller/api/v1beta1"
 	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
 )
 
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Work with image automation locally",
+	Long:  "The image sub-commands evaluate image automation objects locally, without the image controllers.",
+}
+
+func init() {
+	rootCmd.AddCommand(imageCmd)
+}
+
 // These are general-purpose adapters for attaching methods to, for
 // the various commands. The *List adapters implement len(), since
 // it's used in at least a couple of commands.
@@ -0,0 +1,237 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/artifact"
+	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/internal/imagepolicy"
+	"github.com/fluxcd/flux2/pkg/printers"
+)
+
+var imagePolicyPreviewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Preview the tag selected by an image policy",
+	Long: `The image policy preview command lists the tags of an image, from its registry or from a file,
+and evaluates an image policy with the same semantics as image-reflector-controller.
+It prints the tags matching --filter-regex, the sort keys extracted with --filter-extract, their rank
+according to the policy, and the selected tag.
+The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.`,
+	Example: `  # Preview the latest stable release of an image
+  flux image policy preview --image=ghcr.io/stefanprodan/podinfo --select-semver=">=1.0.0"
+
+  # Preview the latest main branch build tagged as "${GIT_BRANCH}-${GIT_SHA:0:7}-$(date +%s)"
+  flux image policy preview --image=ghcr.io/org/app \
+    --select-numeric=asc \
+    --filter-regex='^main-[a-f0-9]+-(?P<ts>[0-9]+)' \
+    --filter-extract='$ts'
+
+  # Preview a policy against a list of tags, one per line
+  flux image policy preview --tags-file=./tags.txt --select-alpha=asc`,
+	RunE: imagePolicyPreviewCmdRun,
+}
+
+type imagePolicyPreviewFlags struct {
+	imagePolicyFlags
+	image         string
+	tagsFile      string
+	exclusionList []string
+	creds         string
+	provider      flags.SourceOCIProvider
+	output        string
+}
+
+var imagePolicyPreviewArgs = newImagePolicyPreviewFlags()
+
+func newImagePolicyPreviewFlags() imagePolicyPreviewFlags {
+	return imagePolicyPreviewFlags{
+		exclusionList: imagepolicy.DefaultExclusionList,
+		provider:      flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+	}
+}
+
+func init() {
+	f := imagePolicyPreviewCmd.Flags()
+	f.StringVar(&imagePolicyPreviewArgs.image, "image", "", "the image repository whose tags are listed, e.g. 'ghcr.io/stefanprodan/podinfo'")
+	f.StringVar(&imagePolicyPreviewArgs.tagsFile, "tags-file", "", "path to a file with one tag per line, '-' to read the tags from stdin")
+	f.StringSliceVar(&imagePolicyPreviewArgs.exclusionList, "exclusion-list", imagePolicyPreviewArgs.exclusionList,
+		"regular expressions of the tags to ignore, like the exclusion list of an ImageRepository")
+	f.StringVar(&imagePolicyPreviewArgs.semver, "select-semver", "", "a semver range to apply to tags; e.g., '1.x'")
+	f.StringVar(&imagePolicyPreviewArgs.alpha, "select-alpha", "", "use alphabetical sorting to select image; either \"asc\" meaning select the last, or \"desc\" meaning select the first")
+	f.StringVar(&imagePolicyPreviewArgs.numeric, "select-numeric", "", "use numeric sorting to select image; either \"asc\" meaning select the last, or \"desc\" meaning select the first")
+	f.StringVar(&imagePolicyPreviewArgs.filterRegex, "filter-regex", "", "regular expression pattern used to filter the image tags")
+	f.StringVar(&imagePolicyPreviewArgs.filterExtract, "filter-extract", "", "replacement pattern (using capture groups from --filter-regex) to use for sorting")
+	f.StringVar(&imagePolicyPreviewArgs.creds, "creds", "", "credentials for the registry in the format <username>[:<password>] if --provider is generic")
+	f.Var(&imagePolicyPreviewArgs.provider, "provider", imagePolicyPreviewArgs.provider.Description())
+	f.StringVarP(&imagePolicyPreviewArgs.output, "output", "o", "",
+		"the format in which the result should be printed, can be 'json' or 'yaml'")
+
+	imagePolicyCmd.AddCommand(imagePolicyPreviewCmd)
+}
+
+func imagePolicyPreviewCmdRun(cmd *cobra.Command, args []string) error {
+	switch {
+	case imagePolicyPreviewArgs.image == "" && imagePolicyPreviewArgs.tagsFile == "":
+		return fmt.Errorf("either --image or --tags-file is required")
+	case imagePolicyPreviewArgs.image != "" && imagePolicyPreviewArgs.tagsFile != "":
+		return fmt.Errorf("only one of --image or --tags-file can be specified")
+	}
+	switch imagePolicyPreviewArgs.output {
+	case "", "json", "yaml":
+	default:
+		return fmt.Errorf("invalid output format '%s', must be 'json' or 'yaml'", imagePolicyPreviewArgs.output)
+	}
+
+	var spec imagev1.ImagePolicySpec
+	if err := setImagePolicySpec(&spec, imagePolicyPreviewArgs.imagePolicyFlags); err != nil {
+		return err
+	}
+
+	var tags []string
+	var err error
+	if imagePolicyPreviewArgs.image != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+		defer cancel()
+
+		tags, err = listImageTags(ctx, imagePolicyPreviewArgs.image)
+	} else {
+		tags, err = readImageTags(imagePolicyPreviewArgs.tagsFile, cmd.InOrStdin())
+	}
+	if err != nil {
+		return err
+	}
+
+	tags, err = imagepolicy.Filter(tags, imagePolicyPreviewArgs.exclusionList)
+	if err != nil {
+		return err
+	}
+
+	result, err := imagepolicy.Evaluate(spec, tags)
+	if err != nil {
+		return fmt.Errorf("evaluating the policy failed: %w", err)
+	}
+
+	switch imagePolicyPreviewArgs.output {
+	case "json":
+		marshalled, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("result JSON conversion failed: %w", err)
+		}
+		marshalled = append(marshalled, "\n"...)
+		cmd.Print(string(marshalled))
+		return nil
+	case "yaml":
+		marshalled, err := yaml.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("result YAML conversion failed: %w", err)
+		}
+		cmd.Print(string(marshalled))
+		return nil
+	}
+
+	var rows [][]string
+	for _, c := range result.Candidates {
+		rank := "-"
+		if c.Rank > 0 {
+			rank = strconv.Itoa(c.Rank)
+		}
+		rows = append(rows, []string{c.Tag, c.Key, rank})
+	}
+	if err := printers.TablePrinter([]string{"tag", "sort key", "rank"}).Print(cmd.OutOrStdout(), rows); err != nil {
+		return err
+	}
+
+	logger.Successf("%d of %d tags match the filter", len(result.Candidates), len(tags))
+	logger.Successf("selected tag: %s", result.Latest)
+	return nil
+}
+
+// listImageTags fetches the tags of the image from its registry.
+func listImageTags(ctx context.Context, image string) ([]string, error) {
+	ociClient := artifact.NewClient()
+
+	if imagePolicyPreviewArgs.provider.String() == sourcev1.GenericOCIProvider && imagePolicyPreviewArgs.creds != "" {
+		if imagePolicyPreviewArgs.output == "" {
+			logger.Actionf("logging in to registry with credentials")
+		}
+		if err := ociClient.LoginWithCredentials(imagePolicyPreviewArgs.creds); err != nil {
+			return nil, fmt.Errorf("could not login with credentials: %w", err)
+		}
+	}
+
+	if imagePolicyPreviewArgs.provider.String() != sourcev1.GenericOCIProvider {
+		if imagePolicyPreviewArgs.output == "" {
+			logger.Actionf("logging in to registry with provider credentials")
+		}
+		ociProvider, err := imagePolicyPreviewArgs.provider.ToOCIProvider()
+		if err != nil {
+			return nil, fmt.Errorf("provider not supported: %w", err)
+		}
+
+		if err := ociClient.LoginWithProvider(ctx, image, ociProvider); err != nil {
+			return nil, fmt.Errorf("error during login with provider: %w", err)
+		}
+	}
+
+	if imagePolicyPreviewArgs.output == "" {
+		logger.Actionf("listing tags of %s", image)
+	}
+	return ociClient.Tags(ctx, image)
+}
+
+// readImageTags reads the tags from the file, one tag per line, ignoring
+// blank lines and comments starting with '#'.
+func readImageTags(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tags file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var tags []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		tag := strings.TrimSpace(scanner.Text())
+		if tag == "" || strings.HasPrefix(tag, "#") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read tags file: %w", err)
+	}
+	return tags, nil
+}
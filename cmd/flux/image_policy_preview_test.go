@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestImagePolicyPreview(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := fmt.Sprintf("%s/podinfo", u.Host)
+	for _, tag := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		img, err := crane.Image(map[string][]byte{"tag": []byte(tag)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := crane.Push(img, image+":"+tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       string
+		assertFunc assertFunc
+	}{
+		{
+			name:       "no tags source",
+			args:       "image policy preview --select-semver=1.x",
+			assertFunc: assertError("either --image or --tags-file is required"),
+		},
+		{
+			name:       "image and tags file",
+			args:       "image policy preview --image=ghcr.io/org/app --tags-file=./testdata/image/tags.txt --select-semver=1.x",
+			assertFunc: assertError("only one of --image or --tags-file can be specified"),
+		},
+		{
+			name:       "no policy",
+			args:       "image policy preview --tags-file=./testdata/image/tags.txt",
+			assertFunc: assertError("a policy must be provided with either --select-semver or --select-alpha"),
+		},
+		{
+			name:       "invalid extract",
+			args:       "image policy preview --tags-file=./testdata/image/tags.txt --select-numeric=asc --filter-regex='^main-(?P<ts>[0-9]+)' --filter-extract='$sha'",
+			assertFunc: assertError("capture group $sha used in --filter-extract not found in --filter-regex"),
+		},
+		{
+			name:       "semver",
+			args:       "image policy preview --tags-file=./testdata/image/tags.txt --select-semver='>=6.0.0'",
+			assertFunc: assertGoldenFile("./testdata/image/preview_image_policy_semver.golden"),
+		},
+		{
+			name:       "numeric with extract",
+			args:       "image policy preview --tags-file=./testdata/image/tags.txt --select-numeric=asc --filter-regex='^main-[a-f0-9]+-(?P<ts>[0-9]+)' --filter-extract='$ts'",
+			assertFunc: assertGoldenFile("./testdata/image/preview_image_policy_numeric.golden"),
+		},
+		{
+			name:       "numeric without filter",
+			args:       "image policy preview --tags-file=./testdata/image/tags.txt --select-numeric=asc",
+			assertFunc: assertError("evaluating the policy failed: failed to parse invalid numeric value '6.0.0'"),
+		},
+		{
+			name: "registry",
+			args: fmt.Sprintf("image policy preview --image=%s --select-semver=1.x -o json", image),
+			assertFunc: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, `"latest": "1.1.0"`) {
+					return fmt.Errorf("expected tag 1.1.0 to be selected, got:\n%s", output)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assertFunc,
+			}
+
+			cmd.runTestCmd(t)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/pkg/ssa"
+
+	"github.com/fluxcd/flux2/internal/imageupdate"
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/printers"
+)
+
+var imageUpdateLocalCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Apply image policies to a local checkout",
+	Long: `The image update command applies the latest images of the ImagePolicies to the
+'$imagepolicy' setter markers of the YAML files in a local checkout, as image-automation-controller does.
+The ImagePolicies of the namespace are read from the cluster, or from a file with --policies-file.
+The command prints a diff of the updated files and the commit message produced by --commit-template.`,
+	Example: `  # Update the images of a checkout with the ImagePolicies of the flux-system namespace
+  flux image update --local=./fleet-infra --path=./clusters/my-cluster
+
+  # Preview the updates and the commit message without changing the files
+  flux image update --local=./fleet-infra \
+    --commit-template="{{range .Updated.Images}}{{println .}}{{end}}" \
+    --dry-run
+
+  # Update the images with ImagePolicies exported from a cluster
+  kubectl -n flux-system get imagepolicies -o yaml > policies.yaml
+  flux image update --local=./fleet-infra --policies-file=./policies.yaml`,
+	RunE: imageUpdateLocalCmdRun,
+}
+
+type imageUpdateLocalFlags struct {
+	local          string
+	path           string
+	policiesFile   string
+	commitTemplate string
+	automation     string
+	dryRun         bool
+}
+
+var imageUpdateLocalArgs = newImageUpdateLocalFlags()
+
+func newImageUpdateLocalFlags() imageUpdateLocalFlags {
+	return imageUpdateLocalFlags{
+		automation: rootArgs.defaults.Namespace,
+	}
+}
+
+func init() {
+	imageUpdateLocalCmd.Flags().StringVar(&imageUpdateLocalArgs.local, "local", "",
+		"path to the local checkout of the Git repository")
+	imageUpdateLocalCmd.Flags().StringVar(&imageUpdateLocalArgs.path, "path", "",
+		"path to the directory containing the manifests to be updated, relative to the checkout, defaults to the checkout root")
+	imageUpdateLocalCmd.Flags().StringVar(&imageUpdateLocalArgs.policiesFile, "policies-file", "",
+		"path to a file with the ImagePolicies and their status, instead of reading them from the cluster")
+	imageUpdateLocalCmd.Flags().StringVar(&imageUpdateLocalArgs.commitTemplate, "commit-template", "",
+		"a template for commit messages, defaults to the one of image-automation-controller")
+	imageUpdateLocalCmd.Flags().StringVar(&imageUpdateLocalArgs.automation, "automation", imageUpdateLocalArgs.automation,
+		"the name of the ImageUpdateAutomation given to the commit template")
+	imageUpdateLocalCmd.Flags().BoolVar(&imageUpdateLocalArgs.dryRun, "dry-run", false,
+		"print the diff and the commit message without updating the files")
+
+	imageCmd.AddCommand(imageUpdateLocalCmd)
+}
+
+func imageUpdateLocalCmdRun(cmd *cobra.Command, args []string) error {
+	if imageUpdateLocalArgs.local == "" {
+		return fmt.Errorf("the path to the local checkout is required (--local)")
+	}
+	if fs, err := os.Stat(imageUpdateLocalArgs.local); err != nil || !fs.IsDir() {
+		return fmt.Errorf("invalid local checkout '%s', must point to an existing directory", imageUpdateLocalArgs.local)
+	}
+
+	automation := types.NamespacedName{
+		Namespace: *kubeconfigArgs.Namespace,
+		Name:      imageUpdateLocalArgs.automation,
+	}
+	// Validate the template before reading the policies.
+	if _, err := imageupdate.CommitMessage(imageUpdateLocalArgs.commitTemplate, automation, imageupdate.Result{}); err != nil {
+		return err
+	}
+
+	var policies []imagev1.ImagePolicy
+	var err error
+	if imageUpdateLocalArgs.policiesFile != "" {
+		policies, err = readImagePolicies(imageUpdateLocalArgs.policiesFile, *kubeconfigArgs.Namespace)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+		defer cancel()
+
+		policies, err = listImagePolicies(ctx, *kubeconfigArgs.Namespace)
+	}
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return fmt.Errorf("no ImagePolicies found in the %s namespace", *kubeconfigArgs.Namespace)
+	}
+
+	changes, result, err := imageupdate.UpdateWithSetters(imageUpdateLocalArgs.local, imageUpdateLocalArgs.path, policies)
+	if err != nil {
+		return fmt.Errorf("updating the images failed: %w", err)
+	}
+	if len(changes) == 0 {
+		logger.Successf("no updates made")
+		return nil
+	}
+
+	diffs := make([]printers.FileDiff, 0, len(changes))
+	for _, c := range changes {
+		diffs = append(diffs, printers.FileDiff{Path: c.Path, From: c.Before, To: c.After})
+	}
+	if err := printers.NewUnifiedDiffPrinter().Print(cmd.OutOrStdout(), diffs); err != nil {
+		return err
+	}
+
+	message, err := imageupdate.CommitMessage(imageUpdateLocalArgs.commitTemplate, automation, result)
+	if err != nil {
+		return err
+	}
+	logger.Generatef("commit message:")
+	cmd.Println(message)
+
+	if imageUpdateLocalArgs.dryRun {
+		return nil
+	}
+
+	for _, c := range changes {
+		p := filepath.Join(imageUpdateLocalArgs.local, filepath.FromSlash(c.Path))
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, c.After, fi.Mode()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", c.Path, err)
+		}
+	}
+	logger.Successf("updated %d images in %d files", len(result.Images()), len(changes))
+	return nil
+}
+
+// listImagePolicies returns the ImagePolicies of the namespace.
+func listImagePolicies(ctx context.Context, namespace string) ([]imagev1.ImagePolicy, error) {
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var list imagev1.ImagePolicyList
+	if err := kubeClient.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing ImagePolicies failed: %w", err)
+	}
+	return list.Items, nil
+}
+
+// readImagePolicies returns the ImagePolicies of the namespace found in the
+// file, the policies without a namespace being in the given namespace.
+func readImagePolicies(path, namespace string) ([]imagev1.ImagePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policies file: %w", err)
+	}
+	objects, err := ssa.ReadObjects(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid objects in %s: %w", filepath.Base(path), err)
+	}
+
+	var policies []imagev1.ImagePolicy
+	for _, obj := range objects {
+		if obj.GetKind() != imagev1.ImagePolicyKind {
+			continue
+		}
+		var policy imagev1.ImagePolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &policy); err != nil {
+			return nil, fmt.Errorf("invalid ImagePolicy %s: %w", obj.GetName(), err)
+		}
+		if policy.Namespace == "" {
+			policy.Namespace = namespace
+		}
+		if policy.Namespace == namespace {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImageUpdateLocal(t *testing.T) {
+	manifest := filepath.Join("clusters", "my-cluster", "podinfo.yaml")
+	original, err := os.ReadFile(filepath.Join("testdata", "image", "update", "checkout", manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkout := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(checkout, "clusters", "my-cluster"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(checkout, manifest), original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       string
+		assertFunc assertFunc
+	}{
+		{
+			name:       "no local checkout",
+			args:       "image update --policies-file=./testdata/image/update/policies.yaml",
+			assertFunc: assertError("the path to the local checkout is required (--local)"),
+		},
+		{
+			name:       "missing local checkout",
+			args:       "image update --local=./testdata/image/update/missing --policies-file=./testdata/image/update/policies.yaml",
+			assertFunc: assertError("invalid local checkout './testdata/image/update/missing', must point to an existing directory"),
+		},
+		{
+			name: "invalid template",
+			args: "image update --local=./testdata/image/update/checkout --policies-file=./testdata/image/update/policies.yaml --commit-template='{{ .Updated'",
+			assertFunc: func(output string, err error) error {
+				if err == nil || !strings.HasPrefix(err.Error(), "unable to create commit message template from spec") {
+					return fmt.Errorf("expected a template error, got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "no policies in namespace",
+			args:       "image update --local=./testdata/image/update/checkout --policies-file=./testdata/image/update/policies.yaml -n default",
+			assertFunc: assertError("no ImagePolicies found in the default namespace"),
+		},
+		{
+			name:       "missing path",
+			args:       "image update --local=./testdata/image/update/checkout --path=./clusters/staging --policies-file=./testdata/image/update/policies.yaml",
+			assertFunc: assertError("updating the images failed: lstat testdata/image/update/checkout/clusters/staging: no such file or directory"),
+		},
+		{
+			name:       "dry run",
+			args:       "image update --local=./testdata/image/update/checkout --policies-file=./testdata/image/update/policies.yaml --commit-template='{{range .Updated.Images}}{{println .}}{{end}}' --dry-run",
+			assertFunc: assertGoldenFile("./testdata/image/update/dry_run.golden"),
+		},
+		{
+			name: "update",
+			args: fmt.Sprintf("image update --local=%s --policies-file=./testdata/image/update/policies.yaml", checkout),
+			assertFunc: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, "Update from image update automation") {
+					return fmt.Errorf("expected the default commit message, got:\n%s", output)
+				}
+				updated, err := os.ReadFile(filepath.Join(checkout, manifest))
+				if err != nil {
+					return err
+				}
+				want := strings.Replace(string(original), "podinfo:6.0.0", "podinfo:6.2.0", 1)
+				if string(updated) != want {
+					return fmt.Errorf("expected the updated file:\n%s\ngot:\n%s", want, updated)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assertFunc,
+			}
+
+			cmd.runTestCmd(t)
+		})
+	}
+
+	updated, err := os.ReadFile(filepath.Join("testdata", "image", "update", "checkout", manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != string(original) {
+		t.Errorf("expected --dry-run to leave the checkout unchanged")
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/fluxcd/flux2/internal/utils"
 	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
 	"github.com/fluxcd/flux2/pkg/status"
 )
 
@@ -49,6 +50,18 @@ If a previous version is installed, then an in-place upgrade will be performed.`
   # Install Flux onto tainted Kubernetes nodes
   flux install --toleration-keys=node.kubernetes.io/dedicated-to-flux
 
+  # Install Flux with the Kustomize patches from a directory applied to the components
+  flux install --patches-dir=./flux-patches
+
+  # Export an install bundle for air-gapped clusters, the images are listed in the bundle.json file
+  flux install --version=v0.41.0 --export-bundle=flux-bundle.tgz
+
+  # Install from a bundle with no network access, pulling the images from a private registry
+  flux install --bundle=flux-bundle.tgz --registry=registry.internal/fluxcd
+
+  # List the images of the components
+  flux install --list-images
+
   # Dry-run install
   flux install --export | kubectl apply --dry-run=client -f- 
 
@@ -72,6 +85,12 @@ type installFlags struct {
 	tokenAuth          bool
 	clusterDomain      string
 	tolerationKeys     []string
+	patchFiles         []string
+	patchesDir         string
+	exportBundle       string
+	bundle             string
+	listImages         bool
+	imageDigests       string
 }
 
 var installArgs = NewInstallFlags()
@@ -98,6 +117,18 @@ func init() {
 	installCmd.Flags().StringVar(&installArgs.clusterDomain, "cluster-domain", rootArgs.defaults.ClusterDomain, "internal cluster domain")
 	installCmd.Flags().StringSliceVar(&installArgs.tolerationKeys, "toleration-keys", nil,
 		"list of toleration keys used to schedule the components pods onto nodes with matching taints")
+	installCmd.Flags().StringSliceVar(&installArgs.patchFiles, "patch-file", nil,
+		"list of Kustomize patch files to apply to the components, accepts comma-separated values")
+	installCmd.Flags().StringVar(&installArgs.patchesDir, "patches-dir", "",
+		"path to a directory with Kustomize patch files to apply to the components")
+	installCmd.Flags().StringVar(&installArgs.exportBundle, "export-bundle", "",
+		"write an install bundle with the manifests and the images list of the version to the given file and exit")
+	installCmd.Flags().StringVar(&installArgs.bundle, "bundle", "",
+		"path to an install bundle created with --export-bundle, to install without network access")
+	installCmd.Flags().BoolVar(&installArgs.listImages, "list-images", false,
+		"print the images of the components and exit")
+	installCmd.Flags().StringVar(&installArgs.imageDigests, "image-digests", "",
+		"path to the JSON output of 'flux mirror --resolve-digests', to reference the images by digest instead of by tag")
 	installCmd.Flags().MarkHidden("manifests")
 
 	rootCmd.AddCommand(installCmd)
@@ -119,14 +150,11 @@ func installCmdRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if ver, err := getVersion(installArgs.version); err != nil {
-		return err
-	} else {
-		installArgs.version = ver
+	if installArgs.bundle != "" && installArgs.exportBundle != "" {
+		return fmt.Errorf("--bundle and --export-bundle are mutually exclusive")
 	}
-
-	if !installArgs.export {
-		logger.Generatef("generating manifests")
+	if installArgs.manifestsPath != "" && (installArgs.bundle != "" || installArgs.exportBundle != "") {
+		return fmt.Errorf("--manifests can't be used with --bundle or --export-bundle")
 	}
 
 	tmpDir, err := manifestgen.MkdirTempAbs("", *kubeconfigArgs.Namespace)
@@ -136,11 +164,27 @@ func installCmdRun(cmd *cobra.Command, args []string) error {
 	defer os.RemoveAll(tmpDir)
 
 	manifestsBase := ""
-	if isEmbeddedVersion(installArgs.version) {
-		if err := writeEmbeddedManifests(tmpDir); err != nil {
+	if installArgs.bundle != "" {
+		if installArgs.version, err = extractInstallBundle(installArgs.bundle, installArgs.version, components, tmpDir); err != nil {
 			return err
 		}
 		manifestsBase = tmpDir
+	} else {
+		if ver, err := getVersion(installArgs.version); err != nil {
+			return err
+		} else {
+			installArgs.version = ver
+		}
+		if isEmbeddedVersion(installArgs.version) {
+			if err := writeEmbeddedManifests(tmpDir); err != nil {
+				return err
+			}
+			manifestsBase = tmpDir
+		}
+	}
+
+	if !installArgs.export && !installArgs.listImages {
+		logger.Generatef("generating manifests")
 	}
 
 	opts := install.Options{
@@ -164,11 +208,44 @@ func installCmdRun(cmd *cobra.Command, args []string) error {
 		opts.BaseURL = install.MakeDefaultOptions().BaseURL
 	}
 
+	if installArgs.imageDigests != "" {
+		if opts.ImageDigests, err = loadImageDigests(installArgs.imageDigests); err != nil {
+			return err
+		}
+	}
+
+	if installArgs.exportBundle != "" {
+		return exportInstallBundle(installArgs.exportBundle, opts, manifestsBase)
+	}
+
 	manifest, err := install.Generate(opts, manifestsBase)
 	if err != nil {
 		return fmt.Errorf("install failed: %w", err)
 	}
 
+	patches, err := kustomization.LoadPatches(append(installArgs.patchFiles, installArgs.patchesDir)...)
+	if err != nil {
+		return fmt.Errorf("install failed: %w", err)
+	}
+	if len(patches) > 0 {
+		patched, err := kustomization.VerifyPatches(manifest.Content, patches)
+		if err != nil {
+			return fmt.Errorf("install failed: %w", err)
+		}
+		manifest.Content = fmt.Sprintf("%s\n%s", install.GetGenWarning(opts), string(patched))
+	}
+
+	if installArgs.listImages {
+		images, err := install.ListImages([]byte(manifest.Content))
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			rootCmd.Println(image)
+		}
+		return nil
+	}
+
 	if _, err := manifest.WriteFile(tmpDir); err != nil {
 		return fmt.Errorf("install failed: %w", err)
 	}
@@ -210,3 +287,47 @@ func installCmdRun(cmd *cobra.Command, args []string) error {
 	logger.Successf("install finished")
 	return nil
 }
+
+// exportInstallBundle writes the install bundle of the version in the
+// options to the file at bundlePath.
+func exportInstallBundle(bundlePath string, opts install.Options, manifestsBase string) error {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return fmt.Errorf("unable to create bundle: %w", err)
+	}
+	bundle, err := install.ExportBundle(opts, manifestsBase, f)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(bundlePath)
+		return fmt.Errorf("bundle export failed: %w", err)
+	}
+
+	for _, image := range bundle.Images {
+		logger.Actionf("bundled image %s", image)
+	}
+	logger.Successf("exported %s bundle with %d components to %s", bundle.Version, len(bundle.Components), bundlePath)
+	return nil
+}
+
+// extractInstallBundle extracts the install bundle at bundlePath to dir, and
+// returns the version of the bundle after checking it matches the requested
+// version, if any, and that the bundle contains all the components.
+func extractInstallBundle(bundlePath, version string, components []string, dir string) (string, error) {
+	bundle, err := install.ExtractBundle(bundlePath, dir)
+	if err != nil {
+		return "", err
+	}
+	if version != "" && version != bundle.Version {
+		return "", fmt.Errorf("targeted version '%s' does not match the bundle version '%s'", version, bundle.Version)
+	}
+	for _, component := range components {
+		if !utils.ContainsItemString(bundle.Components, component) {
+			return "", fmt.Errorf("component %s is not included in the bundle", component)
+		}
+	}
+	return bundle.Version, nil
+}
@@ -18,22 +18,34 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/fluxcd/flux2/internal/flags"
-	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 
 	oci "github.com/fluxcd/pkg/oci/client"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
 
+	"github.com/fluxcd/flux2/internal/artifact"
+	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/internal/utils"
 	"github.com/fluxcd/flux2/pkg/printers"
 )
 
 type listArtifactFlags struct {
-	semverFilter string
-	regexFilter  string
-	creds        string
-	provider     flags.SourceOCIProvider
+	semverFilter    string
+	regexFilter     string
+	creds           string
+	provider        flags.SourceOCIProvider
+	showAnnotations bool
+	showReferences  bool
+	contexts        []string
+	sortBy          string
+	output          string
 }
 
 var listArtifactArgs = newListArtifactFlags()
@@ -41,6 +53,7 @@ var listArtifactArgs = newListArtifactFlags()
 func newListArtifactFlags() listArtifactFlags {
 	return listArtifactFlags{
 		provider: flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+		sortBy:   "tag",
 	}
 }
 
@@ -48,9 +61,20 @@ var listArtifactsCmd = &cobra.Command{
 	Use:   "artifacts",
 	Short: "list artifacts",
 	Long: `The list command fetches the tags and their metadata from a remote OCI repository.
+For each artifact, the command prints its digest, creation date, size, source and revision, and whether it has a cosign signature.
+With --show-references, the command also prints the OCIRepositories of the repository referencing the artifacts in the clusters of the kubeconfig contexts of --contexts, the current context by default.
 The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.`,
 	Example: `  # List the artifacts stored in an OCI repository
   flux list artifact oci://ghcr.io/org/config/app
+
+  # List the artifacts with their custom annotations, the latest first
+  flux list artifact oci://ghcr.io/org/config/app --show-annotations --sort-by=created
+
+  # List the artifacts with the OCIRepositories referencing them in the staging and production clusters
+  flux list artifact oci://ghcr.io/org/config/app --show-references --contexts=staging,production
+
+  # Print the artifacts metadata in JSON format
+  flux list artifact oci://ghcr.io/org/config/app -o json
 `,
 	RunE: listArtifactsCmdRun,
 }
@@ -60,16 +84,57 @@ func init() {
 	listArtifactsCmd.Flags().StringVar(&listArtifactArgs.regexFilter, "filter-regex", "", "filter tags returned from the oci repository using regex")
 	listArtifactsCmd.Flags().StringVar(&listArtifactArgs.creds, "creds", "", "credentials for OCI registry in the format <username>[:<password>] if --provider is generic")
 	listArtifactsCmd.Flags().Var(&listArtifactArgs.provider, "provider", listArtifactArgs.provider.Description())
+	listArtifactsCmd.Flags().BoolVar(&listArtifactArgs.showAnnotations, "show-annotations", false,
+		"print the custom annotations of the artifacts")
+	listArtifactsCmd.Flags().BoolVar(&listArtifactArgs.showReferences, "show-references", false,
+		"print the OCIRepositories referencing the artifacts in the clusters of --contexts")
+	listArtifactsCmd.Flags().StringSliceVar(&listArtifactArgs.contexts, "contexts", nil,
+		"kubeconfig contexts of the clusters inspected with --show-references, defaults to the current context")
+	listArtifactsCmd.Flags().StringVar(&listArtifactArgs.sortBy, "sort-by", listArtifactArgs.sortBy,
+		"sort the artifacts by 'tag' or by 'created' date, in descending order")
+	listArtifactsCmd.Flags().StringVarP(&listArtifactArgs.output, "output", "o", "",
+		"the format in which the artifacts should be printed, can be 'json' or 'yaml'")
 
 	listCmd.AddCommand(listArtifactsCmd)
 }
 
+// listArtifactInfo is the metadata of an artifact printed with --output.
+type listArtifactInfo struct {
+	artifact.Tag
+	References []artifactReferenceInfo `json:"references,omitempty"`
+}
+
+// artifactReferenceInfo is an OCIRepository referencing an artifact.
+type artifactReferenceInfo struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (r artifactReferenceInfo) String() string {
+	return fmt.Sprintf("%s:%s/%s", r.Cluster, r.Namespace, r.Name)
+}
+
 func listArtifactsCmdRun(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("artifact repository URL is required")
 	}
 	ociURL := args[0]
 
+	switch listArtifactArgs.sortBy {
+	case "tag", "created":
+	default:
+		return fmt.Errorf("invalid --sort-by value '%s', must be 'tag' or 'created'", listArtifactArgs.sortBy)
+	}
+	switch listArtifactArgs.output {
+	case "", "json", "yaml":
+	default:
+		return fmt.Errorf("invalid output format '%s', must be 'json' or 'yaml'", listArtifactArgs.output)
+	}
+	if len(listArtifactArgs.contexts) > 0 && !listArtifactArgs.showReferences {
+		return fmt.Errorf("--contexts requires --show-references")
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
 
@@ -78,17 +143,21 @@ func listArtifactsCmdRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	ociClient := oci.NewLocalClient()
+	ociClient := artifact.NewClient()
 
 	if listArtifactArgs.provider.String() == sourcev1.GenericOCIProvider && listArtifactArgs.creds != "" {
-		logger.Actionf("logging in to registry with credentials")
+		if listArtifactArgs.output == "" {
+			logger.Actionf("logging in to registry with credentials")
+		}
 		if err := ociClient.LoginWithCredentials(listArtifactArgs.creds); err != nil {
 			return fmt.Errorf("could not login with credentials: %w", err)
 		}
 	}
 
 	if listArtifactArgs.provider.String() != sourcev1.GenericOCIProvider {
-		logger.Actionf("logging in to registry with provider credentials")
+		if listArtifactArgs.output == "" {
+			logger.Actionf("logging in to registry with provider credentials")
+		}
 		ociProvider, err := listArtifactArgs.provider.ToOCIProvider()
 		if err != nil {
 			return fmt.Errorf("provider not supported: %w", err)
@@ -104,20 +173,124 @@ func listArtifactsCmdRun(cmd *cobra.Command, args []string) error {
 		SemverFilter: listArtifactArgs.semverFilter,
 	}
 
-	metas, err := ociClient.List(ctx, url, opts)
+	tags, err := ociClient.List(ctx, url, opts)
 	if err != nil {
 		return err
 	}
+	if listArtifactArgs.sortBy == "created" {
+		artifact.SortByCreated(tags)
+	}
+
+	var references map[string][]artifactReferenceInfo
+	if listArtifactArgs.showReferences {
+		repository, err := oci.ParseRepositoryURL(ociURL)
+		if err != nil {
+			return err
+		}
+		references, err = clusterArtifactReferences(ctx, repository, listArtifactArgs.contexts)
+		if err != nil {
+			return err
+		}
+	}
+
+	infos := make([]listArtifactInfo, 0, len(tags))
+	for _, tag := range tags {
+		infos = append(infos, listArtifactInfo{Tag: tag, References: references[tag.Digest]})
+	}
 
+	switch listArtifactArgs.output {
+	case "json":
+		marshalled, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return fmt.Errorf("artifacts JSON conversion failed: %w", err)
+		}
+		marshalled = append(marshalled, "\n"...)
+		cmd.Print(string(marshalled))
+		return nil
+	case "yaml":
+		marshalled, err := yaml.Marshal(infos)
+		if err != nil {
+			return fmt.Errorf("artifacts YAML conversion failed: %w", err)
+		}
+		cmd.Print(string(marshalled))
+		return nil
+	}
+
+	header := []string{"artifact", "digest", "created", "size", "signed", "source", "revision"}
+	if listArtifactArgs.showReferences {
+		header = append(header, "references")
+	}
+	if listArtifactArgs.showAnnotations {
+		header = append(header, "annotations")
+	}
 	var rows [][]string
-	for _, meta := range metas {
-		rows = append(rows, []string{meta.URL, meta.Digest, meta.Source, meta.Revision})
+	for _, info := range infos {
+		row := []string{info.URL, info.Digest, info.Created, formatSize(info.Size), strconv.FormatBool(info.Signed),
+			info.Source, info.Revision}
+		if listArtifactArgs.showReferences {
+			var refs []string
+			for _, r := range info.References {
+				refs = append(refs, r.String())
+			}
+			row = append(row, strings.Join(refs, ", "))
+		}
+		if listArtifactArgs.showAnnotations {
+			annotations := info.CustomAnnotations()
+			keys := make([]string, 0, len(annotations))
+			for k := range annotations {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var pairs []string
+			for _, k := range keys {
+				pairs = append(pairs, fmt.Sprintf("%s=%s", k, annotations[k]))
+			}
+			row = append(row, strings.Join(pairs, ", "))
+		}
+		rows = append(rows, row)
 	}
 
-	err = printers.TablePrinter([]string{"artifact", "digest", "source", "revision"}).Print(cmd.OutOrStdout(), rows)
-	if err != nil {
-		return err
+	return printers.TablePrinter(header).Print(cmd.OutOrStdout(), rows)
+}
+
+// clusterArtifactReferences returns the OCIRepositories of the repository
+// referencing the artifacts by digest, in the clusters of the given
+// kubeconfig contexts or of the current context if none is given.
+func clusterArtifactReferences(ctx context.Context, repository string, kubeContexts []string) (map[string][]artifactReferenceInfo, error) {
+	if len(kubeContexts) == 0 {
+		current := *kubeconfigArgs.Context
+		if current == "" {
+			rawConfig, err := kubeconfigArgs.ToRawKubeConfigLoader().RawConfig()
+			if err != nil {
+				return nil, fmt.Errorf("unable to read the kubeconfig: %w", err)
+			}
+			current = rawConfig.CurrentContext
+		}
+		kubeContexts = []string{current}
 	}
 
-	return nil
+	result := map[string][]artifactReferenceInfo{}
+	for _, kubeContext := range kubeContexts {
+		kubeClient, err := utils.KubeClient(kubeconfigArgsForContext(kubeContext), kubeclientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to the cluster of context '%s': %w", kubeContext, err)
+		}
+		references, err := artifactReferences(ctx, kubeClient, repository)
+		if err != nil {
+			return nil, fmt.Errorf("context '%s': %w", kubeContext, err)
+		}
+		for digest, repos := range references {
+			for _, repo := range repos {
+				result[digest] = append(result[digest], artifactReferenceInfo{
+					Cluster:   kubeContext,
+					Namespace: repo.Namespace,
+					Name:      repo.Name,
+				})
+			}
+		}
+	}
+	for _, refs := range result {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	}
+	return result, nil
 }
@@ -0,0 +1,162 @@
+//go:build unit
+// +build unit
+
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestListArtifacts(t *testing.T) {
+	repo := fmt.Sprintf("%s/podinfo-list", dockerReg)
+	digests := map[string]string{}
+	for _, push := range []struct{ tag, epoch string }{{"a", "1675209600"}, {"b", "1672531200"}} {
+		t.Setenv("SOURCE_DATE_EPOCH", push.epoch)
+		output, err := executeCommand(fmt.Sprintf("push artifact oci://%s:%s --path=./testdata/diff-artifact/deployment.yaml --source=test --revision=%s --reproducible --annotations=org.opencontainers.image.licenses=Apache-2.0 -o json",
+			repo, push.tag, push.tag))
+		if err != nil {
+			t.Fatalf("push failed: %s", err)
+		}
+		var info struct {
+			Digest string `json:"digest"`
+		}
+		if err := json.Unmarshal([]byte(output), &info); err != nil {
+			t.Fatalf("invalid output %q: %s", output, err)
+		}
+		digests[push.tag] = info.Digest
+	}
+
+	namespace := allocateNamespace("list-artifacts")
+	setupTestNamespace(namespace, t)
+	objects, err := readYamlObjects(strings.NewReader(fmt.Sprintf(`---
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: podinfo
+  namespace: %s
+spec:
+  interval: 10m
+  url: oci://%s
+  ref:
+    digest: %s
+---
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: other
+  namespace: %s
+spec:
+  interval: 10m
+  url: oci://%s/other
+  ref:
+    digest: %s
+`, namespace, repo, digests["a"], namespace, dockerReg, digests["a"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testEnv.CreateObjects(objects, t); err != nil {
+		t.Fatal(err)
+	}
+
+	type listInfo struct {
+		Tag         string            `json:"tag"`
+		Created     string            `json:"created"`
+		Size        int64             `json:"size"`
+		Signed      bool              `json:"signed"`
+		Annotations map[string]string `json:"annotations"`
+		References  []struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"references"`
+	}
+	list := func(args string) []listInfo {
+		t.Helper()
+		output, err := executeCommand(fmt.Sprintf("list artifacts oci://%s -o json %s", repo, args))
+		if err != nil {
+			t.Fatalf("list failed: %s", err)
+		}
+		var infos []listInfo
+		if err := json.Unmarshal([]byte(output), &infos); err != nil {
+			t.Fatalf("invalid output %q: %s", output, err)
+		}
+		return infos
+	}
+
+	infos := list("")
+	if len(infos) != 2 || infos[0].Tag != "b" || infos[1].Tag != "a" {
+		t.Fatalf("expected the artifacts sorted by tag, got %+v", infos)
+	}
+	for _, info := range infos {
+		if info.Size == 0 || info.Signed || info.Annotations["org.opencontainers.image.licenses"] != "Apache-2.0" || len(info.References) != 0 {
+			t.Errorf("unexpected artifact %+v", info)
+		}
+	}
+
+	infos = list("--sort-by=created --show-references")
+	if len(infos) != 2 || infos[0].Tag != "a" || infos[0].Created != "2023-02-01T00:00:00Z" {
+		t.Fatalf("expected the artifacts sorted by creation date, got %+v", infos)
+	}
+	if refs := infos[0].References; len(refs) != 1 || refs[0].Namespace != namespace || refs[0].Name != "podinfo" {
+		t.Errorf("expected the artifact to be referenced only by %s/podinfo, got %+v", namespace, refs)
+	}
+
+	tests := []struct {
+		name   string
+		args   string
+		assert assertFunc
+	}{
+		{
+			name: "table with annotations",
+			args: fmt.Sprintf("list artifacts oci://%s --show-annotations", repo),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				for _, want := range []string{"SIGNED", "ANNOTATIONS", "org.opencontainers.image.licenses=Apache-2.0", "2023-01-01T00:00:00Z"} {
+					if !strings.Contains(output, want) {
+						return fmt.Errorf("expected the output to contain %q, got:\n%s", want, output)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:   "invalid sort",
+			args:   fmt.Sprintf("list artifacts oci://%s --sort-by=size", repo),
+			assert: assertError("invalid --sort-by value 'size', must be 'tag' or 'created'"),
+		},
+		{
+			name:   "contexts without references",
+			args:   fmt.Sprintf("list artifacts oci://%s --contexts=prod", repo),
+			assert: assertError("--contexts requires --show-references"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assert,
+			}
+			cmd.runTestCmd(t)
+		})
+	}
+}
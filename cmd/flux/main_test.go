@@ -394,7 +394,9 @@ func resetCmdArgs() {
 	bServerArgs = bServerFlags{}
 	buildKsArgs = buildKsFlags{}
 	checkArgs = checkFlags{}
+	copyArtifactArgs = newCopyArtifactFlags()
 	createArgs = createFlags{}
+	deploymentOCIArgs = newDeploymentOCIFlags()
 	deleteArgs = deleteFlags{}
 	diffKsArgs = diffKsFlags{}
 	exportArgs = exportFlags{}
@@ -406,9 +408,15 @@ func resetCmdArgs() {
 		reconcileStrategy: "ChartVersion",
 	}
 	imagePolicyArgs = imagePolicyFlags{}
+	imagePolicyPreviewArgs = newImagePolicyPreviewFlags()
+	imageUpdateLocalArgs = newImageUpdateLocalFlags()
 	imageRepoArgs = imageRepoFlags{}
 	imageUpdateArgs = imageUpdateFlags{}
 	kustomizationArgs = NewKustomizationFlags()
+	pushArtifactArgs = newPushArtifactFlags()
+	pullArtifactArgs = newPullArtifactFlags()
+	listArtifactArgs = newListArtifactFlags()
+	pruneArtifactsArgs = newPruneArtifactsFlags()
 	receiverArgs = receiverFlags{}
 	resumeArgs = ResumeFlags{}
 	rhrArgs = reconcileHelmReleaseFlags{}
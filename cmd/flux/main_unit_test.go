@@ -46,9 +46,16 @@ func TestMain(m *testing.M) {
 	// rootArgs.kubeconfig = testEnv.kubeConfigPath
 	kubeconfigArgs.KubeConfig = &testEnv.kubeConfigPath
 
+	// The registry is shared by the artifact tests
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := setupRegistryServer(ctx); err != nil {
+		panic(fmt.Errorf("error starting docker registry: '%w'", err))
+	}
+
 	// Run tests
 	code := m.Run()
 
+	cancel()
 	km.Stop()
 
 	os.Exit(code)
@@ -0,0 +1,266 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Plan the mirroring of the Flux images to a private registry",
+	Long: `The mirror command prints the source and destination references of the images
+of the Flux components, for mirroring them to a private registry with tools like skopeo or crane.
+The destination references match the images of 'flux install --registry'.`,
+	Example: `  # Print the mirroring plan of the default components as JSON
+  flux mirror --registry=harbor.example.com/fluxcd
+
+  # Mirror the images of a specific version with skopeo
+  flux mirror --version=v0.41.0 --registry=harbor.example.com/fluxcd -o skopeo > sync.yaml
+  skopeo sync --all --src yaml --dest docker sync.yaml harbor.example.com/fluxcd
+
+  # Mirror the images with crane
+  flux mirror --registry=harbor.example.com/fluxcd -o crane | sh
+
+  # Pin the digests of the mirrored images in the install manifests
+  flux mirror --registry=harbor.example.com/fluxcd --resolve-digests > plan.json
+  flux install --registry=harbor.example.com/fluxcd --image-digests=plan.json
+
+  # Plan the mirroring of the images of an install bundle
+  flux mirror --bundle=flux-bundle.tgz --registry=harbor.example.com/fluxcd`,
+	RunE: mirrorCmdRun,
+}
+
+type mirrorFlags struct {
+	version        string
+	defaultComps   []string
+	extraComps     []string
+	sourceRegistry string
+	registry       string
+	bundle         string
+	output         string
+	resolveDigests bool
+}
+
+var mirrorArgs mirrorFlags
+
+func init() {
+	mirrorCmd.Flags().StringVarP(&mirrorArgs.version, "version", "v", "",
+		"toolkit version, when specified the manifests are downloaded from https://github.com/fluxcd/flux2/releases")
+	mirrorCmd.Flags().StringSliceVar(&mirrorArgs.defaultComps, "components", rootArgs.defaults.Components,
+		"list of components, accepts comma-separated values")
+	mirrorCmd.Flags().StringSliceVar(&mirrorArgs.extraComps, "components-extra", nil,
+		"list of components in addition to those supplied or defaulted, accepts values such as 'image-reflector-controller,image-automation-controller'")
+	mirrorCmd.Flags().StringVar(&mirrorArgs.sourceRegistry, "source-registry", rootArgs.defaults.Registry,
+		"container registry where the toolkit images are published")
+	mirrorCmd.Flags().StringVar(&mirrorArgs.registry, "registry", "",
+		"container registry the toolkit images are mirrored to")
+	mirrorCmd.Flags().StringVar(&mirrorArgs.bundle, "bundle", "",
+		"path to an install bundle created with 'flux install --export-bundle'")
+	mirrorCmd.Flags().StringVarP(&mirrorArgs.output, "output", "o", "json",
+		"the format of the mirroring plan, can be 'json', 'skopeo' (a skopeo sync YAML file) or 'crane' (a list of crane copy commands)")
+	mirrorCmd.Flags().BoolVar(&mirrorArgs.resolveDigests, "resolve-digests", false,
+		"look up the digests of the source images and add them to the plan")
+
+	rootCmd.AddCommand(mirrorCmd)
+}
+
+// mirrorImage is the mirroring of the image of a component.
+type mirrorImage struct {
+	Component   string `json:"component"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Digest      string `json:"digest,omitempty"`
+}
+
+func mirrorCmdRun(cmd *cobra.Command, args []string) error {
+	if mirrorArgs.registry == "" {
+		return fmt.Errorf("--registry is required")
+	}
+	switch mirrorArgs.output {
+	case "json", "skopeo", "crane":
+	default:
+		return fmt.Errorf("--output must be json, skopeo or crane, not %s", mirrorArgs.output)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	components := append(mirrorArgs.defaultComps, mirrorArgs.extraComps...)
+	if err := utils.ValidateComponents(components); err != nil {
+		return err
+	}
+
+	tmpDir, err := manifestgen.MkdirTempAbs("", "flux-mirror-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifestsBase := ""
+	if mirrorArgs.bundle != "" {
+		if mirrorArgs.version, err = extractInstallBundle(mirrorArgs.bundle, mirrorArgs.version, components, tmpDir); err != nil {
+			return err
+		}
+		manifestsBase = tmpDir
+	} else {
+		if mirrorArgs.version, err = getVersion(mirrorArgs.version); err != nil {
+			return err
+		}
+		if isEmbeddedVersion(mirrorArgs.version) {
+			if err := writeEmbeddedManifests(tmpDir); err != nil {
+				return err
+			}
+			manifestsBase = tmpDir
+		}
+	}
+
+	opts := install.MakeDefaultOptions()
+	opts.Version = mirrorArgs.version
+	opts.Components = components
+	opts.Registry = mirrorArgs.sourceRegistry
+	opts.Timeout = rootArgs.timeout
+	manifest, err := install.Generate(opts, manifestsBase)
+	if err != nil {
+		return fmt.Errorf("manifests generation failed: %w", err)
+	}
+	images, err := install.ListImages([]byte(manifest.Content))
+	if err != nil {
+		return err
+	}
+
+	plan, err := planMirror(images, mirrorArgs.registry)
+	if err != nil {
+		return err
+	}
+	if mirrorArgs.resolveDigests {
+		for i := range plan {
+			digest, err := crane.Digest(plan[i].Source, crane.WithContext(ctx))
+			if err != nil {
+				return fmt.Errorf("failed to resolve the digest of %s: %w", plan[i].Source, err)
+			}
+			plan[i].Digest = digest
+		}
+	}
+
+	return printMirrorPlan(cmd.OutOrStdout(), plan, mirrorArgs.output)
+}
+
+// planMirror returns the mirroring of the images to the registry, with the
+// destination repositories named after the components, like the images of
+// the install manifests generated for the registry.
+func planMirror(images []string, registry string) ([]mirrorImage, error) {
+	registry = strings.TrimSuffix(registry, "/")
+	var plan []mirrorImage
+	for _, image := range images {
+		ref, err := name.NewTag(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %s: %w", image, err)
+		}
+		component := path.Base(ref.RepositoryStr())
+		plan = append(plan, mirrorImage{
+			Component:   component,
+			Source:      ref.Name(),
+			Destination: fmt.Sprintf("%s/%s:%s", registry, component, ref.TagStr()),
+		})
+	}
+	return plan, nil
+}
+
+func printMirrorPlan(w io.Writer, plan []mirrorImage, format string) error {
+	switch format {
+	case "skopeo":
+		// skopeo sync copies the images of the repositories listed under
+		// each registry, to the destination with the repository base name.
+		type images struct {
+			Images map[string][]string `json:"images"`
+		}
+		sync := map[string]images{}
+		for _, m := range plan {
+			ref, err := name.NewTag(m.Source)
+			if err != nil {
+				return err
+			}
+			host := ref.RegistryStr()
+			if _, ok := sync[host]; !ok {
+				sync[host] = images{Images: map[string][]string{}}
+			}
+			sync[host].Images[ref.RepositoryStr()] = append(sync[host].Images[ref.RepositoryStr()], ref.TagStr())
+		}
+		data, err := yaml.Marshal(sync)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "crane":
+		lines := make([]string, 0, len(plan))
+		for _, m := range plan {
+			lines = append(lines, fmt.Sprintf("crane copy %s %s", m.Source, m.Destination))
+		}
+		sort.Strings(lines)
+		_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+		return err
+	default:
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+}
+
+// loadImageDigests returns the digests of the components images from the
+// JSON mirroring plan file.
+func loadImageDigests(planPath string) (map[string]string, error) {
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image digests: %w", err)
+	}
+	var plan []mirrorImage
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("unable to parse image digests, expected the JSON output of 'flux mirror --resolve-digests': %w", err)
+	}
+	digests := map[string]string{}
+	for _, m := range plan {
+		if m.Digest == "" {
+			return nil, fmt.Errorf("missing digest for component %s in %s", m.Component, planPath)
+		}
+		if !strings.HasPrefix(m.Digest, "sha256:") {
+			return nil, fmt.Errorf("invalid digest %q for component %s", m.Digest, m.Component)
+		}
+		digests[m.Component] = m.Digest
+	}
+	return digests, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanMirror(t *testing.T) {
+	images := []string{
+		"ghcr.io/fluxcd/kustomize-controller:v0.35.1",
+		"ghcr.io/fluxcd/source-controller:v0.36.1",
+	}
+	plan, err := planMirror(images, "harbor.example.com/fluxcd/")
+	if err != nil {
+		t.Fatalf("planMirror() error = %v", err)
+	}
+	want := []mirrorImage{
+		{
+			Component:   "kustomize-controller",
+			Source:      "ghcr.io/fluxcd/kustomize-controller:v0.35.1",
+			Destination: "harbor.example.com/fluxcd/kustomize-controller:v0.35.1",
+		},
+		{
+			Component:   "source-controller",
+			Source:      "ghcr.io/fluxcd/source-controller:v0.36.1",
+			Destination: "harbor.example.com/fluxcd/source-controller:v0.36.1",
+		},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("plan %+v != %+v", plan, want)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "skopeo",
+			want: `ghcr.io:
+  images:
+    fluxcd/kustomize-controller:
+    - v0.35.1
+    fluxcd/source-controller:
+    - v0.36.1
+`,
+		},
+		{
+			format: "crane",
+			want: `crane copy ghcr.io/fluxcd/kustomize-controller:v0.35.1 harbor.example.com/fluxcd/kustomize-controller:v0.35.1
+crane copy ghcr.io/fluxcd/source-controller:v0.36.1 harbor.example.com/fluxcd/source-controller:v0.36.1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := printMirrorPlan(&buf, plan, tt.format); err != nil {
+				t.Fatalf("printMirrorPlan() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadImageDigests(t *testing.T) {
+	plan := []mirrorImage{{
+		Component:   "source-controller",
+		Source:      "ghcr.io/fluxcd/source-controller:v0.36.1",
+		Destination: "harbor.example.com/fluxcd/source-controller:v0.36.1",
+		Digest:      "sha256:ef3ef3a2dd4e3b1fe1ab1a2eaf8ed5b4d3b0c8d7ab3b2cc3a5bb2fd68c4bd9f2",
+	}}
+	var buf bytes.Buffer
+	if err := printMirrorPlan(&buf, plan, "json"); err != nil {
+		t.Fatal(err)
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	digests, err := loadImageDigests(planPath)
+	if err != nil {
+		t.Fatalf("loadImageDigests() error = %v", err)
+	}
+	if want := map[string]string{"source-controller": plan[0].Digest}; !reflect.DeepEqual(digests, want) {
+		t.Errorf("digests %v != %v", digests, want)
+	}
+
+	plan[0].Digest = ""
+	buf.Reset()
+	if err := printMirrorPlan(&buf, plan, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(planPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadImageDigests(planPath); err == nil {
+		t.Errorf("expected error for plan without digests")
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	oci "github.com/fluxcd/pkg/oci/client"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/artifact"
+	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/printers"
+)
+
+var pruneArtifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Prune artifacts",
+	Long: `The prune artifacts command deletes the artifacts of an OCI repository that are not kept by any of the retention rules.
+The command runs in dry-run mode by default, use --dry-run=false to delete the artifacts.
+An artifact is never deleted while its digest is referenced by an OCIRepository in the current cluster. As deleting an artifact deletes all its tags, an artifact is kept if any of its tags is kept.
+The --filter-semver and --filter-regex flags select the tags the retention rules apply to, the other tags are kept, and so are the artifacts they share a digest with.
+The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.`,
+	Example: `  # List the artifacts that would be deleted when keeping the last 10 artifacts
+  flux prune artifacts oci://ghcr.io/org/config/app --keep-last=10
+
+  # Delete the artifacts older than 30 days except the latest patch of each minor version
+  flux prune artifacts oci://ghcr.io/org/config/app \
+	--older-than=720h \
+	--keep-semver-latest-per-minor \
+	--dry-run=false
+
+  # Prune only the tags of the main branch and never the release candidates
+  flux prune artifacts oci://ghcr.io/org/config/app \
+	--filter-regex="^main-" \
+	--protect-regex="-rc\\." \
+	--keep-last=5 \
+	--dry-run=false
+`,
+	RunE: pruneArtifactsCmdRun,
+}
+
+type pruneArtifactsFlags struct {
+	keepLast                 int
+	keepSemverLatestPerMinor bool
+	olderThan                time.Duration
+	protectRegex             []string
+	semverFilter             string
+	regexFilter              string
+	dryRun                   bool
+	creds                    string
+	provider                 flags.SourceOCIProvider
+}
+
+var pruneArtifactsArgs = newPruneArtifactsFlags()
+
+func newPruneArtifactsFlags() pruneArtifactsFlags {
+	return pruneArtifactsFlags{
+		dryRun:   true,
+		provider: flags.SourceOCIProvider(sourcev1.GenericOCIProvider),
+	}
+}
+
+func init() {
+	pruneArtifactsCmd.Flags().IntVar(&pruneArtifactsArgs.keepLast, "keep-last", 0, "keep the given number of most recent artifacts")
+	pruneArtifactsCmd.Flags().BoolVar(&pruneArtifactsArgs.keepSemverLatestPerMinor, "keep-semver-latest-per-minor", false,
+		"keep the artifact of the highest semver tag of each major.minor version")
+	pruneArtifactsCmd.Flags().DurationVar(&pruneArtifactsArgs.olderThan, "older-than", 0,
+		"keep the artifacts created less than the given duration ago, the artifacts without a creation date are kept")
+	pruneArtifactsCmd.Flags().StringSliceVar(&pruneArtifactsArgs.protectRegex, "protect-regex", nil, "keep the tags matching any of the regular expressions")
+	pruneArtifactsCmd.Flags().StringVar(&pruneArtifactsArgs.semverFilter, "filter-semver", "", "prune only the tags matching the semver range")
+	pruneArtifactsCmd.Flags().StringVar(&pruneArtifactsArgs.regexFilter, "filter-regex", "", "prune only the tags matching the regex")
+	pruneArtifactsCmd.Flags().BoolVar(&pruneArtifactsArgs.dryRun, "dry-run", true, "print the artifacts that would be deleted without deleting them")
+	pruneArtifactsCmd.Flags().StringVar(&pruneArtifactsArgs.creds, "creds", "", "credentials for OCI registry in the format <username>[:<password>] if --provider is generic")
+	pruneArtifactsCmd.Flags().Var(&pruneArtifactsArgs.provider, "provider", pruneArtifactsArgs.provider.Description())
+
+	pruneCmd.AddCommand(pruneArtifactsCmd)
+}
+
+func pruneArtifactsCmdRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("artifact repository URL is required")
+	}
+	ociURL := args[0]
+
+	url, err := oci.ParseArtifactURL(ociURL)
+	if err != nil {
+		return err
+	}
+
+	policy := artifact.RetentionPolicy{
+		KeepLast:                 pruneArtifactsArgs.keepLast,
+		KeepSemverLatestPerMinor: pruneArtifactsArgs.keepSemverLatestPerMinor,
+		OlderThan:                pruneArtifactsArgs.olderThan,
+	}
+	for _, expr := range pruneArtifactsArgs.protectRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid --protect-regex '%s': %w", expr, err)
+		}
+		policy.Protect = append(policy.Protect, re)
+	}
+	if policy.Empty() {
+		return fmt.Errorf("at least one of --keep-last, --keep-semver-latest-per-minor, --older-than or --protect-regex is required")
+	}
+	policy.Filter, err = artifact.NewTagFilter(oci.ListOptions{
+		RegexFilter:  pruneArtifactsArgs.regexFilter,
+		SemverFilter: pruneArtifactsArgs.semverFilter,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+	referenced, err := referencedArtifactDigests(ctx, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	ociClient := artifact.NewClient()
+
+	if pruneArtifactsArgs.provider.String() == sourcev1.GenericOCIProvider && pruneArtifactsArgs.creds != "" {
+		logger.Actionf("logging in to registry with credentials")
+		if err := ociClient.LoginWithCredentials(pruneArtifactsArgs.creds); err != nil {
+			return fmt.Errorf("could not login with credentials: %w", err)
+		}
+	}
+
+	if pruneArtifactsArgs.provider.String() != sourcev1.GenericOCIProvider {
+		logger.Actionf("logging in to registry with provider credentials")
+		ociProvider, err := pruneArtifactsArgs.provider.ToOCIProvider()
+		if err != nil {
+			return fmt.Errorf("provider not supported: %w", err)
+		}
+
+		if err := ociClient.LoginWithProvider(ctx, url, ociProvider); err != nil {
+			return fmt.Errorf("error during login with provider: %w", err)
+		}
+	}
+
+	// all the tags are listed, as the artifact of a digest is deleted
+	// with all its tags, including the ones not selected by the filters
+	tags, err := ociClient.List(ctx, url, oci.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	decisions := policy.Decide(tags, referenced, time.Now())
+
+	var rows [][]string
+	var digests []string
+	pruned := map[string]bool{}
+	for _, d := range decisions {
+		if !policy.Selected(d.Name) {
+			continue
+		}
+		action := "keep: " + d.Reason
+		if d.Prune {
+			action = "prune"
+			if !pruned[d.Digest] {
+				pruned[d.Digest] = true
+				digests = append(digests, d.Digest)
+			}
+		}
+		rows = append(rows, []string{d.URL, d.Digest, d.Created, action})
+	}
+	if err := printers.TablePrinter([]string{"artifact", "digest", "created", "action"}).Print(cmd.OutOrStdout(), rows); err != nil {
+		return err
+	}
+
+	if pruneArtifactsArgs.dryRun {
+		logger.Successf("%d artifacts would be pruned, use --dry-run=false to delete them", len(digests))
+		return nil
+	}
+
+	for _, digest := range digests {
+		digestURL := fmt.Sprintf("%s@%s", url, digest)
+		logger.Actionf("deleting %s", digestURL)
+		if err := ociClient.Delete(ctx, digestURL); err != nil {
+			return err
+		}
+	}
+	logger.Successf("%d artifacts pruned", len(digests))
+	return nil
+}
+
+// referencedArtifactDigests returns the digests of the artifacts referenced
+// by the OCIRepositories in all namespaces, from the status and the spec.
+func referencedArtifactDigests(ctx context.Context, kubeClient client.Client) (map[string]bool, error) {
+	references, err := artifactReferences(ctx, kubeClient, "")
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(references))
+	for digest := range references {
+		referenced[digest] = true
+	}
+	return referenced, nil
+}
+
+// artifactReferences returns the OCIRepositories in all namespaces by the
+// digest of the artifact they reference from their status or their spec.
+// If repository is not empty, only the OCIRepositories with a spec.url of
+// that repository are returned.
+func artifactReferences(ctx context.Context, kubeClient client.Client, repository string) (map[string][]types.NamespacedName, error) {
+	references := map[string][]types.NamespacedName{}
+	var list sourcev1.OCIRepositoryList
+	if err := kubeClient.List(ctx, &list); err != nil {
+		if meta.IsNoMatchError(err) {
+			return references, nil
+		}
+		return nil, fmt.Errorf("unable to list the OCIRepositories: %w", err)
+	}
+	for _, repo := range list.Items {
+		if repository != "" {
+			if url, err := oci.ParseRepositoryURL(repo.Spec.URL); err != nil || url != repository {
+				continue
+			}
+		}
+		key := types.NamespacedName{Namespace: repo.Namespace, Name: repo.Name}
+		digests := map[string]bool{}
+		if repo.Spec.Reference != nil && repo.Spec.Reference.Digest != "" {
+			digests[repo.Spec.Reference.Digest] = true
+		}
+		if repo.Status.Artifact != nil {
+			revision := sourcev1.TransformLegacyRevision(repo.Status.Artifact.Revision)
+			digests[revision[strings.LastIndex(revision, "@")+1:]] = true
+		}
+		for digest := range digests {
+			references[digest] = append(references[digest], key)
+		}
+	}
+	return references, nil
+}
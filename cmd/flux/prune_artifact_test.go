@@ -0,0 +1,162 @@
+//go:build unit
+// +build unit
+
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPruneArtifacts(t *testing.T) {
+	repo := fmt.Sprintf("%s/podinfo-prune", dockerReg)
+	digests := map[string]string{}
+	for _, tag := range []string{"v1.0.0", "v1.0.1", "v1.1.0"} {
+		output, err := executeCommand(fmt.Sprintf("push artifact oci://%s:%s --path=./testdata/diff-artifact/deployment.yaml --source=test --revision=%s -o json",
+			repo, tag, tag))
+		if err != nil {
+			t.Fatalf("push failed: %s", err)
+		}
+		var info struct {
+			Digest string `json:"digest"`
+		}
+		if err := json.Unmarshal([]byte(output), &info); err != nil {
+			t.Fatalf("invalid output %q: %s", output, err)
+		}
+		digests[tag] = info.Digest
+	}
+	if _, err := executeCommand(fmt.Sprintf("tag artifact oci://%s:v1.0.1 --tag=stable", repo)); err != nil {
+		t.Fatalf("tag failed: %s", err)
+	}
+
+	namespace := allocateNamespace("prune-artifacts")
+	setupTestNamespace(namespace, t)
+	objects, err := readYamlObjects(strings.NewReader(fmt.Sprintf(`---
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: podinfo
+  namespace: %s
+spec:
+  interval: 10m
+  url: oci://%s
+status:
+  artifact:
+    path: ocirepository/podinfo.tar.gz
+    url: http://source-controller/ocirepository/podinfo.tar.gz
+    revision: v1.0.0@%s
+    lastUpdateTime: "2023-01-01T00:00:00Z"
+`, namespace, repo, digests["v1.0.0"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testEnv.CreateObjects(objects, t); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   string
+		assert assertFunc
+	}{
+		{
+			name:   "no retention rule",
+			args:   fmt.Sprintf("prune artifacts oci://%s", repo),
+			assert: assertError("at least one of --keep-last, --keep-semver-latest-per-minor, --older-than or --protect-regex is required"),
+		},
+		{
+			name: "dry-run",
+			args: fmt.Sprintf("prune artifacts oci://%s --keep-last=1", repo),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, "keep: referenced by an OCIRepository") {
+					return fmt.Errorf("expected v1.0.0 to be kept, got:\n%s", output)
+				}
+				return nil
+			},
+		},
+		{
+			name: "filter keeps the digests of the other tags",
+			args: fmt.Sprintf("prune artifacts oci://%s --filter-regex=^v --keep-last=1 --dry-run=false", repo),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, "keep: same digest as stable") {
+					return fmt.Errorf("expected v1.0.1 to be kept, got:\n%s", output)
+				}
+				if strings.Contains(output, repo+":stable") {
+					return fmt.Errorf("expected the tags not selected by the filter to be hidden, got:\n%s", output)
+				}
+				return nil
+			},
+		},
+		{
+			name: "list after filtered prune",
+			args: fmt.Sprintf("list artifacts oci://%s", repo),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				for _, tag := range []string{"v1.0.0", "v1.0.1", "v1.1.0"} {
+					if !strings.Contains(output, digests[tag]) {
+						return fmt.Errorf("expected %s to be kept, got:\n%s", tag, output)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:   "prune",
+			args:   fmt.Sprintf("prune artifacts oci://%s --keep-last=1 --dry-run=false", repo),
+			assert: assertSuccess(),
+		},
+		{
+			name: "list after prune",
+			args: fmt.Sprintf("list artifacts oci://%s", repo),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if strings.Contains(output, digests["v1.0.1"]) {
+					return fmt.Errorf("expected v1.0.1 to be pruned, got:\n%s", output)
+				}
+				for _, tag := range []string{"v1.0.0", "v1.1.0"} {
+					if !strings.Contains(output, digests[tag]) {
+						return fmt.Errorf("expected %s to be kept, got:\n%s", tag, output)
+					}
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assert,
+			}
+			cmd.runTestCmd(t)
+		})
+	}
+}
@@ -17,13 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/fluxcd/flux2/internal/artifact"
 	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/pkg/printers"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/cli-utils/pkg/object"
 
 	oci "github.com/fluxcd/pkg/oci/client"
 )
@@ -32,17 +42,48 @@ var pullArtifactCmd = &cobra.Command{
 	Use:   "artifact",
 	Short: "Pull artifact",
 	Long: `The pull artifact command downloads and extracts the OCI artifact content to the given path.
-The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.`,
+The content is streamed from the registry and extracted file by file to a temporary directory, then moved to the given path once the digest of the content is verified.
+With --path only the given file or directory of the artifact is extracted.
+The command refuses to extract the content to a non-empty directory unless --force is set, the existing files are then overwritten.
+With --to-stdout, the YAML files of the artifact are written to stdout as a multi-document YAML stream instead, to be piped to kubectl or kustomize,
+the stream is spooled to a temporary file and written once the digest of the content is verified.
+With --digest, the command fails if the artifact doesn't have the given digest.
+The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.
+With --verify, the cosign signature of the artifact is verified with the public key of --verify-key before extracting the content.
+With --show-attestations, the SBOM and the provenance attestations attached with 'flux push artifact --attest' are displayed,
+and the attestations are verified with the public key of --verify-key if set, an unsigned attestation fails the verification.`,
 	Example: `  # Pull an OCI artifact created by flux from GHCR
   flux pull artifact oci://ghcr.io/org/manifests/app:v0.0.1 --output ./path/to/local/manifests
+
+  # Pull a directory of an OCI artifact at an exact digest
+  flux pull artifact oci://ghcr.io/org/manifests/app:v0.0.1 --output ./path/to/local/manifests \
+	--path=./deploy/production --digest=sha256:0ab4cc9d1f0c4d8a8a9d5f3ea08b5f5f2a0e4e7c3bd1ff4a7f6f0a1e9b2c3d4e
+
+  # Apply the manifests of an OCI artifact without writing them to disk
+  flux pull artifact oci://ghcr.io/org/manifests/app:v0.0.1 --to-stdout | kubectl apply -f -
+
+  # Pull an OCI artifact after verifying its signature with a cosign public key
+  flux pull artifact oci://ghcr.io/org/manifests/app:v0.0.1 --output ./path/to/local/manifests \
+	--verify --verify-key=cosign.pub
+
+  # Pull an OCI artifact and display its SBOM and provenance attestation
+  flux pull artifact oci://ghcr.io/org/manifests/app:v0.0.1 --output ./path/to/local/manifests \
+	--show-attestations
 `,
 	RunE: pullArtifactCmdRun,
 }
 
 type pullArtifactFlags struct {
-	output   string
-	creds    string
-	provider flags.SourceOCIProvider
+	output           string
+	creds            string
+	provider         flags.SourceOCIProvider
+	verify           bool
+	verifyKey        string
+	showAttestations bool
+	path             string
+	digest           string
+	toStdout         bool
+	force            bool
 }
 
 var pullArtifactArgs = newPullArtifactFlags()
@@ -57,6 +98,19 @@ func init() {
 	pullArtifactCmd.Flags().StringVarP(&pullArtifactArgs.output, "output", "o", "", "path where the artifact content should be extracted.")
 	pullArtifactCmd.Flags().StringVar(&pullArtifactArgs.creds, "creds", "", "credentials for OCI registry in the format <username>[:<password>] if --provider is generic")
 	pullArtifactCmd.Flags().Var(&pullArtifactArgs.provider, "provider", sourceOCIRepositoryArgs.provider.Description())
+	pullArtifactCmd.Flags().BoolVar(&pullArtifactArgs.verify, "verify", false,
+		"verify the cosign signature of the artifact with the public key of --verify-key before extracting the content")
+	pullArtifactCmd.Flags().StringVar(&pullArtifactArgs.verifyKey, "verify-key", "", "path to the cosign public key")
+	pullArtifactCmd.Flags().BoolVar(&pullArtifactArgs.showAttestations, "show-attestations", false,
+		"display the SBOM and the provenance attestations attached to the artifact")
+	pullArtifactCmd.Flags().StringVar(&pullArtifactArgs.path, "path", "",
+		"path of the file or directory of the artifact to extract, relative to the root of the artifact")
+	pullArtifactCmd.Flags().StringVar(&pullArtifactArgs.digest, "digest", "",
+		"digest the artifact must have, in the format 'sha256:<hex>'")
+	pullArtifactCmd.Flags().BoolVar(&pullArtifactArgs.toStdout, "to-stdout", false,
+		"write the YAML files of the artifact to stdout instead of extracting the content to --output")
+	pullArtifactCmd.Flags().BoolVar(&pullArtifactArgs.force, "force", false,
+		"extract the content to --output even if the directory is not empty, overwriting the existing files")
 	pullCmd.AddCommand(pullArtifactCmd)
 }
 
@@ -66,12 +120,24 @@ func pullArtifactCmdRun(cmd *cobra.Command, args []string) error {
 	}
 	ociURL := args[0]
 
-	if pullArtifactArgs.output == "" {
+	switch {
+	case pullArtifactArgs.toStdout && pullArtifactArgs.output != "":
+		return fmt.Errorf("--output and --to-stdout are mutually exclusive")
+	case pullArtifactArgs.toStdout && pullArtifactArgs.showAttestations:
+		return fmt.Errorf("--show-attestations can't be used with --to-stdout")
+	case pullArtifactArgs.toStdout:
+	case pullArtifactArgs.output == "":
 		return fmt.Errorf("invalid output path %s", pullArtifactArgs.output)
+	default:
+		if err := checkPullOutput(pullArtifactArgs.output, pullArtifactArgs.force); err != nil {
+			return err
+		}
 	}
 
-	if fs, err := os.Stat(pullArtifactArgs.output); err != nil || !fs.IsDir() {
-		return fmt.Errorf("invalid output path %s", pullArtifactArgs.output)
+	if pullArtifactArgs.digest != "" {
+		if _, err := gcrv1.NewHash(pullArtifactArgs.digest); err != nil {
+			return fmt.Errorf("invalid digest '%s': %w", pullArtifactArgs.digest, err)
+		}
 	}
 
 	url, err := oci.ParseArtifactURL(ociURL)
@@ -79,10 +145,15 @@ func pullArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	verifyKey, err := loadVerifyKey(pullArtifactArgs.verify, pullArtifactArgs.verifyKey)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
 
-	ociClient := oci.NewLocalClient()
+	ociClient := artifact.NewClient()
 
 	if pullArtifactArgs.provider.String() == sourcev1.GenericOCIProvider && pullArtifactArgs.creds != "" {
 		logger.Actionf("logging in to registry with credentials")
@@ -103,9 +174,31 @@ func pullArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if verifyKey != nil {
+		if url, err = verifyArtifact(ctx, ociClient, url, verifyKey); err != nil {
+			return err
+		}
+	}
+
 	logger.Actionf("pulling artifact from %s", url)
 
-	meta, err := ociClient.Pull(ctx, url, pullArtifactArgs.output)
+	opts := artifact.PullOptions{
+		Path:   pullArtifactArgs.path,
+		Digest: pullArtifactArgs.digest,
+	}
+	if pullArtifactArgs.toStdout {
+		meta, err := ociClient.PullManifests(ctx, url, cmd.OutOrStdout(), opts)
+		if err != nil {
+			return err
+		}
+		logger.Successf("manifests of %s written to stdout", meta.Digest)
+		return nil
+	}
+
+	if err := os.MkdirAll(pullArtifactArgs.output, 0o755); err != nil {
+		return err
+	}
+	meta, err := ociClient.Pull(ctx, url, pullArtifactArgs.output, opts)
 	if err != nil {
 		return err
 	}
@@ -115,5 +208,146 @@ func pullArtifactCmdRun(cmd *cobra.Command, args []string) error {
 	logger.Successf("digest %s", meta.Digest)
 	logger.Successf("artifact content extracted to %s", pullArtifactArgs.output)
 
+	if pullArtifactArgs.showAttestations {
+		return printAttestations(ctx, cmd.OutOrStdout(), ociClient, meta.Digest, verifyKey)
+	}
+	return nil
+}
+
+// checkPullOutput returns an error if the output path is not a directory,
+// or is a non-empty directory and force is false.
+func checkPullOutput(output string, force bool) error {
+	fi, err := os.Stat(output)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("invalid output path %s", output)
+	}
+	if force {
+		return nil
+	}
+	entries, err := os.ReadDir(output)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %s is not empty, use --force to overwrite its content", output)
+	}
+	return nil
+}
+
+// printAttestations prints the SBOM and the attestations of the artifact,
+// the attestations must be about the artifact and are verified with the key
+// if not nil, and must then be signed. The SBOM isn't signed and is reported
+// as unverified when a key is given.
+func printAttestations(ctx context.Context, w io.Writer, ociClient *artifact.Client, digestURL string, key crypto.PublicKey) error {
+	attestations, err := ociClient.Attestations(ctx, digestURL)
+	if err != nil {
+		return err
+	}
+	if len(attestations) == 0 {
+		logger.Warningf("no attestations found for %s", digestURL)
+		return nil
+	}
+
+	for _, a := range attestations {
+		if a.MediaType == string(artifact.InventoryMediaType) {
+			var inventory kustomizev1.ResourceInventory
+			if err := json.Unmarshal(a.Content, &inventory); err != nil {
+				return fmt.Errorf("invalid inventory: %w", err)
+			}
+			if key != nil {
+				// The SBOM isn't signed, only the attestations can be verified
+				logger.Warningf("SBOM with %d objects, unverified", len(inventory.Entries))
+			} else {
+				logger.Successf("SBOM with %d objects", len(inventory.Entries))
+			}
+			var rows [][]string
+			for _, entry := range inventory.Entries {
+				objMeta, err := object.ParseObjMetadata(entry.ID)
+				if err != nil {
+					return fmt.Errorf("invalid inventory entry '%s': %w", entry.ID, err)
+				}
+				apiVersion := entry.Version
+				if objMeta.GroupKind.Group != "" {
+					apiVersion = objMeta.GroupKind.Group + "/" + entry.Version
+				}
+				rows = append(rows, []string{apiVersion, objMeta.GroupKind.Kind, objMeta.Namespace, objMeta.Name})
+			}
+			if err := printers.TablePrinter([]string{"api version", "kind", "namespace", "name"}).Print(w, rows); err != nil {
+				return err
+			}
+			continue
+		}
+
+		kind := a.PredicateType
+		if kind == "" {
+			kind = a.MediaType
+		}
+		switch {
+		case key != nil && !a.Signed:
+			return fmt.Errorf("attestation %s verification failed: the attestation is not signed", kind)
+		case key != nil:
+			if err := a.Verify(key, digestURL); err != nil {
+				return fmt.Errorf("attestation %s verification failed: %w", kind, err)
+			}
+			logger.Successf("attestation %s, signature verified", kind)
+		default:
+			if err := a.VerifySubject(digestURL); err != nil {
+				return fmt.Errorf("attestation %s verification failed: %w", kind, err)
+			}
+			if a.Signed {
+				logger.Successf("attestation %s, signed", kind)
+			} else {
+				logger.Warningf("attestation %s, unsigned", kind)
+			}
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, a.Content, "", "  "); err != nil {
+			return err
+		}
+		out.WriteString("\n")
+		if _, err := out.WriteTo(w); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// loadVerifyKey returns the public key to verify the artifact signatures
+// with, or nil if the verification isn't enabled.
+func loadVerifyKey(verify bool, path string) (crypto.PublicKey, error) {
+	if !verify {
+		if path != "" {
+			return nil, fmt.Errorf("--verify-key requires --verify")
+		}
+		return nil, nil
+	}
+	if path == "" {
+		return nil, fmt.Errorf("--verify-key is required with --verify")
+	}
+	key, err := artifact.LoadPublicKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading the verification key failed: %w", err)
+	}
+	return key, nil
+}
+
+// verifyArtifact verifies the signature of the artifact at the given URL
+// and returns its digest URL, for the verified content to be the one used.
+func verifyArtifact(ctx context.Context, ociClient *artifact.Client, url string, key crypto.PublicKey) (string, error) {
+	logger.Actionf("verifying the signature of %s", url)
+	digestURL, err := ociClient.Digest(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if err := ociClient.Verify(ctx, digestURL, key); err != nil {
+		if errors.Is(err, artifact.ErrNoSignature) {
+			return "", fmt.Errorf("signature verification failed for %s: %w", digestURL, err)
+		}
+		return "", err
+	}
+	logger.Successf("signature verified for %s", digestURL)
+	return digestURL, nil
+}
@@ -0,0 +1,129 @@
+//go:build unit
+// +build unit
+
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPullArtifact(t *testing.T) {
+	url := fmt.Sprintf("oci://%s/podinfo-pull:v1", dockerReg)
+	output, err := executeCommand(fmt.Sprintf("push artifact %s --path=./testdata/build-kustomization/podinfo --source=test --revision=test -o json", url))
+	if err != nil {
+		t.Fatalf("push failed: %s", err)
+	}
+	var info struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("invalid output %q: %s", output, err)
+	}
+
+	nonEmptyDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(nonEmptyDir, "deployment.yaml"), []byte("kind: ConfigMap\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles := func(dir string, files ...string) assertFunc {
+		return func(output string, err error) error {
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+					return fmt.Errorf("expected %s to be extracted: %w", f, err)
+				}
+			}
+			return nil
+		}
+	}
+	subDir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		args   string
+		assert assertFunc
+	}{
+		{
+			name:   "non-empty output directory",
+			args:   fmt.Sprintf("pull artifact %s --output=%s", url, nonEmptyDir),
+			assert: assertError(fmt.Sprintf("output directory %s is not empty, use --force to overwrite its content", nonEmptyDir)),
+		},
+		{
+			name:   "non-empty output directory with force",
+			args:   fmt.Sprintf("pull artifact %s --output=%s --force", url, nonEmptyDir),
+			assert: assertFiles(nonEmptyDir, "deployment.yaml", "service.yaml", "kustomization.yaml"),
+		},
+		{
+			name:   "file of the artifact",
+			args:   fmt.Sprintf("pull artifact %s --output=%s --path=service.yaml --digest=%s", url, subDir, info.Digest),
+			assert: assertFiles(subDir, "service.yaml"),
+		},
+		{
+			name: "digest mismatch",
+			args: fmt.Sprintf("pull artifact %s --output=%s --digest=sha256:%s", url, t.TempDir(), strings.Repeat("0", 64)),
+			assert: func(output string, err error) error {
+				if err == nil || !strings.Contains(err.Error(), "the digest of the artifact is "+info.Digest) {
+					return fmt.Errorf("expected a digest mismatch error, got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "to stdout",
+			args: fmt.Sprintf("pull artifact %s --to-stdout --path=./deployment.yaml", url),
+			assert: func(output string, err error) error {
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(output, "---\napiVersion: apps/v1\nkind: Deployment\n") || strings.Contains(output, "kind: Service") {
+					return fmt.Errorf("expected the deployment manifest, got:\n%s", output)
+				}
+				return nil
+			},
+		},
+		{
+			name:   "to stdout with output",
+			args:   fmt.Sprintf("pull artifact %s --to-stdout --output=%s", url, t.TempDir()),
+			assert: assertError("--output and --to-stdout are mutually exclusive"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assert,
+			}
+			cmd.runTestCmd(t)
+		})
+	}
+
+	data, err := os.ReadFile(filepath.Join(nonEmptyDir, "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "kind: Deployment") {
+		t.Errorf("expected deployment.yaml to be overwritten, got:\n%s", data)
+	}
+}
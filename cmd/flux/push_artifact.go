@@ -17,18 +17,31 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fluxcd/flux2/internal/artifact"
 	"github.com/fluxcd/flux2/internal/flags"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
 	reg "github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/yaml"
 
+	"github.com/fluxcd/pkg/kustomize"
 	oci "github.com/fluxcd/pkg/oci/client"
 )
 
@@ -36,7 +49,16 @@ var pushArtifactCmd = &cobra.Command{
 	Use:   "artifact",
 	Short: "Push artifact",
 	Long: `The push artifact command creates a tarball from the given directory or the single file and uploads the artifact to an OCI repository.
-The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.`,
+The command can read the credentials from '~/.docker/config.json' but they can also be passed with --creds. It can also login to a supported provider with the --provider flag.
+The tarball is reproducible, the same files produce the same layer digest. With --reproducible, the push is skipped
+if the artifact at the tag has the same content and annotations, and the creation date is read from SOURCE_DATE_EPOCH if set.
+With --sign, the artifact is signed with a cosign private key, the signature is pushed in the cosign format to be verified
+with 'flux pull artifact --verify' and by the OCIRepository verification. The key password is read from COSIGN_PASSWORD.
+With --build, the kustomize overlay at the path is built and the output is pushed as a single multi-document YAML file,
+with the patches, images and namespace of the Flux Kustomization of --kustomization-file if set. The path and the revision
+of the overlay are recorded in the 'build.toolkit.fluxcd.io/path' and 'build.toolkit.fluxcd.io/revision' annotations.
+With --attest, an SBOM listing the Kubernetes objects of the artifact and an in-toto SLSA provenance statement of the source
+and revision are attached to the artifact in the cosign format, to be displayed with 'flux pull artifact --show-attestations'.`,
 	Example: `  # Push manifests to GHCR using the short Git SHA as the OCI artifact tag
   echo $GITHUB_PAT | docker login ghcr.io --username flux --password-stdin
   flux push artifact oci://ghcr.io/org/config/app:$(git rev-parse --short HEAD) \
@@ -44,6 +66,13 @@ The command can read the credentials from '~/.docker/config.json' but they can a
 	--source="$(git config --get remote.origin.url)" \
 	--revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)"
 
+  # Push and sign artifact with a cosign key pair created with 'cosign generate-key-pair'
+  COSIGN_PASSWORD=$KEY_PASSWORD flux push artifact oci://ghcr.io/org/config/app:$(git rev-parse --short HEAD) \
+	--path="./path/to/local/manifests" \
+	--source="$(git config --get remote.origin.url)" \
+	--revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)" \
+	--sign --sign-key=cosign.key
+
   # Push and sign artifact with cosign
   digest_url = $(flux push artifact \
 	oci://ghcr.io/org/config/app:$(git rev-parse --short HEAD) \
@@ -91,19 +120,48 @@ The command can read the credentials from '~/.docker/config.json' but they can a
 	--source="$(git config --get remote.origin.url)" \
 	--revision="$(git tag --points-at HEAD)@sha1:$(git rev-parse HEAD)" \
 	--creds flux:$DOCKER_PAT
+
+  # Push the manifests built from a kustomize overlay with the patches of a Flux Kustomization
+  flux push artifact oci://ghcr.io/org/config/app:production \
+	--path="./apps/production" \
+	--kustomization-file="./clusters/production/apps.yaml" \
+	--build \
+	--source="$(git config --get remote.origin.url)" \
+	--revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)"
+
+  # Push and sign artifact with its SBOM and provenance attestation
+  flux push artifact oci://ghcr.io/org/config/app:$(git rev-parse --short HEAD) \
+	--path="./path/to/local/manifests" \
+	--source="$(git config --get remote.origin.url)" \
+	--revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)" \
+	--sign --sign-key=cosign.key \
+	--attest
+
+  # Push manifests only if they differ from the artifact at the tag
+  flux push artifact oci://ghcr.io/org/config/app:production \
+	--path="./path/to/local/manifests" \
+	--source="$(git config --get remote.origin.url)" \
+	--revision="$(git branch --show-current)@sha1:$(git rev-parse HEAD)" \
+	--reproducible
 `,
 	RunE: pushArtifactCmdRun,
 }
 
 type pushArtifactFlags struct {
-	path        string
-	source      string
-	revision    string
-	creds       string
-	provider    flags.SourceOCIProvider
-	ignorePaths []string
-	annotations []string
-	output      string
+	path              string
+	source            string
+	revision          string
+	creds             string
+	provider          flags.SourceOCIProvider
+	ignorePaths       []string
+	annotations       []string
+	output            string
+	reproducible      bool
+	sign              bool
+	signKey           string
+	build             bool
+	kustomizationFile string
+	attest            bool
 }
 
 var pushArtifactArgs = newPushArtifactFlags()
@@ -124,6 +182,20 @@ func init() {
 	pushArtifactCmd.Flags().StringArrayVarP(&pushArtifactArgs.annotations, "annotations", "a", nil, "Set custom OCI annotations in the format '<key>=<value>'")
 	pushArtifactCmd.Flags().StringVarP(&pushArtifactArgs.output, "output", "o", "",
 		"the format in which the artifact digest should be printed, can be 'json' or 'yaml'")
+	pushArtifactCmd.Flags().BoolVar(&pushArtifactArgs.reproducible, "reproducible", false,
+		"skip the push if the artifact at the tag has the same content and annotations, and read the creation date from SOURCE_DATE_EPOCH")
+	pushArtifactCmd.Flags().BoolVar(&pushArtifactArgs.sign, "sign", false,
+		"sign the artifact with the cosign private key of --sign-key")
+	pushArtifactCmd.Flags().StringVar(&pushArtifactArgs.signKey, "sign-key", "",
+		"path to the cosign private key, the password of an encrypted key is read from the COSIGN_PASSWORD environment variable")
+
+	pushArtifactCmd.Flags().BoolVar(&pushArtifactArgs.build, "build", false,
+		"build the kustomize overlay at --path and push the output as a single multi-document YAML file")
+	pushArtifactCmd.Flags().StringVar(&pushArtifactArgs.kustomizationFile, "kustomization-file", "",
+		"path to the Flux Kustomization YAML file whose patches, images and namespace are applied by --build")
+
+	pushArtifactCmd.Flags().BoolVar(&pushArtifactArgs.attest, "attest", false,
+		"attach an SBOM listing the Kubernetes objects of the artifact and a SLSA provenance attestation of --source and --revision, signed if --sign is set")
 
 	pushCmd.AddCommand(pushArtifactCmd)
 }
@@ -151,6 +223,20 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if pushArtifactArgs.signKey != "" && !pushArtifactArgs.sign {
+		return fmt.Errorf("--sign-key requires --sign")
+	}
+	var signKey crypto.Signer
+	if pushArtifactArgs.sign {
+		if pushArtifactArgs.signKey == "" {
+			return fmt.Errorf("--sign-key is required with --sign")
+		}
+		signKey, err = artifact.LoadPrivateKey(pushArtifactArgs.signKey, []byte(os.Getenv("COSIGN_PASSWORD")))
+		if err != nil {
+			return fmt.Errorf("loading the signing key failed: %w", err)
+		}
+	}
+
 	path := pushArtifactArgs.path
 	if pushArtifactArgs.path == "-" {
 		path, err = saveReaderToFile(os.Stdin)
@@ -165,6 +251,15 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid path '%s', must point to an existing directory or file: %w", path, err)
 	}
 
+	if pushArtifactArgs.kustomizationFile != "" && !pushArtifactArgs.build {
+		return fmt.Errorf("--kustomization-file requires --build")
+	}
+	if pushArtifactArgs.build {
+		if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+			return fmt.Errorf("invalid path '%s', --build requires a directory", pushArtifactArgs.path)
+		}
+	}
+
 	annotations := map[string]string{}
 	for _, annotation := range pushArtifactArgs.annotations {
 		kv := strings.Split(annotation, "=")
@@ -174,16 +269,44 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		annotations[kv[0]] = kv[1]
 	}
 
+	created, err := artifactCreated(pushArtifactArgs.reproducible)
+	if err != nil {
+		return err
+	}
 	meta := oci.Metadata{
+		Created:     created,
 		Source:      pushArtifactArgs.source,
 		Revision:    pushArtifactArgs.revision,
 		Annotations: annotations,
 	}
 
+	tmpDir, err := os.MkdirTemp("", "oci")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if pushArtifactArgs.build {
+		if pushArtifactArgs.output == "" {
+			logger.Actionf("building manifests from %s", path)
+		}
+		path, err = buildArtifactManifests(path, pushArtifactArgs.kustomizationFile, tmpDir)
+		if err != nil {
+			return fmt.Errorf("building manifests failed: %w", err)
+		}
+		annotations[artifact.BuildPathAnnotation] = filepath.ToSlash(filepath.Clean(pushArtifactArgs.path))
+		annotations[artifact.BuildRevisionAnnotation] = pushArtifactArgs.revision
+	}
+
+	tarball := filepath.Join(tmpDir, "artifact.tgz")
+	if err := artifact.Build(tarball, path, pushArtifactArgs.ignorePaths); err != nil {
+		return fmt.Errorf("building artifact failed: %w", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
 
-	ociClient := oci.NewLocalClient()
+	ociClient := artifact.NewClient()
 
 	if pushArtifactArgs.provider.String() == sourcev1.GenericOCIProvider && pushArtifactArgs.creds != "" {
 		logger.Actionf("logging in to registry with credentials")
@@ -204,13 +327,49 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if pushArtifactArgs.output == "" {
-		logger.Actionf("pushing artifact to %s", url)
+	digestURL := ""
+	if pushArtifactArgs.reproducible {
+		digestURL, err = ociClient.Identical(ctx, url, tarball, meta)
+		if err != nil {
+			return fmt.Errorf("comparing with the existing artifact failed: %w", err)
+		}
 	}
+	skipped := digestURL != ""
 
-	digestURL, err := ociClient.Push(ctx, url, path, meta, pushArtifactArgs.ignorePaths)
-	if err != nil {
-		return fmt.Errorf("pushing artifact failed: %w", err)
+	if !skipped {
+		if pushArtifactArgs.output == "" {
+			logger.Actionf("pushing artifact to %s", url)
+		}
+		digestURL, err = ociClient.Push(ctx, url, tarball, meta)
+		if err != nil {
+			return fmt.Errorf("pushing artifact failed: %w", err)
+		}
+	}
+
+	if signKey != nil {
+		if pushArtifactArgs.output == "" {
+			logger.Actionf("signing artifact %s", digestURL)
+		}
+		if err := ociClient.Sign(ctx, digestURL, signKey); err != nil {
+			return fmt.Errorf("signing artifact failed: %w", err)
+		}
+	}
+
+	attested := false
+	if pushArtifactArgs.attest {
+		existing, err := ociClient.Attestations(ctx, digestURL)
+		if err != nil {
+			return err
+		}
+		if !skipped || len(existing) == 0 {
+			if pushArtifactArgs.output == "" {
+				logger.Actionf("attaching SBOM and provenance to %s", digestURL)
+			}
+			if err := attestArtifact(ctx, ociClient, digestURL, tarball, meta, signKey); err != nil {
+				return err
+			}
+			attested = true
+		}
 	}
 
 	digest, err := reg.NewDigest(digestURL)
@@ -228,11 +387,17 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		Repository string `json:"repository"`
 		Tag        string `json:"tag"`
 		Digest     string `json:"digest"`
+		Skipped    bool   `json:"skipped,omitempty"`
+		Signed     bool   `json:"signed,omitempty"`
+		Attested   bool   `json:"attested,omitempty"`
 	}{
 		URL:        fmt.Sprintf("oci://%s", digestURL),
 		Repository: digest.Repository.Name(),
 		Tag:        tag.TagStr(),
 		Digest:     digest.DigestStr(),
+		Skipped:    skipped,
+		Signed:     signKey != nil,
+		Attested:   attested,
 	}
 
 	switch pushArtifactArgs.output {
@@ -250,8 +415,99 @@ func pushArtifactCmdRun(cmd *cobra.Command, args []string) error {
 		}
 		rootCmd.Print(string(marshalled))
 	default:
-		logger.Successf("artifact successfully pushed to %s", digestURL)
+		if skipped {
+			logger.Successf("artifact is identical to %s, push skipped", digestURL)
+		} else {
+			logger.Successf("artifact successfully pushed to %s", digestURL)
+		}
 	}
 
 	return nil
 }
+
+// artifactCreated returns the creation date of the artifact, read from the
+// SOURCE_DATE_EPOCH environment variable for reproducible artifacts.
+func artifactCreated(reproducible bool) (string, error) {
+	created := time.Now().UTC()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); reproducible && epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid SOURCE_DATE_EPOCH '%s': %w", epoch, err)
+		}
+		created = time.Unix(seconds, 0).UTC()
+	}
+	return created.Format(time.RFC3339), nil
+}
+
+// attestArtifact attaches to the artifact the inventory of its Kubernetes
+// objects as SBOM, and the SLSA provenance of its source and revision signed
+// with the key if not nil.
+func attestArtifact(ctx context.Context, ociClient *artifact.Client, digestURL, tarball string, meta oci.Metadata, key crypto.Signer) error {
+	inventory, err := artifact.Inventory(tarball)
+	if err != nil {
+		return fmt.Errorf("listing the artifact objects failed: %w", err)
+	}
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+	if err := ociClient.AttachSBOM(ctx, digestURL, artifact.InventoryMediaType, data); err != nil {
+		return err
+	}
+
+	builder := fmt.Sprintf("https://github.com/fluxcd/flux2/releases/tag/v%s", VERSION)
+	statement, err := artifact.ProvenanceStatement(digestURL, builder, pushArtifactArgs.path, meta, pushArtifactArgs.reproducible)
+	if err != nil {
+		return err
+	}
+	return ociClient.Attest(ctx, digestURL, statement, key)
+}
+
+// buildArtifactManifests builds the kustomize overlay at the given path with
+// the patches, images and namespace of the Flux Kustomization file, if any,
+// and writes the output to a multi-document YAML file in the given directory.
+// A kustomization.yaml is generated for the build if the path has none.
+func buildArtifactManifests(path, kustomizationFile, dir string) (string, error) {
+	var ks kustomizev1.Kustomization
+	if kustomizationFile != "" {
+		data, err := os.ReadFile(kustomizationFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read kustomization file %s: %w", kustomizationFile, err)
+		}
+		decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data))
+		for ks.Kind != kustomizev1.KustomizationKind {
+			if err := decoder.Decode(&ks); err != nil {
+				if err == io.EOF {
+					return "", fmt.Errorf("no Kustomization found in %s", kustomizationFile)
+				}
+				return "", fmt.Errorf("failed to unmarshal kustomization file %s: %w", kustomizationFile, err)
+			}
+		}
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&ks)
+	if err != nil {
+		return "", err
+	}
+	action, err := kustomize.NewGenerator("", unstructured.Unstructured{Object: obj}).
+		WriteFile(path, kustomize.WithSaveOriginalKustomization())
+	if err != nil {
+		if cleanErr := kustomize.CleanDirectory(path, action); cleanErr != nil {
+			err = fmt.Errorf("%v %v", err, cleanErr)
+		}
+		return "", fmt.Errorf("failed to generate kustomization.yaml: %w", err)
+	}
+	manifests, err := kustomization.BuildWithRoot(path, path)
+	if cleanErr := kustomize.CleanDirectory(path, action); err == nil {
+		err = cleanErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, "manifests.yaml")
+	if err := os.WriteFile(file, manifests, 0o600); err != nil {
+		return "", err
+	}
+	return file, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildArtifactManifests(t *testing.T) {
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: ghcr.io/stefanprodan/podinfo:6.3.0
+`
+	ks := `apiVersion: kustomize.toolkit.fluxcd.io/v1beta2
+kind: Kustomization
+metadata:
+  name: podinfo
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./podinfo
+  prune: true
+  targetNamespace: apps
+  images:
+  - name: ghcr.io/stefanprodan/podinfo
+    newTag: 6.3.5
+  sourceRef:
+    kind: GitRepository
+    name: flux-system
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "podinfo")
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "deployment.yaml"), []byte(deployment), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ksFile := filepath.Join(dir, "podinfo.yaml")
+	if err := os.WriteFile(ksFile, []byte(ks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		kustomizationFile string
+		want              []string
+	}{
+		{
+			name: "without kustomization file",
+			want: []string{"image: ghcr.io/stefanprodan/podinfo:6.3.0"},
+		},
+		{
+			name:              "with kustomization file",
+			kustomizationFile: ksFile,
+			want:              []string{"image: ghcr.io/stefanprodan/podinfo:6.3.5", "namespace: apps"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := buildArtifactManifests(path, tt.kustomizationFile, t.TempDir())
+			if err != nil {
+				t.Fatalf("buildArtifactManifests() error = %v", err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("manifests don't contain %q:\n%s", want, data)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(path, "kustomization.yaml")); !os.IsNotExist(err) {
+				t.Errorf("expected the generated kustomization.yaml to be removed")
+			}
+		})
+	}
+}
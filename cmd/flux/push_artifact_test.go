@@ -0,0 +1,232 @@
+//go:build unit
+// +build unit
+
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/flux2/internal/artifact"
+)
+
+func TestPushArtifactReproducible(t *testing.T) {
+	type pushInfo struct {
+		Digest  string `json:"digest"`
+		Skipped bool   `json:"skipped"`
+	}
+	push := func(path, revision string) pushInfo {
+		t.Helper()
+		output, err := executeCommand(fmt.Sprintf("push artifact oci://%s/podinfo:reproducible --path=%s --source=test --revision=%s --reproducible -o json",
+			dockerReg, path, revision))
+		if err != nil {
+			t.Fatalf("push failed: %s", err)
+		}
+		var info pushInfo
+		if err := json.Unmarshal([]byte(output), &info); err != nil {
+			t.Fatalf("invalid output %q: %s", output, err)
+		}
+		return info
+	}
+
+	first := push("./testdata/diff-artifact/deployment.yaml", "v1")
+	if first.Skipped {
+		t.Fatalf("expected the first push not to be skipped")
+	}
+	second := push("./testdata/diff-artifact/deployment.yaml", "v1")
+	if !second.Skipped || second.Digest != first.Digest {
+		t.Errorf("expected the identical push to be skipped with digest %s, got %+v", first.Digest, second)
+	}
+	third := push("./testdata/diff-artifact/deployment-diff.yaml", "v1")
+	if third.Skipped || third.Digest == first.Digest {
+		t.Errorf("expected the changed content to be pushed, got %+v", third)
+	}
+}
+
+func TestPushArtifactSign(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name string) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPath := filepath.Join(dir, name+".key")
+		pubPath := filepath.Join(dir, name+".pub")
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return keyPath, pubPath
+	}
+	keyPath, pubPath := writeKey("cosign")
+	_, otherPubPath := writeKey("other")
+
+	url := fmt.Sprintf("oci://%s/podinfo:signed", dockerReg)
+	if _, err := executeCommand(fmt.Sprintf("push artifact %s --path=./testdata/diff-artifact/deployment.yaml --source=test --revision=test --sign --sign-key=%s",
+		url, keyPath)); err != nil {
+		t.Fatalf("push failed: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		args   string
+		assert assertFunc
+	}{
+		{
+			name:   "pull with the public key",
+			args:   fmt.Sprintf("pull artifact %s --output=%s --verify --verify-key=%s", url, t.TempDir(), pubPath),
+			assert: assertSuccess(),
+		},
+		{
+			name:   "diff with the public key",
+			args:   fmt.Sprintf("diff artifact %s --path=./testdata/diff-artifact/deployment.yaml --verify --verify-key=%s", url, pubPath),
+			assert: assertSuccess(),
+		},
+		{
+			name: "pull with another public key",
+			args: fmt.Sprintf("pull artifact %s --output=%s --verify --verify-key=%s", url, t.TempDir(), otherPubPath),
+			assert: func(output string, err error) error {
+				if err == nil || !strings.Contains(err.Error(), "no signature matching the public key found") {
+					return fmt.Errorf("expected a signature verification error, got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "diff with another public key",
+			args: fmt.Sprintf("diff artifact %s --path=./testdata/diff-artifact/deployment.yaml --verify --verify-key=%s", url, otherPubPath),
+			assert: func(output string, err error) error {
+				var reqErr *RequestError
+				if !errors.As(err, &reqErr) || reqErr.StatusCode != 2 {
+					return fmt.Errorf("expected a verification error exiting with 2, got %v", err)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdTestCase{
+				args:   tt.args,
+				assert: tt.assert,
+			}
+			cmd.runTestCmd(t)
+		})
+	}
+}
+
+func TestPushArtifactBuild(t *testing.T) {
+	url := fmt.Sprintf("oci://%s/podinfo:build", dockerReg)
+	if _, err := executeCommand(fmt.Sprintf("push artifact %s --path=./testdata/build-kustomization/podinfo --source=test --revision=main@sha1:test --build",
+		url)); err != nil {
+		t.Fatalf("push failed: %s", err)
+	}
+	if _, err := os.Stat("./testdata/build-kustomization/podinfo/kustomization.yaml"); err != nil {
+		t.Fatalf("expected the kustomization.yaml to be restored: %s", err)
+	}
+
+	dir := t.TempDir()
+	if _, err := executeCommand(fmt.Sprintf("pull artifact %s --output=%s", url, dir)); err != nil {
+		t.Fatalf("pull failed: %s", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "manifests.yaml" {
+		t.Fatalf("expected a single manifests.yaml, got %v", entries)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "manifests.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "kind: Deployment") || !strings.Contains(string(data), "kind: Service") {
+		t.Errorf("expected the built manifests, got:\n%s", data)
+	}
+
+	output, err := executeCommand(fmt.Sprintf("push artifact %s --path=./testdata/diff-artifact/deployment.yaml --source=test --revision=test --kustomization-file=./testdata/build-kustomization/podinfo-kustomization.yaml",
+		url))
+	if err == nil || !strings.Contains(err.Error(), "--kustomization-file requires --build") {
+		t.Errorf("expected an error for --kustomization-file without --build, got %v: %s", err, output)
+	}
+}
+
+func TestPushArtifactAttest(t *testing.T) {
+	url := fmt.Sprintf("oci://%s/podinfo:attested", dockerReg)
+	output, err := executeCommand(fmt.Sprintf("push artifact %s --path=./testdata/build-kustomization/podinfo --source=https://github.com/org/config --revision=main@sha1:6ee3f4b6 --attest -o json",
+		url))
+	if err != nil {
+		t.Fatalf("push failed: %s", err)
+	}
+	var info struct {
+		Digest   string `json:"digest"`
+		Attested bool   `json:"attested"`
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil || !info.Attested {
+		t.Fatalf("expected the artifact to be attested, got %q", output)
+	}
+
+	output, err = executeCommand(fmt.Sprintf("pull artifact %s --output=%s --show-attestations", url, t.TempDir()))
+	if err != nil {
+		t.Fatalf("pull failed: %s", err)
+	}
+	for _, want := range []string{
+		"SBOM with 5 objects",
+		"HorizontalPodAutoscaler",
+		"https://slsa.dev/provenance/v0.2",
+		`"uri": "https://github.com/org/config"`,
+		`"sha1": "6ee3f4b6"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digestURL := fmt.Sprintf("%s/podinfo@%s", dockerReg, info.Digest)
+	err = printAttestations(context.Background(), io.Discard, artifact.NewClient(), digestURL, &key.PublicKey)
+	if err == nil || !strings.Contains(err.Error(), "the attestation is not signed") {
+		t.Errorf("expected the verification of the unsigned attestation to fail, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/fluxcd/pkg/untar"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore the Flux custom resources from a backup",
+	Long: `The restore command applies the objects of a backup made with 'flux backup' with server-side apply.
+The custom resources are applied suspended, then resumed in dependency order: the sources first,
+then the Kustomizations and HelmReleases after the objects they depend on, then the image
+automation and notification objects. Each dependency level is resumed once the previous one
+is ready, or once --timeout has passed waiting for it, in which case a warning is printed.
+The objects suspended at backup time are kept suspended.`,
+	Example: `  # Restore the Flux custom resources after installing Flux
+  flux install
+  flux restore --path=./flux-backup
+
+  # Restore the Flux custom resources and Secrets from an archive
+  flux restore --path=flux-backup.tar.gz`,
+	RunE: restoreCmdRun,
+}
+
+type restoreFlags struct {
+	path string
+}
+
+var restoreArgs restoreFlags
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreArgs.path, "path", "",
+		"path to the directory, or to the tar.gz archive, written by 'flux backup'")
+
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func restoreCmdRun(cmd *cobra.Command, args []string) error {
+	if restoreArgs.path == "" {
+		return fmt.Errorf("--path is required")
+	}
+
+	objects, err := readBackup(restoreArgs.path)
+	if err != nil {
+		return fmt.Errorf("unable to read backup: %w", err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects found in %s", restoreArgs.path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
+	namespaces := map[string]bool{}
+	for _, obj := range objects {
+		namespaces[obj.GetNamespace()] = true
+	}
+	for ns := range namespaces {
+		if ns == "" {
+			continue
+		}
+		err := kubeClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		if err == nil {
+			logger.Successf("Namespace/%s created", ns)
+		} else if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("unable to create namespace %s: %w", ns, err)
+		}
+	}
+
+	restMapper, err := kubeconfigArgs.ToRESTMapper()
+	if err != nil {
+		return err
+	}
+	poller := polling.NewStatusPoller(kubeClient, restMapper, polling.Options{})
+	manager := ssa.NewResourceManager(kubeClient, poller, ssa.Owner{
+		Field: "flux",
+		Group: "fluxcd.io",
+	})
+	applyOpts := ssa.DefaultApplyOptions()
+
+	logger.Actionf("applying %d objects suspended", len(objects))
+	suspended := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		obj = obj.DeepCopy()
+		if isSuspendable(obj) {
+			if err := unstructured.SetNestedField(obj.Object, true, "spec", "suspend"); err != nil {
+				return err
+			}
+		}
+		suspended = append(suspended, obj)
+	}
+	changeSet, err := manager.ApplyAll(ctx, suspended, applyOpts)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, changeSet.String())
+
+	logger.Actionf("resuming objects in dependency order")
+	for _, level := range resumeLevels(objects) {
+		if err := resumeLevel(manager, level, applyOpts); err != nil {
+			return err
+		}
+	}
+	for _, obj := range objects {
+		if isSuspendable(obj) && isSuspended(obj) {
+			logger.Warningf("%s was suspended at backup time and is kept suspended", ssa.FmtUnstructured(obj))
+		}
+	}
+
+	logger.Successf("restore finished")
+	return nil
+}
+
+// readBackup returns the objects of the backup directory or archive.
+func readBackup(path string) ([]*unstructured.Unstructured, error) {
+	dir := path
+	if isBackupArchive(path) {
+		tmpDir, err := manifestgen.MkdirTempAbs("", "flux-restore-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := untar.Untar(f, tmpDir); err != nil {
+			return nil, err
+		}
+		dir = tmpDir
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := ssa.ReadObjects(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid objects in %s: %w", filepath.Base(file), err)
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+// isSuspendable returns true if the object is a Flux custom resource that
+// can be suspended.
+func isSuspendable(obj *unstructured.Unstructured) bool {
+	if obj.GetKind() == imagev1.ImagePolicyKind {
+		return false
+	}
+	for _, k := range backupKinds() {
+		if obj.GetKind() == k.kind {
+			return true
+		}
+	}
+	return false
+}
+
+func isSuspended(obj *unstructured.Unstructured) bool {
+	suspend, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend")
+	return suspend
+}
+
+// resumeLevel resumes the objects of a dependency level and waits for
+// them to be ready, a level that isn't ready within the timeout is
+// reported and doesn't stop the restore, as the controllers hold back the
+// reconciliation of the objects that depend on it.
+func resumeLevel(manager *ssa.ResourceManager, level []*unstructured.Unstructured, applyOpts ssa.ApplyOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	for _, obj := range level {
+		if _, err := manager.Apply(ctx, obj, applyOpts); err != nil {
+			return fmt.Errorf("failed to resume %s: %w", ssa.FmtUnstructured(obj), err)
+		}
+		logger.Successf("%s resumed", ssa.FmtUnstructured(obj))
+	}
+
+	logger.Waitingf("waiting for %d resumed objects to be ready", len(level))
+	err := manager.Wait(level, ssa.WaitOptions{
+		Interval: 2 * time.Second,
+		Timeout:  rootArgs.timeout,
+	})
+	if err != nil {
+		logger.Warningf("resumed objects not ready: %s", err)
+		return nil
+	}
+	logger.Successf("resumed objects ready")
+	return nil
+}
+
+// resumeLevels returns the objects to resume grouped in levels, ordered by
+// kind as in the backup, and for the same kind after the level of the
+// objects they depend on.
+func resumeLevels(objects []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	byKind := map[string][]*unstructured.Unstructured{}
+	for _, obj := range objects {
+		if isSuspendable(obj) && !isSuspended(obj) {
+			byKind[obj.GetKind()] = append(byKind[obj.GetKind()], obj)
+		}
+	}
+
+	var levels [][]*unstructured.Unstructured
+	for _, k := range backupKinds() {
+		levels = append(levels, dependencyLevels(byKind[k.kind])...)
+	}
+	return levels
+}
+
+// dependencyLevels groups the objects in levels, an object is in the level
+// after the ones of the objects listed in its spec.dependsOn, the objects
+// in a dependency cycle are grouped in the last level.
+func dependencyLevels(objects []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	key := func(namespace, name string) string {
+		return namespace + "/" + name
+	}
+	present := map[string]bool{}
+	for _, obj := range objects {
+		present[key(obj.GetNamespace(), obj.GetName())] = true
+	}
+	dependencies := func(obj *unstructured.Unstructured) []string {
+		deps, _, _ := unstructured.NestedSlice(obj.Object, "spec", "dependsOn")
+		var keys []string
+		for _, d := range deps {
+			ref, ok := d.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := ref["name"].(string)
+			namespace, _ := ref["namespace"].(string)
+			if namespace == "" {
+				namespace = obj.GetNamespace()
+			}
+			if k := key(namespace, name); present[k] {
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	}
+
+	done := map[string]bool{}
+	var levels [][]*unstructured.Unstructured
+	for remaining := len(objects); remaining > 0; {
+		var level []*unstructured.Unstructured
+		for _, obj := range objects {
+			if done[key(obj.GetNamespace(), obj.GetName())] {
+				continue
+			}
+			ready := true
+			for _, dep := range dependencies(obj) {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, obj)
+			}
+		}
+		if len(level) == 0 {
+			for _, obj := range objects {
+				if !done[key(obj.GetNamespace(), obj.GetName())] {
+					level = append(level, obj)
+				}
+			}
+		}
+		for _, obj := range level {
+			done[key(obj.GetNamespace(), obj.GetName())] = true
+		}
+		remaining -= len(level)
+		levels = append(levels, level)
+	}
+	return levels
+}
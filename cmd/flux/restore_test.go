@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestResumeLevels(t *testing.T) {
+	object := func(kind, name string, suspend bool, dependsOn ...string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"kind": kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "flux-system",
+			},
+			"spec": map[string]interface{}{},
+		}}
+		if suspend {
+			_ = unstructured.SetNestedField(obj.Object, true, "spec", "suspend")
+		}
+		var deps []interface{}
+		for _, d := range dependsOn {
+			deps = append(deps, map[string]interface{}{"name": d})
+		}
+		if len(deps) > 0 {
+			_ = unstructured.SetNestedSlice(obj.Object, deps, "spec", "dependsOn")
+		}
+		return obj
+	}
+
+	objects := []*unstructured.Unstructured{
+		object("Secret", "auth", false),
+		object("Kustomization", "apps", false, "infra-configs"),
+		object("Alert", "slack", false),
+		object("Kustomization", "infra-configs", false, "infra-controllers"),
+		object("Kustomization", "infra-controllers", false),
+		object("Kustomization", "paused", true),
+		object("ImagePolicy", "podinfo", false),
+		object("HelmRelease", "podinfo", false),
+		object("GitRepository", "flux-system", false),
+	}
+
+	var levels [][]string
+	for _, level := range resumeLevels(objects) {
+		var names []string
+		for _, obj := range level {
+			names = append(names, obj.GetKind()+"/"+obj.GetName())
+		}
+		levels = append(levels, names)
+	}
+	wantLevels := [][]string{
+		{"GitRepository/flux-system"},
+		{"Kustomization/infra-controllers"},
+		{"Kustomization/infra-configs"},
+		{"Kustomization/apps"},
+		{"HelmRelease/podinfo"},
+		{"Alert/slack"},
+	}
+	if !reflect.DeepEqual(levels, wantLevels) {
+		t.Errorf("resumeLevels() = %v, want %v", levels, wantLevels)
+	}
+
+	cycle := []*unstructured.Unstructured{
+		object("Kustomization", "a", false, "b"),
+		object("Kustomization", "b", false, "a"),
+	}
+	if got := dependencyLevels(cycle); len(got) != 1 || len(got[0]) != 2 {
+		t.Errorf("expected the objects of a cycle to be kept in the last level, got %v", got)
+	}
+}
@@ -19,6 +19,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
@@ -35,7 +37,15 @@ var uninstallCmd = &cobra.Command{
   flux uninstall --namespace=flux-system
 
   # Uninstall Flux but keep the namespace
-  flux uninstall --namespace=infra --keep-namespace=true`,
+  flux uninstall --namespace=infra --keep-namespace=true
+
+  # Uninstall the image automation controllers and their custom resource definitions
+  flux uninstall --components=image-reflector-controller,image-automation-controller
+
+  # Back up the Flux custom resources before uninstalling, and restore them after a reinstall
+  flux backup --path=flux-backup.tar.gz --with-secrets
+  flux uninstall
+  flux install && flux restore --path=flux-backup.tar.gz`,
 	RunE: uninstallCmdRun,
 }
 
@@ -43,6 +53,8 @@ type uninstallFlags struct {
 	keepNamespace bool
 	dryRun        bool
 	silent        bool
+	components    []string
+	force         bool
 }
 
 var uninstallArgs uninstallFlags
@@ -54,11 +66,22 @@ func init() {
 		"only print the objects that would be deleted")
 	uninstallCmd.Flags().BoolVarP(&uninstallArgs.silent, "silent", "s", false,
 		"delete components without asking for confirmation")
+	uninstallCmd.Flags().StringSliceVar(&uninstallArgs.components, "components", nil,
+		"list of components to uninstall with their custom resource definitions, accepts comma-separated values")
+	uninstallCmd.Flags().BoolVar(&uninstallArgs.force, "force", false,
+		"delete the custom resources of the uninstalled components if any remain")
 
 	rootCmd.AddCommand(uninstallCmd)
 }
 
 func uninstallCmdRun(cmd *cobra.Command, args []string) error {
+	if len(uninstallArgs.components) > 0 {
+		return uninstallComponentsCmdRun(uninstallArgs.components)
+	}
+	if uninstallArgs.force {
+		return fmt.Errorf("--force can only be used with --components")
+	}
+
 	if !uninstallArgs.dryRun && !uninstallArgs.silent {
 		prompt := promptui.Prompt{
 			Label:     "Are you sure you want to delete Flux and its custom resource definitions",
@@ -93,3 +116,61 @@ func uninstallCmdRun(cmd *cobra.Command, args []string) error {
 	logger.Successf("uninstall finished")
 	return nil
 }
+
+func uninstallComponentsCmdRun(components []string) error {
+	if err := utils.ValidateComponents(components); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
+	remaining, err := uninstall.RemainingCustomResources(ctx, kubeClient, components)
+	if err != nil {
+		return fmt.Errorf("unable to list the custom resources of the components: %w", err)
+	}
+	if len(remaining) > 0 && !uninstallArgs.force {
+		kinds := make([]string, 0, len(remaining))
+		for kind, count := range remaining {
+			kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+		}
+		sort.Strings(kinds)
+		return fmt.Errorf("%s objects remain, delete them or use --force to delete them with the components",
+			strings.Join(kinds, ", "))
+	}
+
+	if !uninstallArgs.dryRun && !uninstallArgs.silent {
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Are you sure you want to delete %s and its custom resource definitions", strings.Join(components, ", ")),
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			return fmt.Errorf("aborting")
+		}
+	}
+
+	if len(remaining) > 0 {
+		logger.Actionf("deleting the custom resources of %s in all namespaces", strings.Join(components, ", "))
+		if err := uninstall.SelectedCustomResources(ctx, logger, kubeClient, components, uninstallArgs.dryRun); err != nil {
+			return fmt.Errorf("uninstall failed: %w", err)
+		}
+	}
+
+	logger.Actionf("deleting %s in %s namespace", strings.Join(components, ", "), *kubeconfigArgs.Namespace)
+	if err := uninstall.SelectedComponents(ctx, logger, kubeClient, *kubeconfigArgs.Namespace, components, uninstallArgs.dryRun); err != nil {
+		return fmt.Errorf("uninstall failed: %w", err)
+	}
+
+	logger.Actionf("deleting the custom resource definitions of %s", strings.Join(components, ", "))
+	if err := uninstall.SelectedCustomResourceDefinitions(ctx, logger, kubeClient, components, uninstallArgs.dryRun); err != nil {
+		return fmt.Errorf("uninstall failed: %w", err)
+	}
+
+	logger.Successf("uninstall finished")
+	return nil
+}
@@ -0,0 +1,443 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/fluxcd/pkg/version"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
+	"github.com/fluxcd/flux2/pkg/status"
+	"github.com/fluxcd/flux2/pkg/upgrade"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade Flux",
+	Long: `The upgrade command upgrades the Flux components installed in the specified namespace.
+It verifies that the CRDs of the target version can be applied, migrates the objects
+stored in deprecated API versions, applies the new manifests with server-side apply,
+and rolls back the components if they are not ready after the upgrade. Once the upgrade
+is verified, the objects are migrated to the storage versions of the new CRDs.
+The installed version is read from the version label of the components, the upgrade fails
+if the label is missing unless --force is set.`,
+	Example: `  # Upgrade Flux to the version of the CLI
+  flux upgrade
+
+  # Run the pre-flight checks of an upgrade to a specific version
+  flux upgrade --version=v0.41.0 --dry-run
+
+  # Upgrade Flux from an install bundle with no network access
+  flux upgrade --bundle=flux-bundle.tgz
+
+  # Upgrade components installed without the version label
+  flux upgrade --version=v0.41.0 --force`,
+	RunE: upgradeCmdRun,
+}
+
+type upgradeFlags struct {
+	version           string
+	defaultComponents []string
+	extraComponents   []string
+	registry          string
+	imagePullSecret   string
+	bundle            string
+	patchFiles        []string
+	patchesDir        string
+	dryRun            bool
+	force             bool
+}
+
+var upgradeArgs upgradeFlags
+
+func init() {
+	upgradeCmd.Flags().StringVarP(&upgradeArgs.version, "version", "v", "",
+		"toolkit version, when specified the manifests are downloaded from https://github.com/fluxcd/flux2/releases")
+	upgradeCmd.Flags().StringSliceVar(&upgradeArgs.defaultComponents, "components", nil,
+		"list of components, accepts comma-separated values, defaults to the installed components")
+	upgradeCmd.Flags().StringSliceVar(&upgradeArgs.extraComponents, "components-extra", nil,
+		"list of components in addition to those supplied or installed, accepts values such as 'image-reflector-controller,image-automation-controller'")
+	upgradeCmd.Flags().StringVar(&upgradeArgs.registry, "registry", "",
+		"container registry where the toolkit images are published, defaults to the registry of the installed images")
+	upgradeCmd.Flags().StringVar(&upgradeArgs.imagePullSecret, "image-pull-secret", "",
+		"Kubernetes secret name used for pulling the toolkit images from a private registry, defaults to the one of the installed components")
+	upgradeCmd.Flags().StringVar(&upgradeArgs.bundle, "bundle", "",
+		"path to an install bundle created with 'flux install --export-bundle', to upgrade without network access")
+	upgradeCmd.Flags().StringSliceVar(&upgradeArgs.patchFiles, "patch-file", nil,
+		"list of Kustomize patch files to apply to the components, accepts comma-separated values")
+	upgradeCmd.Flags().StringVar(&upgradeArgs.patchesDir, "patches-dir", "",
+		"path to a directory with Kustomize patch files to apply to the components")
+	upgradeCmd.Flags().BoolVar(&upgradeArgs.dryRun, "dry-run", false,
+		"only run the pre-flight checks")
+	upgradeCmd.Flags().BoolVar(&upgradeArgs.force, "force", false,
+		"upgrade even if the installed version can't be determined from the version label of the components")
+
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+// installation is the configuration of the Flux components found in the
+// cluster.
+type installation struct {
+	version            string
+	components         []string
+	registry           string
+	imagePullSecret    string
+	networkPolicy      bool
+	watchAllNamespaces bool
+}
+
+func upgradeCmdRun(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	ns := *kubeconfigArgs.Namespace
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return err
+	}
+
+	logger.Actionf("checking the installation in %s namespace", ns)
+	installed, err := detectInstallation(ctx, kubeClient, ns)
+	if err != nil {
+		return err
+	}
+
+	components := installed.components
+	if len(upgradeArgs.defaultComponents) > 0 {
+		components = upgradeArgs.defaultComponents
+	}
+	components = append(components, upgradeArgs.extraComponents...)
+	if err := utils.ValidateComponents(components); err != nil {
+		return err
+	}
+
+	tmpDir, err := manifestgen.MkdirTempAbs("", ns)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifestsBase := ""
+	if upgradeArgs.bundle != "" {
+		if upgradeArgs.version, err = extractInstallBundle(upgradeArgs.bundle, upgradeArgs.version, components, tmpDir); err != nil {
+			return err
+		}
+		manifestsBase = tmpDir
+	} else {
+		if upgradeArgs.version, err = getVersion(upgradeArgs.version); err != nil {
+			return err
+		}
+		if isEmbeddedVersion(upgradeArgs.version) {
+			if err := writeEmbeddedManifests(tmpDir); err != nil {
+				return err
+			}
+			manifestsBase = tmpDir
+		}
+	}
+
+	if installed.version == "" {
+		if !upgradeArgs.force {
+			return fmt.Errorf("the installed version can't be determined from the %s label of the components, use --force to upgrade without the version checks",
+				manifestgen.VersionLabelKey)
+		}
+		logger.Warningf("the installed version can't be determined from the %s label, skipping the version checks", manifestgen.VersionLabelKey)
+	} else {
+		if err := compareVersions(installed.version, upgradeArgs.version); err != nil {
+			return err
+		}
+		logger.Successf("upgrading from %s to %s", installed.version, upgradeArgs.version)
+	}
+
+	var ks kustomizev1.Kustomization
+	if err := kubeClient.Get(ctx, client.ObjectKey{Namespace: ns, Name: ns}, &ks); err == nil {
+		logger.Warningf("the components are reconciled by the Kustomization %s/%s, update the manifests in Git with 'flux bootstrap' for the upgrade to persist", ns, ns)
+	}
+
+	opts := installed.installOptions(ns, upgradeArgs.version)
+	opts.Components = components
+	if upgradeArgs.registry != "" {
+		opts.Registry = upgradeArgs.registry
+	}
+	if upgradeArgs.imagePullSecret != "" {
+		opts.ImagePullSecret = upgradeArgs.imagePullSecret
+	}
+
+	logger.Generatef("generating manifests")
+	manifest, err := install.Generate(opts, manifestsBase)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	patches, err := kustomization.LoadPatches(append(upgradeArgs.patchFiles, upgradeArgs.patchesDir)...)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	if len(patches) > 0 {
+		patched, err := kustomization.VerifyPatches(manifest.Content, patches)
+		if err != nil {
+			return fmt.Errorf("upgrade failed: %w", err)
+		}
+		manifest.Content = fmt.Sprintf("%s\n%s", install.GetGenWarning(opts), string(patched))
+	}
+	objects, err := ssa.ReadObjects(strings.NewReader(manifest.Content))
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+
+	logger.Actionf("running pre-flight checks")
+	targetCRDs, err := upgrade.CRDs(objects)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	var crdList apiextensionsv1.CustomResourceDefinitionList
+	if err := kubeClient.List(ctx, &crdList, client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}); err != nil {
+		return fmt.Errorf("unable to list the installed CRDs: %w", err)
+	}
+	for _, rv := range upgrade.RemovedVersions(crdList.Items, targetCRDs) {
+		if rv.Stored {
+			logger.Warningf("%s %s is removed, its objects will be migrated to the storage version", rv.Kind, rv.Version)
+		} else {
+			logger.Warningf("%s %s is removed, update the manifests in Git that use it", rv.Kind, rv.Version)
+		}
+	}
+	if err := upgrade.Preflight(crdList.Items, targetCRDs); err != nil {
+		return fmt.Errorf("pre-flight checks failed: %w", err)
+	}
+	logger.Successf("pre-flight checks passed")
+
+	var snapshot *upgrade.Snapshot
+	if !upgradeArgs.dryRun {
+		// The snapshot is taken before the migration, for the rollback to
+		// restore the stored versions of the CRDs
+		snapshot, err = upgrade.TakeSnapshot(ctx, kubeClient, objects, crdList.Items)
+		if err != nil {
+			return fmt.Errorf("upgrade failed: %w", err)
+		}
+	}
+
+	if err := migrateStoredVersions(ctx, kubeClient, crdList.Items, upgradeArgs.dryRun); err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+
+	if upgradeArgs.dryRun {
+		logger.Successf("upgrade dry-run finished")
+		return nil
+	}
+
+	if _, err := manifest.WriteFile(tmpDir); err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	logger.Actionf("applying the %s manifests", upgradeArgs.version)
+	applyOutput, err := utils.Apply(ctx, kubeconfigArgs, kubeclientOptions, tmpDir, filepath.Join(tmpDir, manifest.Path))
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, applyOutput)
+
+	kubeConfig, err := utils.KubeConfig(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	statusChecker, err := status.NewStatusChecker(kubeConfig, 5*time.Second, rootArgs.timeout, logger)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	componentRefs, err := buildComponentObjectRefs(components...)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	logger.Waitingf("verifying upgrade")
+	if err := statusChecker.Assess(componentRefs...); err == nil {
+		// The new CRDs may change the storage versions, the objects are
+		// migrated once the upgrade is verified for the rollback to keep
+		// them in the versions of the installed CRDs.
+		var newCRDList apiextensionsv1.CustomResourceDefinitionList
+		if err := kubeClient.List(ctx, &newCRDList, client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}); err != nil {
+			return fmt.Errorf("unable to list the upgraded CRDs: %w", err)
+		}
+		if err := migrateStoredVersions(ctx, kubeClient, newCRDList.Items, false); err != nil {
+			return fmt.Errorf("upgrade finished, migration to the new storage versions failed: %w", err)
+		}
+		logger.Successf("upgrade finished")
+		return nil
+	}
+
+	logger.Actionf("rolling back the components to %s", installed.displayVersion())
+	rollbackCtx, rollbackCancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer rollbackCancel()
+	changeSet, err := snapshot.Rollback(rollbackCtx, kubeClient)
+	if err != nil {
+		return fmt.Errorf("upgrade failed, rollback failed: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, changeSet.String())
+	installedRefs, err := buildComponentObjectRefs(installed.components...)
+	if err != nil {
+		return err
+	}
+	if err := statusChecker.Assess(installedRefs...); err != nil {
+		return fmt.Errorf("upgrade failed, the components are not ready after the rollback to %s", installed.displayVersion())
+	}
+	return fmt.Errorf("upgrade failed, rolled back the components to %s", installed.displayVersion())
+}
+
+// migrateStoredVersions migrates the objects of the CRDs stored in other
+// versions than the storage version.
+func migrateStoredVersions(ctx context.Context, kubeClient client.Client,
+	crds []apiextensionsv1.CustomResourceDefinition, dryRun bool) error {
+	for i := range crds {
+		crd := &crds[i]
+		stale := upgrade.StaleStoredVersions(*crd)
+		if len(stale) == 0 {
+			continue
+		}
+		logger.Actionf("migrating %s stored in %s", crd.Spec.Names.Plural, strings.Join(stale, ", "))
+		if err := upgrade.MigrateStoredVersions(ctx, logger, kubeClient, crd, dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayVersion returns the installed version for the messages, which may
+// be unknown with --force.
+func (i *installation) displayVersion() string {
+	if i.version == "" {
+		return "the previous version"
+	}
+	return i.version
+}
+
+// installOptions returns the options to generate the manifests of the
+// given version with the configuration of the installation.
+func (i *installation) installOptions(namespace, version string) install.Options {
+	opts := install.MakeDefaultOptions()
+	opts.Version = version
+	opts.Namespace = namespace
+	opts.Components = i.components
+	opts.Registry = i.registry
+	opts.ImagePullSecret = i.imagePullSecret
+	opts.WatchAllNamespaces = i.watchAllNamespaces
+	opts.NetworkPolicy = i.networkPolicy
+	opts.NotificationController = rootArgs.defaults.NotificationController
+	opts.ManifestFile = fmt.Sprintf("%s.yaml", namespace)
+	opts.Timeout = rootArgs.timeout
+	return opts
+}
+
+// compareVersions verifies that the target version is an upgrade of the
+// installed version.
+func compareVersions(installed, target string) error {
+	installedSv, err := version.ParseVersion(installed)
+	if err != nil {
+		return fmt.Errorf("unable to determine the installed version: %w", err)
+	}
+	targetSv, err := version.ParseVersion(target)
+	if err != nil {
+		return fmt.Errorf("invalid target version '%s': %w", target, err)
+	}
+	if targetSv.LessThan(installedSv) {
+		return fmt.Errorf("the installed version %s is newer than the target version %s, downgrades are not supported", installed, target)
+	}
+	if !utils.CompatibleVersion(installed, target) {
+		logger.Warningf("upgrading from %s to %s crosses minor versions, check the release notes for breaking changes", installed, target)
+	}
+	return nil
+}
+
+// detectInstallation returns the version and the configuration of the
+// components installed in the namespace.
+func detectInstallation(ctx context.Context, kubeClient client.Client, namespace string) (*installation, error) {
+	var nsObj corev1.Namespace
+	if err := kubeClient.Get(ctx, client.ObjectKey{Name: namespace}, &nsObj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("namespace %s not found, use 'flux install' to install Flux", namespace)
+		}
+		return nil, err
+	}
+
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	var deployments appsv1.DeploymentList
+	if err := kubeClient.List(ctx, &deployments, client.InNamespace(namespace), selector); err != nil {
+		return nil, err
+	}
+	if len(deployments.Items) == 0 {
+		return nil, fmt.Errorf("no Flux components found in the %s namespace, use 'flux install' to install Flux", namespace)
+	}
+
+	result := &installation{
+		version:            nsObj.Labels[manifestgen.VersionLabelKey],
+		watchAllNamespaces: true,
+	}
+	for _, d := range deployments.Items {
+		result.components = append(result.components, d.Name)
+		if result.version == "" {
+			result.version = d.Labels[manifestgen.VersionLabelKey]
+		}
+		podSpec := d.Spec.Template.Spec
+		if len(podSpec.ImagePullSecrets) > 0 {
+			result.imagePullSecret = podSpec.ImagePullSecrets[0].Name
+		}
+		for _, c := range podSpec.Containers {
+			if result.registry == "" {
+				result.registry = imageRegistry(c.Image)
+			}
+			for _, arg := range c.Args {
+				if arg == "--watch-all-namespaces=false" {
+					result.watchAllNamespaces = false
+				}
+			}
+		}
+	}
+
+	var policies networkingv1.NetworkPolicyList
+	if err := kubeClient.List(ctx, &policies, client.InNamespace(namespace), selector); err != nil {
+		return nil, err
+	}
+	result.networkPolicy = len(policies.Items) > 0
+	return result, nil
+}
+
+// imageRegistry returns the registry of the toolkit image, in the form
+// accepted by 'flux install --registry'.
+func imageRegistry(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return path.Dir(image)
+}
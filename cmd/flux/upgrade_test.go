@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+)
+
+func TestImageRegistry(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/fluxcd/source-controller:v0.36.1":                  "ghcr.io/fluxcd",
+		"localhost:5000/fluxcd/source-controller:v0.36.1":           "localhost:5000/fluxcd",
+		"harbor.example.com/mirror/fluxcd/helm-controller@sha256:0": "harbor.example.com/mirror/fluxcd",
+	}
+	for image, want := range tests {
+		if got := imageRegistry(image); got != want {
+			t.Errorf("imageRegistry(%s) = %s, want %s", image, got, want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		installed string
+		target    string
+		wantErr   bool
+	}{
+		{installed: "v0.40.2", target: "v0.41.0"},
+		{installed: "v0.41.0", target: "v0.41.0"},
+		{installed: "v0.41.0", target: "v0.40.2", wantErr: true},
+		{installed: "", target: "v0.41.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := compareVersions(tt.installed, tt.target); (err != nil) != tt.wantErr {
+			t.Errorf("compareVersions(%s, %s) error = %v, wantErr %v", tt.installed, tt.target, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMigrateStoredVersions_NewCRDs(t *testing.T) {
+	// The CRD after the apply of the new manifests, with a new storage
+	// version and the objects stored in the previous one
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "kustomizations.kustomize.toolkit.fluxcd.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: kustomizev1.GroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     kustomizev1.KustomizationKind,
+				ListKind: "KustomizationList",
+				Plural:   "kustomizations",
+			},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1", Served: true},
+				{Name: "v1beta2", Served: true, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1beta1", "v1beta2"}},
+	}
+	ks := &kustomizev1.Kustomization{ObjectMeta: metav1.ObjectMeta{Name: "apps", Namespace: "flux-system"}}
+	kubeClient := fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(crd, ks).Build()
+
+	ctx := context.Background()
+	var crdList apiextensionsv1.CustomResourceDefinitionList
+	if err := kubeClient.List(ctx, &crdList); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateStoredVersions(ctx, kubeClient, crdList.Items, false); err != nil {
+		t.Fatalf("migrateStoredVersions() error = %v", err)
+	}
+
+	var migrated apiextensionsv1.CustomResourceDefinition
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(crd), &migrated); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(migrated.Status.StoredVersions, []string{"v1beta2"}) {
+		t.Errorf("stored versions = %v, want [v1beta2]", migrated.Status.StoredVersions)
+	}
+}
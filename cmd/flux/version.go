@@ -43,6 +43,9 @@ var versionCmd = &cobra.Command{
 
 	# Print information in json format
 	flux version -o json
+
+	# Compare the CLI, cluster and bootstrap repository versions and detect manual changes
+	flux version --drift --path=./clusters/my-cluster
 `,
 	RunE: versionCmdRun,
 }
@@ -50,6 +53,8 @@ var versionCmd = &cobra.Command{
 type versionFlags struct {
 	client bool
 	output string
+	drift  bool
+	path   string
 }
 
 var versionArgs versionFlags
@@ -59,6 +64,10 @@ func init() {
 		"print only client version")
 	versionCmd.Flags().StringVarP(&versionArgs.output, "output", "o", "yaml",
 		"the format in which the information should be printed. can be 'json' or 'yaml'")
+	versionCmd.Flags().BoolVar(&versionArgs.drift, "drift", false,
+		"compare the versions of the CLI, the cluster and the desired manifests, and detect the changes made to the controllers outside of the manifests")
+	versionCmd.Flags().StringVar(&versionArgs.path, "path", "",
+		"path to the cluster directory in a local checkout of the bootstrap repository, used with --drift")
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -66,6 +75,15 @@ func versionCmdRun(cmd *cobra.Command, args []string) error {
 	if versionArgs.output != "yaml" && versionArgs.output != "json" {
 		return fmt.Errorf("--output must be json or yaml, not %s", versionArgs.output)
 	}
+	if versionArgs.drift {
+		if versionArgs.client {
+			return fmt.Errorf("--drift and --client are mutually exclusive")
+		}
+		return versionDriftCmdRun(cmd)
+	}
+	if versionArgs.path != "" {
+		return fmt.Errorf("--path requires --drift")
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fluxcd/pkg/ssa"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/check"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
+)
+
+// versionDriftCmdRun compares the versions of the CLI, of the cluster and of
+// the desired manifests, and detects the changes made to the controllers
+// outside of the desired manifests.
+func versionDriftCmdRun(cmd *cobra.Command) error {
+	output := ""
+	if cmd.Flags().Changed("output") {
+		output = versionArgs.output
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	ns := *kubeconfigArgs.Namespace
+	kubeConfig, err := utils.KubeConfig(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return fmt.Errorf("Kubernetes client initialization failed: %s", err.Error())
+	}
+	kubeClient, err := utils.KubeClient(kubeconfigArgs, kubeclientOptions)
+	if err != nil {
+		return fmt.Errorf("Kubernetes client initialization failed: %s", err.Error())
+	}
+
+	desired, source, err := driftDesiredManifests(ctx, kubeClient, ns, versionArgs.path)
+	if err != nil {
+		return err
+	}
+
+	opts := check.MakeDefaultOptions()
+	opts.Namespace = ns
+	opts.Timeout = rootArgs.timeout
+	checker := check.NewChecker(kubeConfig, kubeClient, opts)
+
+	var results []check.Result
+	report := func(action string, checkResults []check.Result) {
+		results = append(results, checkResults...)
+		if output != "" {
+			return
+		}
+		logger.Actionf(action)
+		for _, r := range checkResults {
+			printCheckResult(r)
+		}
+	}
+
+	action := "comparing the CLI and cluster versions"
+	if source != "" {
+		action = fmt.Sprintf("comparing the CLI and cluster versions with %s", source)
+	}
+	report(action, checker.Versions(ctx, rootArgs.defaults.Version, desired))
+	if len(desired) > 0 {
+		report("detecting changes to the controllers made outside of the manifests", checker.Modifications(ctx, desired))
+	}
+
+	switch output {
+	case "json":
+		return printCheckResults(cmd.OutOrStdout(), results)
+	case "yaml":
+		data, err := yaml.Marshal(struct {
+			Checks []check.Result `json:"checks"`
+			Passed bool           `json:"passed"`
+		}{results, !check.Failed(results)})
+		if err != nil {
+			return err
+		}
+		if _, err := cmd.OutOrStdout().Write(data); err != nil {
+			return err
+		}
+	}
+	if check.Failed(results) {
+		return fmt.Errorf("drift detected")
+	}
+	if output == "" {
+		logger.Successf("no drift detected")
+	}
+	return nil
+}
+
+// driftDesiredManifests returns the manifests the installation is compared
+// with and their description. The manifests are read from the path of the
+// cluster in a local checkout of the bootstrap repository if given, else
+// they are generated from the embedded manifests with the configuration of
+// the installation, if it has the version of the CLI.
+func driftDesiredManifests(ctx context.Context, kubeClient client.Client, namespace, path string) ([]*unstructured.Unstructured, string, error) {
+	if path != "" {
+		objects, err := readBootstrapManifests(path, namespace)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read the manifests in %s: %w", path, err)
+		}
+		return objects, fmt.Sprintf("the manifests in %s", path), nil
+	}
+
+	installed, err := detectInstallation(ctx, kubeClient, namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isEmbeddedVersion(installed.version) {
+		logger.Warningf("the installed version is not %s, use --path to detect the changes made to the controllers", rootArgs.defaults.Version)
+		return nil, "", nil
+	}
+
+	tmpDir, err := manifestgen.MkdirTempAbs("", namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := writeEmbeddedManifests(tmpDir); err != nil {
+		return nil, "", err
+	}
+	manifest, err := install.Generate(installed.installOptions(namespace, installed.version), tmpDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to generate the manifests: %w", err)
+	}
+	objects, err := ssa.ReadObjects(strings.NewReader(manifest.Content))
+	if err != nil {
+		return nil, "", err
+	}
+	return objects, fmt.Sprintf("the %s manifests", installed.version), nil
+}
+
+// readBootstrapManifests returns the objects of the namespace directory
+// written by 'flux bootstrap' at the given path, built with its
+// kustomization.yaml to include the patches. The path can also point
+// directly to the components manifest.
+func readBootstrapManifests(path, namespace string) ([]*unstructured.Unstructured, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch {
+	case !fi.IsDir():
+		data, err = os.ReadFile(path)
+	default:
+		dir := filepath.Join(path, namespace)
+		if _, statErr := os.Stat(filepath.Join(dir, "kustomization.yaml")); statErr == nil {
+			data, err = kustomization.BuildWithRoot(path, dir)
+		} else {
+			data, err = os.ReadFile(filepath.Join(dir, install.MakeDefaultOptions().ManifestFile))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssa.ReadObjects(bytes.NewReader(data))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReadBootstrapManifests(t *testing.T) {
+	components := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+  namespace: flux-system
+spec:
+  replicas: 1
+`
+	kustomizationFile := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- gotk-components.yaml
+patches:
+- target:
+    kind: Deployment
+    name: source-controller
+  patch: |
+    - op: replace
+      path: /spec/replicas
+      value: 2
+`
+	clusterDir := t.TempDir()
+	dir := filepath.Join(clusterDir, "flux-system")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	componentsFile := filepath.Join(dir, "gotk-components.yaml")
+	if err := os.WriteFile(componentsFile, []byte(components), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	replicas := func(path string) int64 {
+		t.Helper()
+		objects, err := readBootstrapManifests(path, "flux-system")
+		if err != nil {
+			t.Fatalf("readBootstrapManifests() error = %v", err)
+		}
+		if len(objects) != 1 {
+			t.Fatalf("got %d objects, want 1", len(objects))
+		}
+		n, _, _ := unstructured.NestedInt64(objects[0].Object, "spec", "replicas")
+		return n
+	}
+
+	if got := replicas(clusterDir); got != 1 {
+		t.Errorf("replicas = %d, want 1", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(kustomizationFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := replicas(clusterDir); got != 2 {
+		t.Errorf("replicas with patches = %d, want 2", got)
+	}
+	if got := replicas(componentsFile); got != 1 {
+		t.Errorf("replicas of the components file = %d, want 1", got)
+	}
+}
@@ -0,0 +1,498 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	ociclient "github.com/fluxcd/pkg/oci/client"
+	"github.com/fluxcd/pkg/ssa"
+)
+
+const (
+	// InventoryMediaType is the media type of the SBOM layer listing the
+	// Kubernetes objects contained in an artifact.
+	InventoryMediaType types.MediaType = "application/vnd.fluxcd.inventory.v1+json"
+	// DSSEMediaType is the media type of the attestation layers, holding
+	// an in-toto statement in a DSSE envelope.
+	DSSEMediaType types.MediaType = "application/vnd.dsse.envelope.v1+json"
+	// PredicateTypeAnnotation is the annotation of the attestation layers
+	// holding the predicate type of the statement.
+	PredicateTypeAnnotation = "predicateType"
+	// ProvenancePredicateType is the predicate type of the SLSA provenance.
+	ProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+	provenanceBuildType = "https://fluxcd.io/flux/cmd/flux_push_artifact/"
+)
+
+// ErrSubjectMismatch is returned when an attestation statement is not about
+// the artifact it is attached to.
+var ErrSubjectMismatch = errors.New("no statement subject matching the artifact digest found")
+
+// Statement is an in-toto statement about an artifact.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject is the artifact an in-toto statement is about.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is the SLSA provenance predicate of an artifact pushed with
+// the CLI.
+type Provenance struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		ConfigSource Material `json:"configSource"`
+	} `json:"invocation"`
+	Metadata struct {
+		BuildFinishedOn string `json:"buildFinishedOn,omitempty"`
+		Reproducible    bool   `json:"reproducible"`
+	} `json:"metadata"`
+	Materials []Material `json:"materials"`
+}
+
+// Material is a source an artifact is built from.
+type Material struct {
+	URI        string            `json:"uri"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+// Attestation is an SBOM or an attestation attached to an artifact.
+type Attestation struct {
+	// MediaType is the media type of the SBOM or of the attestation layer.
+	MediaType string `json:"mediaType"`
+	// PredicateType is the predicate type of the attestation statement.
+	PredicateType string `json:"predicateType,omitempty"`
+	// Content is the SBOM or the in-toto statement of the attestation.
+	Content json.RawMessage `json:"content"`
+	// Signed is true if the attestation envelope has signatures.
+	Signed bool `json:"signed"`
+
+	envelope *envelope
+}
+
+// Verify verifies that the attestation is signed with the public key, and
+// that its statement is about the artifact of the given digest URL.
+func (a Attestation) Verify(key crypto.PublicKey, digestURL string) error {
+	if a.envelope == nil {
+		return fmt.Errorf("%s is not signed", a.MediaType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(a.envelope.Payload)
+	if err != nil {
+		return err
+	}
+	for _, s := range a.envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if verifyPayload(key, pae(a.envelope.PayloadType, payload), sig) == nil {
+			return a.VerifySubject(digestURL)
+		}
+	}
+	return ErrNoSignature
+}
+
+// VerifySubject verifies that the attestation statement is about the
+// artifact of the given digest URL, returning ErrSubjectMismatch if none of
+// the subject digests matches.
+func (a Attestation) VerifySubject(digestURL string) error {
+	if a.envelope == nil {
+		return fmt.Errorf("%s is not an attestation", a.MediaType)
+	}
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	algorithm, hex, _ := strings.Cut(ref.DigestStr(), ":")
+
+	var statement Statement
+	if err := json.Unmarshal(a.Content, &statement); err != nil {
+		return fmt.Errorf("invalid attestation statement: %w", err)
+	}
+	for _, subject := range statement.Subject {
+		if subject.Digest[algorithm] == hex {
+			return nil
+		}
+	}
+	return ErrSubjectMismatch
+}
+
+// envelope is a DSSE envelope.
+type envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     string              `json:"payload"`
+	Signatures  []envelopeSignature `json:"signatures"`
+}
+
+type envelopeSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// attestationTag returns the tag of the cosign attestations of the artifact
+// with the given digest.
+func attestationTag(digest string) string {
+	return strings.TrimSuffix(SignatureTag(digest), ".sig") + ".att"
+}
+
+// sbomTag returns the tag of the cosign SBOM of the artifact with the given
+// digest.
+func sbomTag(digest string) string {
+	return strings.TrimSuffix(SignatureTag(digest), ".sig") + ".sbom"
+}
+
+// pae returns the DSSE pre-authentication encoding of the payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Inventory returns the Kubernetes objects of the YAML files contained in
+// the artifact tarball, the files that are not Kubernetes manifests and the
+// kustomize configurations are skipped.
+func Inventory(artifactPath string) (*kustomizev1.ResourceInventory, error) {
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	inventory := &kustomizev1.ResourceInventory{Entries: []kustomizev1.ResourceRef{}}
+	seen := map[string]bool{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ext := strings.ToLower(filepath.Ext(header.Name))
+		if header.Typeflag != tar.TypeReg || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		objects, err := ssa.ReadObjects(tr)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if obj.GetName() == "" || strings.HasPrefix(obj.GetAPIVersion(), "kustomize.config.k8s.io/") {
+				continue
+			}
+			id := object.UnstructuredToObjMetadata(obj).String()
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			inventory.Entries = append(inventory.Entries, kustomizev1.ResourceRef{
+				ID:      id,
+				Version: obj.GroupVersionKind().Version,
+			})
+		}
+	}
+	sort.Slice(inventory.Entries, func(i, j int) bool {
+		return inventory.Entries[i].ID < inventory.Entries[j].ID
+	})
+	return inventory, nil
+}
+
+// ProvenanceStatement returns the SLSA provenance statement of the artifact
+// of the given digest URL, built by the given builder from the source and
+// revision of the metadata.
+func ProvenanceStatement(digestURL, builder, entryPoint string, meta ociclient.Metadata, reproducible bool) (*Statement, error) {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest URL: %w", err)
+	}
+	algorithm, hex, _ := strings.Cut(ref.DigestStr(), ":")
+
+	var predicate Provenance
+	predicate.Builder.ID = builder
+	predicate.BuildType = provenanceBuildType
+	material := Material{URI: meta.Source}
+	if i := strings.LastIndex(meta.Revision, "@"); i >= 0 {
+		if algo, sum, ok := strings.Cut(meta.Revision[i+1:], ":"); ok {
+			material.Digest = map[string]string{algo: sum}
+		}
+	}
+	predicate.Materials = []Material{material}
+	material.EntryPoint = entryPoint
+	predicate.Invocation.ConfigSource = material
+	predicate.Metadata.BuildFinishedOn = meta.Created
+	predicate.Metadata.Reproducible = reproducible
+
+	data, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Type: inTotoStatementType,
+		Subject: []Subject{{
+			Name:   ref.Context().String(),
+			Digest: map[string]string{algorithm: hex},
+		}},
+		PredicateType: ProvenancePredicateType,
+		Predicate:     data,
+	}, nil
+}
+
+// AttachSBOM stores the SBOM of the artifact of the given digest URL in
+// the cosign format, replacing the existing one.
+func (c *Client) AttachSBOM(ctx context.Context, digestURL string, mediaType types.MediaType, data []byte) error {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	subject, err := c.subject(ctx, ref)
+	if err != nil {
+		return err
+	}
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer: static.NewLayer(data, mediaType),
+	})
+	if err != nil {
+		return err
+	}
+	sbomURL := ref.Context().Tag(sbomTag(ref.DigestStr())).String()
+	if err := crane.Push(withSubject(img, subject), sbomURL, c.optionsWithContext(ctx)...); err != nil {
+		return fmt.Errorf("pushing SBOM failed: %w", err)
+	}
+	return nil
+}
+
+// Attest stores the statement about the artifact of the given digest URL
+// in a DSSE envelope in the cosign format, signed with the key if not nil.
+// The attestations of the same predicate type are replaced.
+func (c *Client) Attest(ctx context.Context, digestURL string, statement *Statement, key crypto.Signer) error {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	subject, err := c.subject(ctx, ref)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+	env := envelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []envelopeSignature{},
+	}
+	if key != nil {
+		sig, err := signPayload(key, pae(inTotoPayloadType, payload))
+		if err != nil {
+			return fmt.Errorf("signing attestation failed: %w", err)
+		}
+		env.Signatures = append(env.Signatures, envelopeSignature{Sig: base64.StdEncoding.EncodeToString(sig)})
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	attURL := ref.Context().Tag(attestationTag(ref.DigestStr())).String()
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	existing, err := crane.Pull(attURL, c.optionsWithContext(ctx)...)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("fetching attestations failed: %w", err)
+	}
+	if existing != nil {
+		manifest, err := existing.Manifest()
+		if err != nil {
+			return err
+		}
+		for _, desc := range manifest.Layers {
+			if desc.Annotations[PredicateTypeAnnotation] == statement.PredicateType {
+				continue
+			}
+			layer, err := existing.LayerByDigest(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, Annotations: desc.Annotations}); err != nil {
+				return err
+			}
+		}
+	}
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer:       static.NewLayer(data, DSSEMediaType),
+		Annotations: map[string]string{PredicateTypeAnnotation: statement.PredicateType},
+	})
+	if err != nil {
+		return err
+	}
+	if err := crane.Push(withSubject(img, subject), attURL, c.optionsWithContext(ctx)...); err != nil {
+		return fmt.Errorf("pushing attestation failed: %w", err)
+	}
+	return nil
+}
+
+// subject returns the descriptor of the artifact of the given digest.
+func (c *Client) subject(ctx context.Context, ref name.Digest) (gcrv1.Descriptor, error) {
+	desc, err := crane.Head(ref.String(), c.optionsWithContext(ctx)...)
+	if err != nil {
+		return gcrv1.Descriptor{}, fmt.Errorf("fetching %s failed: %w", ref, err)
+	}
+	return gcrv1.Descriptor{MediaType: desc.MediaType, Size: desc.Size, Digest: desc.Digest}, nil
+}
+
+// subjectImage is an image with the subject field set in its manifest, for
+// the registries implementing the OCI referrers API to list it as a
+// referrer of the subject, in addition to the cosign tag scheme.
+type subjectImage struct {
+	gcrv1.Image
+	subject gcrv1.Descriptor
+}
+
+// withSubject returns the image with the subject set in its manifest, the
+// Manifest method of the returned image doesn't include the subject.
+func withSubject(img gcrv1.Image, subject gcrv1.Descriptor) gcrv1.Image {
+	return &subjectImage{Image: img, subject: subject}
+}
+
+// RawManifest returns the manifest of the image with the subject field.
+func (i *subjectImage) RawManifest() ([]byte, error) {
+	raw, err := i.Image.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest["subject"], err = json.Marshal(i.subject); err != nil {
+		return nil, err
+	}
+	return json.Marshal(manifest)
+}
+
+// Digest returns the digest of the manifest with the subject field.
+func (i *subjectImage) Digest() (gcrv1.Hash, error) {
+	return partial.Digest(i)
+}
+
+// Size returns the size of the manifest with the subject field.
+func (i *subjectImage) Size() (int64, error) {
+	return partial.Size(i)
+}
+
+// Attestations returns the SBOM and the attestations of the artifact of the
+// given digest URL.
+func (c *Client) Attestations(ctx context.Context, digestURL string) ([]Attestation, error) {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest URL: %w", err)
+	}
+
+	var result []Attestation
+	for _, tag := range []string{sbomTag(ref.DigestStr()), attestationTag(ref.DigestStr())} {
+		img, err := crane.Pull(ref.Context().Tag(tag).String(), c.optionsWithContext(ctx)...)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("fetching %s failed: %w", tag, err)
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range manifest.Layers {
+			data, err := layerContent(img, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			a := Attestation{MediaType: string(desc.MediaType), Content: data}
+			if desc.MediaType == DSSEMediaType {
+				var env envelope
+				if err := json.Unmarshal(data, &env); err != nil {
+					return nil, fmt.Errorf("invalid attestation envelope: %w", err)
+				}
+				payload, err := base64.StdEncoding.DecodeString(env.Payload)
+				if err != nil {
+					return nil, fmt.Errorf("invalid attestation payload: %w", err)
+				}
+				a.Content = payload
+				a.PredicateType = desc.Annotations[PredicateTypeAnnotation]
+				a.Signed = len(env.Signatures) > 0
+				a.envelope = &env
+			}
+			if !json.Valid(a.Content) {
+				return nil, fmt.Errorf("%s content is not JSON", desc.MediaType)
+			}
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+func layerContent(img gcrv1.Image, digest gcrv1.Hash) ([]byte, error) {
+	layer, err := img.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
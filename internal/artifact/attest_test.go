@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+func TestInventory(t *testing.T) {
+	files := map[string]string{
+		"deploy.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  namespace: apps
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: podinfo
+  namespace: apps
+`,
+		"kustomization.yaml": "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- deploy.yaml\n",
+		"values.yaml":        "replicas: 2\n",
+		"README.md":          "# podinfo\n",
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarball := filepath.Join(t.TempDir(), "artifact.tgz")
+	if err := Build(tarball, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	inventory, err := Inventory(tarball)
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	var got []string
+	for _, e := range inventory.Entries {
+		got = append(got, e.ID+" "+e.Version)
+	}
+	want := []string{"apps_podinfo__Service v1", "apps_podinfo_apps_Deployment v1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inventory() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_Attest(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	digestURL := pushTestArtifact(t, c, fmt.Sprintf("%s/config/app:v1", u.Host))
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.AttachSBOM(ctx, digestURL, InventoryMediaType, []byte(`{"entries":[]}`)); err != nil {
+		t.Fatalf("AttachSBOM() error = %v", err)
+	}
+	meta := ociclient.Metadata{
+		Created:  "2023-01-01T00:00:00Z",
+		Source:   "https://github.com/org/config",
+		Revision: "main@sha1:6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6",
+	}
+	statement, err := ProvenanceStatement(digestURL, "https://github.com/fluxcd/flux2", "./deploy", meta, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// attesting twice replaces the provenance
+	for i := 0; i < 2; i++ {
+		if err := c.Attest(ctx, digestURL, statement, key); err != nil {
+			t.Fatalf("Attest() error = %v", err)
+		}
+	}
+
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{sbomTag(ref.DigestStr()), attestationTag(ref.DigestStr())} {
+		raw, err := crane.Manifest(ref.Context().Tag(tag).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest struct {
+			Subject *gcrv1.Descriptor `json:"subject"`
+		}
+		if err := json.Unmarshal(raw, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if manifest.Subject == nil || manifest.Subject.Digest.String() != ref.DigestStr() || manifest.Subject.Size == 0 {
+			t.Errorf("%s manifest subject = %+v, want the artifact descriptor", tag, manifest.Subject)
+		}
+	}
+
+	attestations, err := c.Attestations(ctx, digestURL)
+	if err != nil {
+		t.Fatalf("Attestations() error = %v", err)
+	}
+	if len(attestations) != 2 {
+		t.Fatalf("Attestations() returned %d attestations, want 2", len(attestations))
+	}
+	if attestations[0].MediaType != string(InventoryMediaType) {
+		t.Errorf("first attestation is %s, want the inventory", attestations[0].MediaType)
+	}
+
+	provenance := attestations[1]
+	if provenance.PredicateType != ProvenancePredicateType || !provenance.Signed {
+		t.Errorf("unexpected provenance %+v", provenance)
+	}
+	if err := provenance.Verify(&key.PublicKey, digestURL); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := provenance.Verify(&other.PublicKey, digestURL); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Verify() with another key error = %v", err)
+	}
+
+	// a signed statement about another artifact attached to this one
+	otherStatement := *statement
+	otherStatement.Subject = []Subject{{
+		Name:   statement.Subject[0].Name,
+		Digest: map[string]string{"sha256": strings.Repeat("0", 64)},
+	}}
+	if err := c.Attest(ctx, digestURL, &otherStatement, key); err != nil {
+		t.Fatalf("Attest() error = %v", err)
+	}
+	attestations, err = c.Attestations(ctx, digestURL)
+	if err != nil {
+		t.Fatalf("Attestations() error = %v", err)
+	}
+	if err := attestations[1].Verify(&key.PublicKey, digestURL); !errors.Is(err, ErrSubjectMismatch) {
+		t.Errorf("Verify() of a statement about another artifact error = %v", err)
+	}
+	if err := attestations[1].VerifySubject(digestURL); !errors.Is(err, ErrSubjectMismatch) {
+		t.Errorf("VerifySubject() of a statement about another artifact error = %v", err)
+	}
+
+	var got Statement
+	if err := json.Unmarshal(provenance.Content, &got); err != nil {
+		t.Fatal(err)
+	}
+	var predicate Provenance
+	if err := json.Unmarshal(got.Predicate, &predicate); err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject[0].Name != fmt.Sprintf("%s/config/app", u.Host) || got.Subject[0].Digest["sha256"] == "" {
+		t.Errorf("unexpected subject %+v", got.Subject)
+	}
+	if src := predicate.Invocation.ConfigSource; src.URI != meta.Source || src.Digest["sha1"] != "6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6" || src.EntryPoint != "./deploy" {
+		t.Errorf("unexpected config source %+v", src)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/sourceignore"
+)
+
+const (
+	// BuildPathAnnotation is the annotation holding the path of the
+	// kustomize overlay built into the artifact.
+	BuildPathAnnotation = "build.toolkit.fluxcd.io/path"
+	// BuildRevisionAnnotation is the annotation holding the source revision
+	// of the kustomize overlay built into the artifact.
+	BuildRevisionAnnotation = "build.toolkit.fluxcd.io/revision"
+)
+
+// epoch is the modification time of all the entries of an artifact.
+var epoch = time.Unix(0, 0).UTC()
+
+// Build archives the given directory, or the single file, as a gzip tarball
+// to the given local path. The tarball is reproducible, the same files
+// produce the same bytes: the entries are sorted by path, their modification
+// time is the Unix epoch, their owner is root, their mode is 0755 for the
+// directories and the executable files and 0644 for the other files.
+func Build(artifactPath, sourceDir string, ignorePaths []string) error {
+	absDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return err
+	}
+	dirStat, err := os.Stat(absDir)
+	if err != nil {
+		return fmt.Errorf("invalid source dir path: %s", absDir)
+	}
+
+	entries, err := listEntries(absDir, dirStat, ignorePaths)
+	if err != nil {
+		return err
+	}
+
+	tf, err := os.CreateTemp(filepath.Dir(artifactPath), filepath.Base(artifactPath)+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := tf.Name()
+	if err := writeArchive(tf, entries); err != nil {
+		tf.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0o640); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, artifactPath)
+}
+
+// entry is a file or a directory of an artifact.
+type entry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+// listEntries returns the files and directories to archive, sorted by
+// their name in the archive.
+func listEntries(absDir string, dirStat fs.FileInfo, ignorePaths []string) ([]entry, error) {
+	if !dirStat.IsDir() {
+		if !dirStat.Mode().IsRegular() {
+			return nil, fmt.Errorf("invalid source path %s, must be a directory or a regular file", absDir)
+		}
+		return []entry{{name: filepath.Base(absDir), path: absDir, info: dirStat}}, nil
+	}
+
+	ignore := strings.Join(ignorePaths, "\n")
+	domain := strings.Split(filepath.Clean(absDir), string(filepath.Separator))
+	matcher := sourceignore.NewMatcher(sourceignore.ReadPatterns(strings.NewReader(ignore), domain))
+
+	var entries []entry
+	err := filepath.Walk(absDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Ignore anything that is not a file or directories e.g. symlinks
+		if m := fi.Mode(); !(m.IsRegular() || m.IsDir()) {
+			return nil
+		}
+		if len(ignorePaths) > 0 && matcher.Match(strings.Split(p, string(filepath.Separator)), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(absDir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		entries = append(entries, entry{name: filepath.ToSlash(rel), path: p, info: fi})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+func writeArchive(w io.Writer, entries []entry) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		if err := writeEntry(tw, e); err != nil {
+			tw.Close()
+			gw.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+func writeEntry(tw *tar.Writer, e entry) error {
+	header := &tar.Header{
+		Name:    e.name,
+		ModTime: epoch,
+		Format:  tar.FormatPAX,
+	}
+	if e.info.IsDir() {
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		header.Mode = 0o755
+		return tw.WriteHeader(header)
+	}
+
+	header.Typeflag = tar.TypeReg
+	header.Mode = 0o644
+	if e.info.Mode()&0o111 != 0 {
+		header.Mode = 0o755
+	}
+	header.Size = e.info.Size()
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(tw, f, e.info.Size()); err != nil {
+		return err
+	}
+	return nil
+}
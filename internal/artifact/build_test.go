@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTestFiles(t *testing.T, dir string, mode os.FileMode, mtime time.Time) {
+	t.Helper()
+	files := map[string]string{
+		"deploy/app.yaml":     "kind: Deployment\n",
+		"deploy/svc.yaml":     "kind: Service\n",
+		"kustomization.yaml":  "resources:\n- deploy\n",
+		"scripts/validate.sh": "#!/bin/sh\n",
+		".git/config":         "[core]\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		fileMode := mode
+		if filepath.Ext(name) == ".sh" {
+			fileMode |= 0o100
+		}
+		if err := os.WriteFile(p, []byte(content), fileMode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, fileMode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuild_Reproducible(t *testing.T) {
+	ignore := []string{".git/"}
+
+	dir1 := t.TempDir()
+	writeTestFiles(t, dir1, 0o600, time.Now())
+	dir2 := t.TempDir()
+	writeTestFiles(t, dir2, 0o664, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	out := t.TempDir()
+	artifact1 := filepath.Join(out, "artifact1.tgz")
+	artifact2 := filepath.Join(out, "artifact2.tgz")
+	if err := Build(artifact1, dir1, ignore); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if err := Build(artifact2, dir2, ignore); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	b1, err := os.ReadFile(artifact1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := os.ReadFile(artifact2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Fatalf("artifacts of the same files differ")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(b1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(epoch) || hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s has a non-normalized header: %+v", hdr.Name, hdr)
+		}
+		wantMode := int64(0o644)
+		if hdr.Typeflag == tar.TypeDir || hdr.Name == "scripts/validate.sh" {
+			wantMode = 0o755
+		}
+		if hdr.Mode != wantMode {
+			t.Errorf("%s mode = %o, want %o", hdr.Name, hdr.Mode, wantMode)
+		}
+	}
+	want := []string{"deploy/", "deploy/app.yaml", "deploy/svc.yaml", "kustomization.yaml", "scripts/", "scripts/validate.sh"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+}
+
+func TestBuild_SingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, 0o600, time.Now())
+	out := filepath.Join(t.TempDir(), "artifact.tgz")
+	if err := Build(out, filepath.Join(dir, "kustomization.yaml"), nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := tar.NewReader(gr).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "kustomization.yaml" {
+		t.Errorf("entry = %s, want kustomization.yaml", hdr.Name)
+	}
+}
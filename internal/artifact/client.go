@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/fluxcd/pkg/oci"
+	"github.com/fluxcd/pkg/oci/auth/aws"
+	"github.com/fluxcd/pkg/oci/auth/azure"
+	"github.com/fluxcd/pkg/oci/auth/gcp"
+)
+
+// Client holds the options for accessing remote OCI registries.
+type Client struct {
+	options []crane.Option
+}
+
+// NewClient returns an OCI client configured with the Docker keychain
+// helpers and the given crane options.
+func NewClient(opts ...crane.Option) *Client {
+	options := []crane.Option{
+		crane.WithUserAgent(oci.UserAgent),
+		crane.WithPlatform(&gcrv1.Platform{
+			Architecture: "flux",
+			OS:           "flux",
+			OSVersion:    "v2",
+		}),
+	}
+	return &Client{options: append(options, opts...)}
+}
+
+// LoginWithCredentials configures the client with static credentials,
+// accepts a single token or a user:password format.
+func (c *Client) LoginWithCredentials(credentials string) error {
+	if credentials == "" {
+		return errors.New("credentials cannot be empty")
+	}
+
+	var authConfig authn.AuthConfig
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) == 1 {
+		authConfig = authn.AuthConfig{RegistryToken: parts[0]}
+	} else {
+		authConfig = authn.AuthConfig{Username: parts[0], Password: parts[1]}
+	}
+
+	c.options = append(c.options, crane.WithAuth(authn.FromConfig(authConfig)))
+	return nil
+}
+
+// LoginWithProvider configures the client to log in to the registry of the
+// given URL with the credentials of the specified provider.
+func (c *Client) LoginWithProvider(ctx context.Context, url string, provider oci.Provider) error {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return fmt.Errorf("could not create reference from url '%s': %w", url, err)
+	}
+
+	var authenticator authn.Authenticator
+	switch provider {
+	case oci.ProviderAWS:
+		authenticator, err = aws.NewClient().Login(ctx, true, url)
+	case oci.ProviderGCP:
+		authenticator, err = gcp.NewClient().Login(ctx, true, url, ref)
+	case oci.ProviderAzure:
+		authenticator, err = azure.NewClient().Login(ctx, true, url, ref)
+	default:
+		return errors.New("unsupported provider")
+	}
+	if err != nil {
+		return fmt.Errorf("could not login to provider %v with url %s: %w", provider, url, err)
+	}
+
+	c.options = append(c.options, crane.WithAuth(authenticator))
+	return nil
+}
+
+// optionsWithContext returns the crane options for the given context.
+func (c *Client) optionsWithContext(ctx context.Context) []crane.Option {
+	options := []crane.Option{
+		crane.WithContext(ctx),
+	}
+	return append(options, c.options...)
+}
+
+// isNotFound returns true if the registry responded that the artifact
+// doesn't exist.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
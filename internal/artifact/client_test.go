@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+func TestClient_LoginWithCredentials(t *testing.T) {
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "flux" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := fmt.Sprintf("%s/config/app:v1", u.Host)
+
+	c := NewClient()
+	if err := c.LoginWithCredentials(""); err == nil {
+		t.Error("expected an error for empty credentials")
+	}
+	if err := c.LoginWithCredentials("flux:secret"); err != nil {
+		t.Fatal(err)
+	}
+	pushTestArtifact(t, c, ref)
+
+	if _, err := NewClient().Digest(context.Background(), ref); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestClient_UpstreamCompatibility(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	upstream := ociclient.NewLocalClient()
+
+	ref := fmt.Sprintf("%s/config/app:v1", u.Host)
+	pushTestArtifact(t, c, ref)
+	meta, err := upstream.Pull(ctx, ref, t.TempDir())
+	if err != nil {
+		t.Fatalf("upstream Pull() error = %v", err)
+	}
+	if meta.Revision != "main@sha1:6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6" {
+		t.Errorf("upstream Pull() revision = %s", meta.Revision)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("kind: Deployment\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref = fmt.Sprintf("%s/config/app:v2", u.Host)
+	if _, err := upstream.Push(ctx, ref, dir, ociclient.Metadata{Revision: "v2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	meta, err = c.Pull(ctx, ref, outDir, PullOptions{})
+	if err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if meta.Revision != "v2" {
+		t.Errorf("Pull() revision = %s, want v2", meta.Revision)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "app.yaml")); err != nil {
+		t.Errorf("Pull() didn't extract the files of the upstream client: %v", err)
+	}
+
+	tags, err := c.List(ctx, fmt.Sprintf("%s/config/app", u.Host), ociclient.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamTags, err := upstream.List(ctx, fmt.Sprintf("%s/config/app", u.Host), ociclient.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != len(upstreamTags) {
+		t.Fatalf("List() = %d tags, upstream %d", len(tags), len(upstreamTags))
+	}
+	for i := range tags {
+		if tags[i].Digest != upstreamTags[i].Digest {
+			t.Errorf("List() tag %d digest = %s, upstream %s", i, tags[i].Digest, upstreamTags[i].Digest)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+)
+
+// RefNameAnnotation is the annotation of the OCI image layout index holding
+// the tag of a manifest.
+const RefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Location is the source or the destination of a copy, either an artifact
+// URL of a remote repository or a local OCI image layout directory.
+type Location struct {
+	// Client accesses the remote repository.
+	Client *Client
+	// URL is the artifact URL with a tag or a digest, the tag of the source
+	// is used if the destination URL has none.
+	URL string
+	// Layout is the path of the OCI image layout directory, it takes
+	// precedence over the URL.
+	Layout string
+}
+
+// referrerTags returns the tags of the cosign signatures, attestations and
+// SBOM of the artifact of the given digest.
+func referrerTags(digest string) []string {
+	return []string{SignatureTag(digest), attestationTag(digest), sbomTag(digest)}
+}
+
+// Copy copies the artifact and its cosign signatures, attestations and SBOM
+// from src to dst without altering the manifests, so the digest and the
+// annotations are preserved and the signatures remain valid. The artifact of
+// a layout source is selected by the tag of the destination URL, or is the
+// single artifact of the layout. It returns the digest of the artifact.
+func Copy(ctx context.Context, src, dst Location) (string, error) {
+	dstTag, hasTag := "", false
+	if dst.Layout == "" {
+		ref, err := name.ParseReference(dst.URL, name.StrictValidation)
+		if tag, ok := ref.(name.Tag); err == nil && ok {
+			dstTag, hasTag = tag.TagStr(), true
+		}
+	}
+	img, tag, err := src.artifact(ctx, dstTag)
+	if err != nil {
+		return "", err
+	}
+	if !hasTag {
+		dstTag = tag
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	if err := dst.write(ctx, img, dstTag); err != nil {
+		return "", err
+	}
+
+	for _, rt := range referrerTags(digest.String()) {
+		referrer, err := src.referrer(ctx, rt)
+		if err != nil {
+			return "", err
+		}
+		if referrer == nil {
+			continue
+		}
+		if err := dst.write(ctx, referrer, rt); err != nil {
+			return "", err
+		}
+	}
+	return digest.String(), nil
+}
+
+// artifact returns the artifact of the location and its tag, if any.
+func (l Location) artifact(ctx context.Context, hint string) (gcrv1.Image, string, error) {
+	if l.Layout == "" {
+		ref, err := name.ParseReference(l.URL)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid URL: %w", err)
+		}
+		img, err := crane.Pull(l.URL, l.Client.optionsWithContext(ctx)...)
+		if err != nil {
+			return nil, "", fmt.Errorf("pulling artifact failed: %w", err)
+		}
+		if tag, ok := ref.(name.Tag); ok {
+			return img, tag.TagStr(), nil
+		}
+		return img, "", nil
+	}
+
+	p, err := layout.FromPath(l.Layout)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading the OCI layout failed: %w", err)
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, "", err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, "", err
+	}
+	var artifacts []gcrv1.Descriptor
+	for _, desc := range manifest.Manifests {
+		tag := desc.Annotations[RefNameAnnotation]
+		if isSignatureTag(tag) {
+			continue
+		}
+		if hint != "" && tag == hint {
+			artifacts = []gcrv1.Descriptor{desc}
+			break
+		}
+		artifacts = append(artifacts, desc)
+	}
+	if len(artifacts) != 1 {
+		return nil, "", fmt.Errorf("%s contains %d artifacts, the destination URL must have the tag of the artifact to copy", l.Layout, len(artifacts))
+	}
+	img, err := p.Image(artifacts[0].Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, artifacts[0].Annotations[RefNameAnnotation], nil
+}
+
+// referrer returns the image of the given referrer tag, or nil if the
+// location doesn't have it.
+func (l Location) referrer(ctx context.Context, tag string) (gcrv1.Image, error) {
+	if l.Layout == "" {
+		ref, err := name.ParseReference(l.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL: %w", err)
+		}
+		img, err := crane.Pull(ref.Context().Tag(tag).String(), l.Client.optionsWithContext(ctx)...)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("fetching %s failed: %w", tag, err)
+		}
+		return img, nil
+	}
+
+	p, err := layout.FromPath(l.Layout)
+	if err != nil {
+		return nil, err
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range manifest.Manifests {
+		if desc.Annotations[RefNameAnnotation] == tag {
+			return p.Image(desc.Digest)
+		}
+	}
+	return nil, nil
+}
+
+// write writes the image with the given tag, or by digest if the tag is
+// empty.
+func (l Location) write(ctx context.Context, img gcrv1.Image, tag string) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	if l.Layout == "" {
+		ref, err := name.ParseReference(l.URL)
+		if err != nil {
+			return fmt.Errorf("invalid URL: %w", err)
+		}
+		target := ref.Context().Digest(digest.String()).String()
+		if tag != "" {
+			target = ref.Context().Tag(tag).String()
+		}
+		if err := crane.Push(img, target, l.Client.optionsWithContext(ctx)...); err != nil {
+			return fmt.Errorf("pushing to %s failed: %w", target, err)
+		}
+		return nil
+	}
+
+	p, err := layout.FromPath(l.Layout)
+	if errors.Is(err, os.ErrNotExist) {
+		p, err = layout.Write(l.Layout, empty.Index)
+	}
+	if err != nil {
+		return fmt.Errorf("opening the OCI layout failed: %w", err)
+	}
+	if tag == "" {
+		return p.ReplaceImage(img, match.Digests(digest))
+	}
+	return p.ReplaceImage(img, match.Name(tag), layout.WithAnnotations(map[string]string{RefNameAnnotation: tag}))
+}
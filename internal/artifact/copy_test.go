@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestCopy(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	digestURL := pushTestArtifact(t, c, fmt.Sprintf("%s/staging/app:v1", u.Host))
+	digest := digestURL[strings.LastIndex(digestURL, "@")+1:]
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Sign(ctx, digestURL, key); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	steps := []struct {
+		name string
+		src  Location
+		dst  Location
+		want string
+	}{
+		{
+			name: "registry to layout",
+			src:  Location{Client: c, URL: fmt.Sprintf("%s/staging/app:v1", u.Host)},
+			dst:  Location{Layout: dir},
+			want: fmt.Sprintf("%s/staging/app@%s", u.Host, digest),
+		},
+		{
+			name: "layout to registry",
+			src:  Location{Layout: dir},
+			dst:  Location{Client: c, URL: fmt.Sprintf("%s/production/app", u.Host)},
+			want: fmt.Sprintf("%s/production/app@%s", u.Host, digest),
+		},
+		{
+			name: "registry to registry with another tag",
+			src:  Location{Client: c, URL: fmt.Sprintf("%s/production/app:v1", u.Host)},
+			dst:  Location{Client: c, URL: fmt.Sprintf("%s/production/app:stable", u.Host)},
+			want: fmt.Sprintf("%s/production/app:stable", u.Host),
+		},
+	}
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Copy(ctx, tt.src, tt.dst)
+			if err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			if got != digest {
+				t.Errorf("Copy() digest = %s, want %s", got, digest)
+			}
+			if tt.dst.Layout != "" {
+				return
+			}
+			copied, err := c.Digest(ctx, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(copied, digest) {
+				t.Errorf("copied digest = %s, want %s", copied, digest)
+			}
+			if err := c.Verify(ctx, copied, key.Public()); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+
+	pushTestArtifact(t, c, fmt.Sprintf("%s/staging/other:v2", u.Host))
+	if _, err := Copy(ctx, Location{Client: c, URL: fmt.Sprintf("%s/staging/other:v2", u.Host)}, Location{Layout: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(ctx, Location{Layout: dir}, Location{Client: c, URL: fmt.Sprintf("%s/production/other", u.Host)}); err == nil {
+		t.Errorf("expected an error for a layout with several artifacts and no tag")
+	}
+	if _, err := Copy(ctx, Location{Layout: dir}, Location{Client: c, URL: fmt.Sprintf("%s/production/other:v2", u.Host)}); err != nil {
+		t.Errorf("Copy() error = %v", err)
+	}
+}
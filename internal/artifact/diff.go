@@ -0,0 +1,225 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gonvenience/ytbx"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/homeport/dyff/pkg/dyff"
+
+	"github.com/fluxcd/pkg/untar"
+
+	"github.com/fluxcd/flux2/pkg/printers"
+)
+
+// FileDiff is a file that differs between a remote artifact and the local
+// files.
+type FileDiff struct {
+	// Path is the slash separated path of the file in the artifact.
+	Path string
+	// Remote is the content of the file in the artifact, nil if the file
+	// is not in the artifact.
+	Remote []byte
+	// Local is the content of the local file, nil if the file doesn't
+	// exist locally.
+	Local []byte
+}
+
+// Diff compares the content of the artifact at the given URL with the
+// local files in the given path and returns the files that differ. The
+// files are compared only if the local artifact has a different layer
+// digest, e.g. if the remote artifact wasn't built reproducibly.
+func (c *Client) Diff(ctx context.Context, url, dir string, ignorePaths []string) ([]FileDiff, error) {
+	if _, err := name.ParseReference(url); err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ocibuild")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp build dir failed: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, "artifact.tgz")
+	if err := Build(tmpFile, dir, ignorePaths); err != nil {
+		return nil, fmt.Errorf("building artifact failed: %w", err)
+	}
+	local, err := os.Open(tmpFile)
+	if err != nil {
+		return nil, fmt.Errorf("opening artifact failed: %w", err)
+	}
+	defer local.Close()
+	localHash, localSize, err := gcrv1.SHA256(local)
+	if err != nil {
+		return nil, fmt.Errorf("calculating artifact hash failed: %w", err)
+	}
+
+	img, err := crane.Pull(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list layers: %w", err)
+	}
+	if len(layers) < 1 {
+		return nil, fmt.Errorf("no layers found in artifact")
+	}
+	remoteHash, err := layers[0].Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer digest: %w", err)
+	}
+	remoteSize, err := layers[0].Size()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer size: %w", err)
+	}
+	if localHash == remoteHash && localSize == remoteSize {
+		return nil, nil
+	}
+
+	remoteDir := filepath.Join(tmpDir, "remote")
+	blob, err := layers[0].Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("extracting first layer failed: %w", err)
+	}
+	defer blob.Close()
+	if _, err := untar.Untar(blob, remoteDir); err != nil {
+		return nil, fmt.Errorf("failed to untar first layer: %w", err)
+	}
+	localDir := filepath.Join(tmpDir, "local")
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := untar.Untar(local, localDir); err != nil {
+		return nil, fmt.Errorf("failed to untar local artifact: %w", err)
+	}
+
+	return diffDirs(remoteDir, localDir)
+}
+
+// diffDirs returns the files that differ between the remote and the local
+// directories, sorted by path.
+func diffDirs(remoteDir, localDir string) ([]FileDiff, error) {
+	remoteFiles, err := readFiles(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	localFiles, err := readFiles(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for p := range remoteFiles {
+		paths[p] = true
+	}
+	for p := range localFiles {
+		paths[p] = true
+	}
+	var diffs []FileDiff
+	for p := range paths {
+		remote, local := remoteFiles[p], localFiles[p]
+		if remote != nil && local != nil && bytes.Equal(remote, local) {
+			continue
+		}
+		diffs = append(diffs, FileDiff{Path: p, Remote: remote, Local: local})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// readFiles returns the content of the regular files in the directory by
+// slash separated relative path.
+func readFiles(root string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return files, nil
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return files, err
+}
+
+// WriteDiff writes the differences between the remote and the local files,
+// a dyff report for the YAML files present on both sides and a unified
+// diff for the others.
+func WriteDiff(w io.Writer, diffs []FileDiff) error {
+	var unified []printers.FileDiff
+	for _, d := range diffs {
+		if d.Remote != nil && d.Local != nil && isYAML(d.Path) {
+			report, err := yamlDiff(d)
+			if err == nil && len(report.Diffs) > 0 {
+				if _, err := fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", d.Path, d.Path); err != nil {
+					return err
+				}
+				if err := printers.NewDyffPrinter().Print(w, report); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		unified = append(unified, printers.FileDiff{Path: d.Path, From: d.Remote, To: d.Local})
+	}
+	return printers.NewUnifiedDiffPrinter().Print(w, unified)
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func yamlDiff(d FileDiff) (dyff.Report, error) {
+	from, err := ytbx.LoadDocuments(d.Remote)
+	if err != nil {
+		return dyff.Report{}, err
+	}
+	to, err := ytbx.LoadDocuments(d.Local)
+	if err != nil {
+		return dyff.Report{}, err
+	}
+	return dyff.CompareInputFiles(
+		ytbx.InputFile{Location: "a/" + d.Path, Documents: from},
+		ytbx.InputFile{Location: "b/" + d.Path, Documents: to},
+		dyff.IgnoreOrderChanges(false),
+		dyff.KubernetesEntityDetection(true),
+	)
+}
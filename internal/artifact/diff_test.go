@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestClient_Diff(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	ref := fmt.Sprintf("%s/config/app:v1", u.Host)
+	pushTestArtifact(t, c, ref)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, 0o644, time.Now())
+	diffs, err := c.Diff(ctx, ref, dir, nil)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("Diff() = %v, want no differences", diffs)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "deploy", "app.yaml"), []byte("kind: StatefulSet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scripts", "validate.sh"), []byte("#!/bin/bash\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "deploy", "svc.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = c.Diff(ctx, ref, dir, nil)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	var paths []string
+	for _, d := range diffs {
+		paths = append(paths, d.Path)
+	}
+	if want := []string{"deploy/app.yaml", "deploy/svc.yaml", "scripts/validate.sh"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Diff() paths = %v, want %v", paths, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, diffs); err != nil {
+		t.Fatalf("WriteDiff() error = %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"--- a/deploy/app.yaml\n+++ b/deploy/app.yaml\n",
+		"Deployment",
+		"StatefulSet",
+		"deleted file mode",
+		"-kind: Service",
+		"-#!/bin/sh\n+#!/bin/bash\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("WriteDiff() output doesn't contain %q:\n%s", want, output)
+		}
+	}
+}
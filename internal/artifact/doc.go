@@ -0,0 +1,26 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package artifact builds, pushes and inspects the OCI artifacts of Flux
+// with a byte-for-byte reproducible layout.
+//
+// The Client is the OCI client of all the artifact commands of the CLI, in
+// place of the one of github.com/fluxcd/pkg/oci/client: the signatures,
+// attestations, copies and prunes need the registry credentials of the
+// client, which the upstream client keeps private. The Client logs in the
+// same way as the upstream client, and uses its Metadata and ListOptions
+// types, so that the commands handle the artifacts the same way with both.
+package artifact
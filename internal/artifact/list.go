@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/crane"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/fluxcd/pkg/oci"
+	ociclient "github.com/fluxcd/pkg/oci/client"
+	"github.com/fluxcd/pkg/version"
+)
+
+// Tag is a tagged artifact of an OCI repository.
+type Tag struct {
+	ociclient.Metadata
+	// Name is the tag of the artifact.
+	Name string `json:"tag"`
+	// Size is the size in bytes of the layers of the artifact.
+	Size int64 `json:"size"`
+	// Signed is true if a cosign signature of the artifact is stored in
+	// the repository.
+	Signed bool `json:"signed"`
+}
+
+// CustomAnnotations returns the annotations of the artifact without the
+// creation date, source and revision ones.
+func (t Tag) CustomAnnotations() map[string]string {
+	annotations := map[string]string{}
+	for k, v := range t.Annotations {
+		switch k {
+		case oci.CreatedAnnotation, oci.SourceAnnotation, oci.RevisionAnnotation:
+			continue
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// SortByCreated sorts the tags by creation date in descending order, the
+// tags with an unknown creation date last.
+func SortByCreated(tags []Tag) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		ti, erri := time.Parse(time.RFC3339, tags[i].Created)
+		tj, errj := time.Parse(time.RFC3339, tags[j].Created)
+		switch {
+		case erri != nil:
+			return false
+		case errj != nil:
+			return true
+		default:
+			return ti.After(tj)
+		}
+	})
+}
+
+// isSignatureTag returns true if the tag is the one of the cosign
+// signatures or attestations of an artifact.
+func isSignatureTag(tag string) bool {
+	return strings.HasSuffix(tag, ".sig") || strings.HasSuffix(tag, ".att") || strings.HasSuffix(tag, ".sbom")
+}
+
+// Tags returns the tags of the image repository of the given URL.
+func (c *Client) Tags(ctx context.Context, url string) ([]string, error) {
+	tags, err := crane.ListTags(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags failed: %w", err)
+	}
+	return tags, nil
+}
+
+// NewTagFilter returns a function that matches the tags with the semver
+// range and the regex of the options, all the tags match empty options.
+func NewTagFilter(opts ociclient.ListOptions) (func(tag string) bool, error) {
+	var constraint *semver.Constraints
+	if opts.SemverFilter != "" {
+		var err error
+		constraint, err = semver.NewConstraint(opts.SemverFilter)
+		if err != nil {
+			return nil, fmt.Errorf("semver '%s' parse error: %w", opts.SemverFilter, err)
+		}
+	}
+	var re *regexp.Regexp
+	if opts.RegexFilter != "" {
+		var err error
+		re, err = regexp.Compile(opts.RegexFilter)
+		if err != nil {
+			return nil, fmt.Errorf("regex '%s' parse error: %w", opts.RegexFilter, err)
+		}
+	}
+
+	return func(tag string) bool {
+		if constraint != nil {
+			v, err := version.ParseVersion(tag)
+			if err != nil || !constraint.Check(v) {
+				return false
+			}
+		}
+		return re == nil || re.MatchString(tag)
+	}, nil
+}
+
+// List fetches the tags of the OCI repository matching the options, and the
+// metadata of their artifacts, sorted by tag in descending order.
+func (c *Client) List(ctx context.Context, url string, opts ociclient.ListOptions) ([]Tag, error) {
+	tags, err := crane.ListTags(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags failed: %w", err)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+	stored := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		stored[tag] = true
+	}
+
+	match, err := NewTagFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		if isSignatureTag(tag) || !match(tag) {
+			continue
+		}
+
+		t := Tag{Name: tag}
+		t.URL = fmt.Sprintf("%s:%s", url, tag)
+		manifestJSON, err := crane.Manifest(t.URL, c.optionsWithContext(ctx)...)
+		if err != nil {
+			return nil, fmt.Errorf("fetching manifest failed: %w", err)
+		}
+		manifest, err := gcrv1.ParseManifest(bytes.NewReader(manifestJSON))
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest failed: %w", err)
+		}
+		digest, _, err := gcrv1.SHA256(bytes.NewReader(manifestJSON))
+		if err != nil {
+			return nil, err
+		}
+		t.Digest = digest.String()
+		t.Annotations = manifest.Annotations
+		t.Signed = stored[SignatureTag(t.Digest)]
+		for _, layer := range manifest.Layers {
+			t.Size += layer.Size
+		}
+		if m, err := ociclient.MetadataFromAnnotations(manifest.Annotations); err == nil {
+			t.Created = m.Created
+			t.Source = m.Source
+			t.Revision = m.Revision
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+func TestClient_List(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	repo := fmt.Sprintf("%s/config/app", u.Host)
+	signedURL := pushTestArtifact(t, c, repo+":v1")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Sign(ctx, signedURL, key); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, 0o644, time.Now())
+	tarball := filepath.Join(t.TempDir(), "artifact.tgz")
+	if err := Build(tarball, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Push(ctx, repo+":v2", tarball, ociclient.Metadata{
+		Created:     "2023-02-01T00:00:00Z",
+		Source:      "https://github.com/org/config",
+		Revision:    "main@sha1:6ee3f4b6",
+		Annotations: map[string]string{"org.opencontainers.image.licenses": "Apache-2.0"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := c.List(ctx, repo, ociclient.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("List() returned %d tags, want 2", len(tags))
+	}
+	v2, v1 := tags[0], tags[1]
+	if v1.Name != "v1" || !v1.Signed || v1.Size == 0 {
+		t.Errorf("unexpected signed tag %+v", v1)
+	}
+	if v2.Name != "v2" || v2.Signed {
+		t.Errorf("unexpected unsigned tag %+v", v2)
+	}
+	want := map[string]string{"org.opencontainers.image.licenses": "Apache-2.0"}
+	if got := v2.CustomAnnotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CustomAnnotations() = %v, want %v", got, want)
+	}
+	if got := v1.CustomAnnotations(); len(got) != 0 {
+		t.Errorf("CustomAnnotations() = %v, want none", got)
+	}
+}
+
+func TestSortByCreated(t *testing.T) {
+	tags := []Tag{
+		{Name: "unknown"},
+		{Name: "v1", Metadata: ociclient.Metadata{Created: "2023-01-01T00:00:00Z"}},
+		{Name: "v3", Metadata: ociclient.Metadata{Created: "2023-03-01T00:00:00Z"}},
+		{Name: "v2", Metadata: ociclient.Metadata{Created: "2023-02-01T00:00:00Z"}},
+	}
+	SortByCreated(tags)
+	var got []string
+	for _, tag := range tags {
+		got = append(got, tag.Name)
+	}
+	if want := []string{"v3", "v2", "v1", "unknown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortByCreated() = %v, want %v", got, want)
+	}
+}
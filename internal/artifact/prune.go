@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/fluxcd/pkg/version"
+)
+
+// RetentionPolicy holds the rules of the artifacts to keep when pruning a
+// repository, the artifacts kept by none of the rules are pruned.
+type RetentionPolicy struct {
+	// KeepLast is the number of most recent artifacts to keep, the tags
+	// of the same digest count as one artifact.
+	KeepLast int
+	// KeepSemverLatestPerMinor keeps the highest semver tag of each
+	// major.minor version.
+	KeepSemverLatestPerMinor bool
+	// OlderThan keeps the artifacts created less than this duration ago.
+	OlderThan time.Duration
+	// Protect keeps the tags matching any of the regular expressions.
+	Protect []*regexp.Regexp
+	// Filter selects the tags the rules apply to, the other tags are kept
+	// and so are the artifacts of their digests. All the tags are selected
+	// if nil.
+	Filter func(tag string) bool
+}
+
+// Empty returns true if the policy has no rules.
+func (p RetentionPolicy) Empty() bool {
+	return p.KeepLast <= 0 && !p.KeepSemverLatestPerMinor && p.OlderThan <= 0 && len(p.Protect) == 0
+}
+
+// Decision is the outcome of the retention policy for a tag.
+type Decision struct {
+	Tag
+	// Prune is true if the artifact is to be deleted.
+	Prune bool
+	// Reason tells why the artifact is kept.
+	Reason string
+}
+
+// Selected returns true if the rules of the policy apply to the tag.
+func (p RetentionPolicy) Selected(tag string) bool {
+	return p.Filter == nil || p.Filter(tag)
+}
+
+// Decide applies the retention policy to the tags, which must be all the
+// tags of the repository. An artifact is pruned only if none of its tags
+// is kept and its digest is not in referenced, as deleting a digest
+// deletes all its tags.
+func (p RetentionPolicy) Decide(tags []Tag, referenced map[string]bool, now time.Time) []Decision {
+	decisions := make([]Decision, len(tags))
+	for i, t := range tags {
+		decisions[i] = Decision{Tag: t, Prune: true}
+	}
+	keep := func(i int, reason string) {
+		if decisions[i].Prune {
+			decisions[i].Prune = false
+			decisions[i].Reason = reason
+		}
+	}
+
+	for i, t := range tags {
+		if !p.Selected(t.Name) {
+			keep(i, "not selected by the filter")
+			continue
+		}
+		if referenced[t.Digest] {
+			keep(i, "referenced by an OCIRepository")
+		}
+		for _, re := range p.Protect {
+			if re.MatchString(t.Name) {
+				keep(i, fmt.Sprintf("protected by '%s'", re.String()))
+			}
+		}
+		if p.OlderThan > 0 {
+			created, err := time.Parse(time.RFC3339, t.Created)
+			if err != nil {
+				keep(i, "unknown creation date")
+			} else if now.Sub(created) < p.OlderThan {
+				keep(i, fmt.Sprintf("newer than %s", p.OlderThan))
+			}
+		}
+	}
+
+	if p.KeepLast > 0 {
+		order := make([]int, 0, len(tags))
+		for i, t := range tags {
+			if p.Selected(t.Name) {
+				order = append(order, i)
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ta, tb := tags[order[a]], tags[order[b]]
+			if ta.Created != tb.Created {
+				return ta.Created > tb.Created
+			}
+			return ta.Name > tb.Name
+		})
+		digests := map[string]bool{}
+		for _, i := range order {
+			if !digests[tags[i].Digest] && len(digests) >= p.KeepLast {
+				break
+			}
+			digests[tags[i].Digest] = true
+			keep(i, fmt.Sprintf("within the last %d", p.KeepLast))
+		}
+	}
+
+	if p.KeepSemverLatestPerMinor {
+		latest := map[string]int{}
+		versions := map[int]*semver.Version{}
+		for i, t := range tags {
+			if !p.Selected(t.Name) {
+				continue
+			}
+			v, err := version.ParseVersion(t.Name)
+			if err != nil {
+				continue
+			}
+			versions[i] = v
+			minor := fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+			if j, ok := latest[minor]; !ok || v.GreaterThan(versions[j]) {
+				latest[minor] = i
+			}
+		}
+		for minor, i := range latest {
+			keep(i, fmt.Sprintf("latest of %s", minor))
+		}
+	}
+
+	keptDigests := map[string]string{}
+	for _, d := range decisions {
+		if !d.Prune {
+			keptDigests[d.Digest] = d.Name
+		}
+	}
+	for i, d := range decisions {
+		if d.Prune {
+			if tag, ok := keptDigests[d.Digest]; ok {
+				keep(i, fmt.Sprintf("same digest as %s", tag))
+			}
+		}
+	}
+	return decisions
+}
+
+// Delete deletes the artifact of the given digest URL and its cosign
+// signatures and attestations, it deletes all the tags of the digest.
+func (c *Client) Delete(ctx context.Context, digestURL string) error {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	for _, rt := range referrerTags(ref.DigestStr()) {
+		tag := ref.Context().Tag(rt)
+		digest, err := crane.Digest(tag.String(), c.optionsWithContext(ctx)...)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if err := crane.Delete(ref.Context().Digest(digest).String(), c.optionsWithContext(ctx)...); err != nil {
+			return fmt.Errorf("deleting %s failed: %w", tag, err)
+		}
+	}
+	if err := crane.Delete(digestURL, c.optionsWithContext(ctx)...); err != nil {
+		return fmt.Errorf("deleting %s failed: %w", digestURL, err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+func TestRetentionPolicy_Decide(t *testing.T) {
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	tag := func(name, digest, created string) Tag {
+		return Tag{Name: name, Metadata: ociclient.Metadata{Digest: digest, Created: created}}
+	}
+	tags := []Tag{
+		tag("v1.1.1", "sha256:111", "2023-02-28T00:00:00Z"),
+		tag("v1.1.0", "sha256:110", "2023-02-20T00:00:00Z"),
+		tag("v1.0.1", "sha256:101", "2023-02-10T00:00:00Z"),
+		tag("v1.0.0", "sha256:100", "2023-02-01T00:00:00Z"),
+		tag("latest", "sha256:111", "2023-02-28T00:00:00Z"),
+		tag("dev", "sha256:dev", ""),
+		tag("staging", "sha256:stg", "2023-01-01T00:00:00Z"),
+	}
+
+	tests := []struct {
+		name       string
+		policy     RetentionPolicy
+		referenced map[string]bool
+		pruned     []string
+	}{
+		{
+			name:   "keep last",
+			policy: RetentionPolicy{KeepLast: 2},
+			pruned: []string{"v1.0.1", "v1.0.0", "dev", "staging"},
+		},
+		{
+			name:   "keep semver latest per minor",
+			policy: RetentionPolicy{KeepSemverLatestPerMinor: true},
+			pruned: []string{"v1.1.0", "v1.0.0", "dev", "staging"},
+		},
+		{
+			name:   "older than",
+			policy: RetentionPolicy{OlderThan: 15 * 24 * time.Hour},
+			pruned: []string{"v1.0.1", "v1.0.0", "staging"},
+		},
+		{
+			name:       "protected and referenced",
+			policy:     RetentionPolicy{KeepLast: 1, Protect: []*regexp.Regexp{regexp.MustCompile("^(dev|staging)$")}},
+			referenced: map[string]bool{"sha256:100": true},
+			pruned:     []string{"v1.1.0", "v1.0.1"},
+		},
+		{
+			name: "tags sharing a digest with a tag outside of the filter",
+			policy: RetentionPolicy{
+				OlderThan: time.Hour,
+				Filter:    regexp.MustCompile("^v").MatchString,
+			},
+			pruned: []string{"v1.1.0", "v1.0.1", "v1.0.0"},
+		},
+		{
+			name: "keep last of the filtered tags",
+			policy: RetentionPolicy{
+				KeepLast: 1,
+				Filter:   regexp.MustCompile(`^v1\.0\.`).MatchString,
+			},
+			pruned: []string{"v1.0.0"},
+		},
+		{
+			name:   "tags sharing a kept digest",
+			policy: RetentionPolicy{Protect: []*regexp.Regexp{regexp.MustCompile("^latest$")}},
+			pruned: []string{"v1.1.0", "v1.0.1", "v1.0.0", "dev", "staging"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pruned []string
+			for _, d := range tt.policy.Decide(tags, tt.referenced, now) {
+				if d.Prune {
+					pruned = append(pruned, d.Name)
+				} else if d.Reason == "" {
+					t.Errorf("%s is kept without a reason", d.Name)
+				}
+			}
+			if !reflect.DeepEqual(pruned, tt.pruned) {
+				t.Errorf("pruned %v, want %v", pruned, tt.pruned)
+			}
+		})
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	repo := fmt.Sprintf("%s/config/app", u.Host)
+	digestURL := pushTestArtifact(t, c, repo+":v1")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Sign(ctx, digestURL, key); err != nil {
+		t.Fatal(err)
+	}
+	sigURL := fmt.Sprintf("%s:%s", repo, SignatureTag(digestURL[strings.LastIndex(digestURL, "@")+1:]))
+	sigDigestURL, err := c.Digest(ctx, sigURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(ctx, digestURL); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	for _, u := range []string{digestURL, sigDigestURL} {
+		if _, err := crane.Manifest(u); err == nil {
+			t.Errorf("expected %s to be deleted", u)
+		}
+	}
+}
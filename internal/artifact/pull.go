@@ -0,0 +1,298 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+// PullOptions are the options for pulling an artifact.
+type PullOptions struct {
+	// Path is the file or directory of the artifact to extract, relative
+	// to its root. The whole artifact is extracted if empty.
+	Path string
+	// Digest is the digest the artifact must have, e.g. 'sha256:<hex>'.
+	Digest string
+}
+
+// Pull downloads the artifact at the given URL and extracts its content to
+// the given directory. The content is streamed from the registry and
+// extracted file by file to a temporary directory, then moved to the given
+// directory once its digest is verified, the existing files are
+// overwritten.
+func (c *Client) Pull(ctx context.Context, url, outDir string, opts PullOptions) (*ociclient.Metadata, error) {
+	meta, blob, err := c.fetch(ctx, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(outDir, ".flux-pull-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	n := 0
+	err = walkTarball(blob, opts.Path, func(rel string, header *tar.Header, r io.Reader) error {
+		abs := filepath.Join(tmpDir, filepath.FromSlash(rel))
+		if header.Typeflag == tar.TypeDir {
+			return os.MkdirAll(abs, 0o755)
+		}
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(abs, os.O_RDWR|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return fmt.Errorf("error writing to %s: %w", abs, err)
+		}
+		n++
+		return f.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlob(blob); err != nil {
+		return nil, err
+	}
+	if n == 0 && opts.Path != "" {
+		return nil, fmt.Errorf("path '%s' not found in artifact", opts.Path)
+	}
+	if err := moveTree(tmpDir, outDir); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// PullManifests downloads the artifact at the given URL and writes its
+// YAML files to w as a multi-document YAML stream. The stream is spooled
+// to a temporary file, without buffering the content of the artifact in
+// memory, and written to w once the digest of the artifact is verified.
+func (c *Client) PullManifests(ctx context.Context, url string, w io.Writer, opts PullOptions) (*ociclient.Metadata, error) {
+	meta, blob, err := c.fetch(ctx, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	spool, err := os.CreateTemp("", "flux-pull-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	n := 0
+	err = walkTarball(blob, opts.Path, func(rel string, header *tar.Header, r io.Reader) error {
+		ext := strings.ToLower(path.Ext(rel))
+		if header.Typeflag == tar.TypeDir || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		if _, err := io.WriteString(spool, "---\n"); err != nil {
+			return err
+		}
+		lw := &lastByteWriter{w: spool}
+		if _, err := io.Copy(lw, r); err != nil {
+			return err
+		}
+		if lw.last != 0 && lw.last != '\n' {
+			if _, err := io.WriteString(spool, "\n"); err != nil {
+				return err
+			}
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlob(blob); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no YAML files found in artifact")
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, spool); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// verifyBlob reads the rest of the compressed content of the artifact, as
+// its digest is only verified once it is read to the end.
+func verifyBlob(blob io.Reader) error {
+	if _, err := io.Copy(io.Discard, blob); err != nil {
+		return fmt.Errorf("verifying the artifact content failed: %w", err)
+	}
+	return nil
+}
+
+// moveTree moves the directories and files of src to dst, replacing the
+// existing files.
+func moveTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		return os.Rename(p, target)
+	})
+}
+
+// fetch returns the metadata of the artifact at the given URL and a reader
+// of its compressed content, whose digest is verified when it is read to
+// the end.
+func (c *Client) fetch(ctx context.Context, url string, opts PullOptions) (*ociclient.Metadata, io.ReadCloser, error) {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	img, err := crane.Pull(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing digest failed: %w", err)
+	}
+	if opts.Digest != "" && opts.Digest != digest.String() {
+		return nil, nil, fmt.Errorf("the digest of the artifact is %s, expected %s", digest.String(), opts.Digest)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing manifest failed: %w", err)
+	}
+	meta, err := ociclient.MetadataFromAnnotations(manifest.Annotations)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.Digest = ref.Context().Digest(digest.String()).String()
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list layers: %w", err)
+	}
+	if len(layers) < 1 {
+		return nil, nil, fmt.Errorf("no layers found in artifact")
+	}
+	blob, err := layers[0].Compressed()
+	if err != nil {
+		return nil, nil, fmt.Errorf("extracting first layer failed: %w", err)
+	}
+	return meta, blob, nil
+}
+
+// walkTarball calls fn for the directories and regular files of the
+// gzipped tarball read from r that are under subPath, with their path
+// relative to subPath. A file at subPath is passed with its base name.
+func walkTarball(r io.Reader, subPath string, fn func(rel string, header *tar.Header, r io.Reader) error) error {
+	subPath = strings.Trim(path.Clean("/"+filepath.ToSlash(subPath)), "/")
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("requires gzip-compressed body: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tar error: %w", err)
+		}
+		if header.Name == "" || strings.HasPrefix(header.Name, "/") || strings.Contains(header.Name, `\`) {
+			return fmt.Errorf("tar contained invalid name %q", header.Name)
+		}
+		entry := path.Clean(header.Name)
+		if entry == ".." || strings.HasPrefix(entry, "../") {
+			return fmt.Errorf("tar contained invalid name %q", header.Name)
+		}
+
+		rel := entry
+		switch {
+		case subPath == "":
+		case entry == subPath:
+			rel = path.Base(entry)
+			if header.Typeflag == tar.TypeDir {
+				continue
+			}
+		case strings.HasPrefix(entry, subPath+"/"):
+			rel = strings.TrimPrefix(entry, subPath+"/")
+		default:
+			continue
+		}
+		if rel == "." {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+			if err := fn(rel, header, tr); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("tar file entry %s contained unsupported file type %v", header.Name, header.FileInfo().Mode())
+		}
+	}
+	return nil
+}
+
+// lastByteWriter records the last byte written to w.
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (l *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	if n > 0 {
+		l.last = p[n-1]
+	}
+	return n, err
+}
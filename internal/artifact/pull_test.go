@@ -0,0 +1,219 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestClient_Pull(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	ref := fmt.Sprintf("%s/config/app:v1", u.Host)
+	digestURL := pushTestArtifact(t, c, ref)
+	digest := digestURL[strings.LastIndex(digestURL, "@")+1:]
+
+	listFiles := func(dir string) []string {
+		t.Helper()
+		var files []string
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		opts    PullOptions
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "whole artifact",
+			opts: PullOptions{Digest: digest},
+			want: []string{".git/config", "deploy/app.yaml", "deploy/svc.yaml", "kustomization.yaml", "scripts/validate.sh"},
+		},
+		{
+			name: "directory",
+			opts: PullOptions{Path: "./deploy/"},
+			want: []string{"app.yaml", "svc.yaml"},
+		},
+		{
+			name: "file",
+			opts: PullOptions{Path: "deploy/app.yaml"},
+			want: []string{"app.yaml"},
+		},
+		{
+			name:    "missing path",
+			opts:    PullOptions{Path: "charts"},
+			wantErr: "path 'charts' not found in artifact",
+		},
+		{
+			name:    "digest mismatch",
+			opts:    PullOptions{Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+			wantErr: "the digest of the artifact is " + digest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			meta, err := c.Pull(ctx, ref, dir, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Pull() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			if meta.Digest != digestURL {
+				t.Errorf("Pull() digest = %s, want %s", meta.Digest, digestURL)
+			}
+			if got := listFiles(dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pull() extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if _, err := c.PullManifests(ctx, ref, &out, PullOptions{Path: "deploy"}); err != nil {
+		t.Fatalf("PullManifests() error = %v", err)
+	}
+	if want := "---\nkind: Deployment\n---\nkind: Service\n"; out.String() != want {
+		t.Errorf("PullManifests() wrote %q, want %q", out.String(), want)
+	}
+	if _, err := c.PullManifests(ctx, ref, io.Discard, PullOptions{Path: "scripts"}); err == nil {
+		t.Errorf("expected an error for a path without YAML files")
+	}
+}
+
+func TestWalkTarball_InvalidName(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	content := []byte("kind: Secret\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "deploy/../../secret.yaml", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := walkTarball(&buf, "", func(string, *tar.Header, io.Reader) error {
+		t.Fatal("unexpected call for an invalid name")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid name") {
+		t.Errorf("walkTarball() error = %v, want an invalid name error", err)
+	}
+}
+
+func TestClient_PullTamperedContent(t *testing.T) {
+	reg := registry.New()
+	tampered := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tampered == "" || r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+tampered) {
+			reg.ServeHTTP(w, r)
+			return
+		}
+		// alter the gzip trailer, which is read after the tar entries
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		body[len(body)-1] ^= 0xff
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	ref := fmt.Sprintf("%s/config/app:v1", u.Host)
+	pushTestArtifact(t, c, ref)
+	img, err := crane.Pull(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered = manifest.Layers[0].Digest.String()
+
+	dir := t.TempDir()
+	if _, err := c.Pull(ctx, ref, dir, PullOptions{}); err == nil || !strings.Contains(err.Error(), "verifying the artifact content failed") {
+		t.Errorf("Pull() error = %v, want a verification error", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+		t.Errorf("expected no files to be extracted, got %v (%v)", entries, err)
+	}
+
+	var out bytes.Buffer
+	if _, err := c.PullManifests(ctx, ref, &out, PullOptions{}); err == nil || !strings.Contains(err.Error(), "verifying the artifact content failed") {
+		t.Errorf("PullManifests() error = %v, want a verification error", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("expected nothing to be written, got %q", out.String())
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/fluxcd/pkg/oci"
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+// Image returns the OCI artifact of the given tarball, annotated with the
+// metadata.
+func Image(artifactPath string, meta ociclient.Metadata) (gcrv1.Image, error) {
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, oci.CanonicalConfigMediaType)
+	img = mutate.Annotations(img, meta.ToAnnotations()).(gcrv1.Image)
+
+	layer, err := tarball.LayerFromFile(artifactPath, tarball.WithMediaType(oci.CanonicalContentMediaType))
+	if err != nil {
+		return nil, fmt.Errorf("creating content layer failed: %w", err)
+	}
+	img, err = mutate.Append(img, mutate.Addendum{Layer: layer})
+	if err != nil {
+		return nil, fmt.Errorf("appending content to artifact failed: %w", err)
+	}
+	return img, nil
+}
+
+// Push uploads the artifact of the given tarball to the OCI repository of
+// the URL and returns its digest URL.
+func (c *Client) Push(ctx context.Context, url, artifactPath string, meta ociclient.Metadata) (string, error) {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	img, err := Image(artifactPath, meta)
+	if err != nil {
+		return "", err
+	}
+	if err := crane.Push(img, url, c.optionsWithContext(ctx)...); err != nil {
+		return "", fmt.Errorf("pushing artifact failed: %w", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("parsing artifact digest failed: %w", err)
+	}
+	return ref.Context().Digest(digest.String()).String(), nil
+}
+
+// Identical returns the digest URL of the artifact at the given URL if it
+// has the content of the tarball and the annotations of the metadata,
+// the creation date excepted. It returns an empty string if the artifact
+// doesn't exist or differs.
+func (c *Client) Identical(ctx context.Context, url, artifactPath string, meta ociclient.Metadata) (string, error) {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	remote, err := crane.Pull(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	remoteManifest, err := remote.Manifest()
+	if err != nil {
+		return "", fmt.Errorf("parsing manifest failed: %w", err)
+	}
+
+	local, err := Image(artifactPath, meta)
+	if err != nil {
+		return "", err
+	}
+	localManifest, err := local.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	if len(remoteManifest.Layers) != len(localManifest.Layers) {
+		return "", nil
+	}
+	for i := range localManifest.Layers {
+		if remoteManifest.Layers[i].Digest != localManifest.Layers[i].Digest {
+			return "", nil
+		}
+	}
+	if !sameAnnotations(remoteManifest.Annotations, localManifest.Annotations) {
+		return "", nil
+	}
+
+	digest, err := remote.Digest()
+	if err != nil {
+		return "", fmt.Errorf("parsing artifact digest failed: %w", err)
+	}
+	return ref.Context().Digest(digest.String()).String(), nil
+}
+
+// sameAnnotations compares the annotations of two artifacts, ignoring
+// their creation date.
+func sameAnnotations(a, b map[string]string) bool {
+	count := 0
+	for k, v := range a {
+		if k == oci.CreatedAnnotation {
+			continue
+		}
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+		count++
+	}
+	for k := range b {
+		if k != oci.CreatedAnnotation {
+			count--
+		}
+	}
+	return count == 0
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+func TestClient_Identical(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := fmt.Sprintf("%s/config/app:production", u.Host)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, 0o644, time.Now())
+	tarball := filepath.Join(t.TempDir(), "artifact.tgz")
+	if err := Build(tarball, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	meta := ociclient.Metadata{
+		Created:  "2023-01-01T00:00:00Z",
+		Source:   "https://github.com/org/config",
+		Revision: "main@sha1:6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6",
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	existing, err := c.Identical(ctx, ref, tarball, meta)
+	if err != nil {
+		t.Fatalf("Identical() error = %v", err)
+	}
+	if existing != "" {
+		t.Fatalf("Identical() = %s for a missing artifact", existing)
+	}
+
+	digestURL, err := c.Push(ctx, ref, tarball, meta)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	meta.Created = "2023-02-01T00:00:00Z"
+	existing, err = c.Identical(ctx, ref, tarball, meta)
+	if err != nil {
+		t.Fatalf("Identical() error = %v", err)
+	}
+	if existing != digestURL {
+		t.Errorf("Identical() = %s, want %s", existing, digestURL)
+	}
+
+	meta.Revision = "main@sha1:0000000000000000000000000000000000000000"
+	if existing, _ := c.Identical(ctx, ref, tarball, meta); existing != "" {
+		t.Errorf("Identical() = %s for a different revision", existing)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "deploy/app.yaml"), []byte("kind: StatefulSet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Build(tarball, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	meta.Revision = "main@sha1:6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6"
+	if existing, _ := c.Identical(ctx, ref, tarball, meta); existing != "" {
+		t.Errorf("Identical() = %s for a different content", existing)
+	}
+}
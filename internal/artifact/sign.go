@@ -0,0 +1,342 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// SignatureMediaType is the media type of the cosign signature layers.
+	SignatureMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation is the annotation of the cosign signature layers
+	// holding the base64 encoded signature of the layer payload.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	signatureType = "cosign container image signature"
+)
+
+// ErrNoSignature is returned when an artifact has no signature matching the
+// public key.
+var ErrNoSignature = errors.New("no signature matching the public key found")
+
+// signaturePayload is the cosign simple signing payload.
+type signaturePayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// SignatureTag returns the tag of the cosign signatures of the artifact
+// with the given digest.
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// Digest returns the digest URL of the artifact at the given URL.
+func (c *Client) Digest(ctx context.Context, url string) (string, error) {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if d, ok := ref.(name.Digest); ok {
+		return d.String(), nil
+	}
+	digest, err := crane.Digest(url, c.optionsWithContext(ctx)...)
+	if err != nil {
+		return "", err
+	}
+	return ref.Context().Digest(digest).String(), nil
+}
+
+// Sign signs the artifact of the given digest URL with the private key, the
+// signature is stored in the repository of the artifact in the cosign format
+// and can be verified with 'cosign verify' and by the OCIRepository
+// verification of source-controller. The artifact is not signed again if it
+// already has a signature matching the key.
+func (c *Client) Sign(ctx context.Context, digestURL string, key crypto.Signer) error {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	if err := c.Verify(ctx, digestURL, key.Public()); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrNoSignature) {
+		return err
+	}
+
+	var payload signaturePayload
+	payload.Critical.Identity.DockerReference = ref.Context().String()
+	payload.Critical.Image.DockerManifestDigest = ref.DigestStr()
+	payload.Critical.Type = signatureType
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	signature, err := signPayload(key, data)
+	if err != nil {
+		return fmt.Errorf("signing failed: %w", err)
+	}
+
+	sigImg, err := c.signatures(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if sigImg == nil {
+		sigImg = mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	}
+	layer := static.NewLayer(data, SignatureMediaType)
+	sigImg, err = mutate.Append(sigImg, mutate.Addendum{
+		Layer: layer,
+		Annotations: map[string]string{
+			SignatureAnnotation: base64.StdEncoding.EncodeToString(signature),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sigURL := ref.Context().Tag(SignatureTag(ref.DigestStr())).String()
+	if err := crane.Push(sigImg, sigURL, c.optionsWithContext(ctx)...); err != nil {
+		return fmt.Errorf("pushing signature failed: %w", err)
+	}
+	return nil
+}
+
+// Verify verifies that the artifact of the given digest URL has a cosign
+// signature matching the public key.
+func (c *Client) Verify(ctx context.Context, digestURL string, key crypto.PublicKey) error {
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		return fmt.Errorf("invalid digest URL: %w", err)
+	}
+	sigImg, err := c.signatures(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if sigImg == nil {
+		return ErrNoSignature
+	}
+	manifest, err := sigImg.Manifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range manifest.Layers {
+		if desc.MediaType != SignatureMediaType {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(desc.Annotations[SignatureAnnotation])
+		if err != nil {
+			continue
+		}
+		layer, err := sigImg.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		var payload signaturePayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			continue
+		}
+		if payload.Critical.Image.DockerManifestDigest != ref.DigestStr() {
+			continue
+		}
+		if verifyPayload(key, data, signature) == nil {
+			return nil
+		}
+	}
+	return ErrNoSignature
+}
+
+// signatures returns the cosign signatures image of the artifact, or nil
+// if the artifact has no signatures.
+func (c *Client) signatures(ctx context.Context, ref name.Digest) (gcrv1.Image, error) {
+	sigURL := ref.Context().Tag(SignatureTag(ref.DigestStr())).String()
+	img, err := crane.Pull(sigURL, c.optionsWithContext(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching signatures failed: %w", err)
+	}
+	return img, nil
+}
+
+func signPayload(key crypto.Signer, payload []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(payload)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verifyPayload(key crypto.PublicKey, payload, signature []byte) error {
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// LoadPublicKey reads a PEM encoded public key, e.g. the cosign.pub file
+// written by 'cosign generate-key-pair'.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded public key", path)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// LoadPrivateKey reads a PEM encoded private key, either encrypted with the
+// password as the cosign.key file written by 'cosign generate-key-pair',
+// or unencrypted in the PKCS #8 or SEC 1 format.
+func LoadPrivateKey(path string, password []byte) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM encoded private key", path)
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		der, err = decryptPrivateKey(block.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %w", path, err)
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("unsupported private key type %s", block.Type)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// encryptedKey is the format of the encrypted cosign private keys.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func decryptPrivateKey(data, password []byte) ([]byte, error) {
+	var ek encryptedKey
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&ek); err != nil {
+		return nil, err
+	}
+	if ek.KDF.Name != "scrypt" || ek.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported encryption %s with %s", ek.Cipher.Name, ek.KDF.Name)
+	}
+	if len(ek.Cipher.Nonce) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+
+	secret, err := scrypt.Key(password, ek.KDF.Salt, ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	var nonce [24]byte
+	copy(key[:], secret)
+	copy(nonce[:], ek.Cipher.Nonce)
+	plaintext, ok := secretbox.Open(nil, ek.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, errors.New("invalid password")
+	}
+	return plaintext, nil
+}
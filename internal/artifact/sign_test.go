@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifact
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	ociclient "github.com/fluxcd/pkg/oci/client"
+)
+
+// writeCosignKeyPair writes an ECDSA key pair in the format of
+// 'cosign generate-key-pair'.
+func writeCosignKeyPair(t *testing.T, dir string, password []byte) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ek encryptedKey
+	ek.KDF.Name = "scrypt"
+	ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P = 1024, 8, 1
+	ek.KDF.Salt = make([]byte, 32)
+	ek.Cipher.Name = "nacl/secretbox"
+	ek.Cipher.Nonce = make([]byte, 24)
+	if _, err := rand.Read(ek.KDF.Salt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(ek.Cipher.Nonce); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := scrypt.Key(password, ek.KDF.Salt, ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], secret)
+	copy(nonce[:], ek.Cipher.Nonce)
+	ek.Ciphertext = secretbox.Seal(nil, der, &nonce, &k)
+	data, err := json.Marshal(ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, pubPath
+}
+
+func pushTestArtifact(t *testing.T, c *Client, ref string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, 0o644, time.Now())
+	tarball := filepath.Join(t.TempDir(), "artifact.tgz")
+	if err := Build(tarball, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	digestURL, err := c.Push(context.Background(), ref, tarball, ociclient.Metadata{
+		Created:  "2023-01-01T00:00:00Z",
+		Source:   "https://github.com/org/config",
+		Revision: "main@sha1:6ee3f4b6f5c0e0b1e1b5c8c1a8f9e8c2b3d4e5f6",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digestURL
+}
+
+func TestClient_SignVerify(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := NewClient()
+	digestURL := pushTestArtifact(t, c, fmt.Sprintf("%s/config/app:v1", u.Host))
+
+	keys := t.TempDir()
+	keyPath, pubPath := writeCosignKeyPair(t, keys, []byte("secret"))
+	if _, err := LoadPrivateKey(keyPath, []byte("wrong")); err == nil {
+		t.Fatalf("expected an error for a wrong password")
+	}
+	key, err := LoadPrivateKey(keyPath, []byte("secret"))
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+
+	if err := c.Verify(ctx, digestURL, pub); !errors.Is(err, ErrNoSignature) {
+		t.Fatalf("Verify() error = %v for an unsigned artifact", err)
+	}
+	if err := c.Sign(ctx, digestURL, key); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if err := c.Verify(ctx, digestURL, pub); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// an artifact already signed with the key is not signed again
+	if err := c.Sign(ctx, digestURL, key); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	ref, err := name.NewDigest(digestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigImg, err := crane.Pull(ref.Context().Tag(SignatureTag(ref.DigestStr())).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := sigImg.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Errorf("got %d signatures, want 1", len(layers))
+	}
+
+	// a second key adds a signature
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify(ctx, digestURL, other.Public()); !errors.Is(err, ErrNoSignature) {
+		t.Fatalf("Verify() error = %v for another key", err)
+	}
+	if err := c.Sign(ctx, digestURL, crypto.Signer(other)); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	for _, k := range []crypto.PublicKey{pub, other.Public()} {
+		if err := c.Verify(ctx, digestURL, k); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	}
+
+	// the signature of an artifact doesn't verify another one
+	otherURL := pushTestArtifact(t, c, fmt.Sprintf("%s/config/other:v1", u.Host))
+	if err := c.Verify(ctx, otherURL, pub); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Verify() error = %v for another artifact", err)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imagepolicy evaluates ImagePolicies locally, with the semantics of
+// image-reflector-controller.
+package imagepolicy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	"github.com/fluxcd/pkg/version"
+)
+
+const (
+	// OrderAsc selects the highest tag of the alphabetical and numerical
+	// policies.
+	OrderAsc = "asc"
+	// OrderDesc selects the lowest tag of the alphabetical and numerical
+	// policies.
+	OrderDesc = "desc"
+)
+
+// DefaultExclusionList is the default list of regular expressions of the
+// tags ignored by an ImageRepository.
+var DefaultExclusionList = []string{`^.*\.sig$`}
+
+// Candidate is a tag matching the filter of a policy.
+type Candidate struct {
+	// Tag is the tag of the image.
+	Tag string `json:"tag"`
+	// Key is the value the policy sorts the tag by, extracted from the tag
+	// by the filter.
+	Key string `json:"key"`
+	// Rank is the position of the tag in the order of the policy starting
+	// from 1 for the selected tag, or 0 if the policy ignores the tag, e.g.
+	// if it is not in the semver range.
+	Rank int `json:"rank"`
+}
+
+// Result is the outcome of the evaluation of a policy.
+type Result struct {
+	// Candidates are the tags matching the filter of the policy, ranked
+	// first and then sorted by tag.
+	Candidates []Candidate `json:"candidates"`
+	// Latest is the tag selected by the policy.
+	Latest string `json:"latest"`
+}
+
+// Filter returns the tags that match none of the regular expressions of
+// the exclusion list.
+func Filter(tags []string, exclusionList []string) ([]string, error) {
+	var exclusions []*regexp.Regexp
+	for _, e := range exclusionList {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion regex '%s': %w", e, err)
+		}
+		exclusions = append(exclusions, re)
+	}
+
+	var result []string
+next:
+	for _, tag := range tags {
+		for _, re := range exclusions {
+			if re.MatchString(tag) {
+				continue next
+			}
+		}
+		result = append(result, tag)
+	}
+	return result, nil
+}
+
+// Evaluate selects the latest of the tags with the policy and the filter of
+// the ImagePolicy spec. Like image-reflector-controller, the tags are first
+// filtered with the pattern of the filter and their sort keys are extracted
+// with its replacement pattern, the latest tag among tags with the same key
+// being the last one of the list.
+func Evaluate(spec imagev1.ImagePolicySpec, tags []string) (*Result, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("no tags to evaluate")
+	}
+
+	keys := map[string]string{}
+	var order []string
+	if spec.FilterTags != nil && spec.FilterTags.Pattern != "" {
+		re, err := regexp.Compile(spec.FilterTags.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter regex '%s': %w", spec.FilterTags.Pattern, err)
+		}
+		for _, tag := range tags {
+			match := re.FindStringSubmatchIndex(tag)
+			if match == nil {
+				continue
+			}
+			key := tag
+			if spec.FilterTags.Extract != "" {
+				key = string(re.ExpandString(nil, spec.FilterTags.Extract, tag, match))
+			}
+			if _, ok := keys[key]; !ok {
+				order = append(order, key)
+			}
+			keys[key] = tag
+		}
+	} else {
+		for _, tag := range tags {
+			if _, ok := keys[tag]; !ok {
+				order = append(order, tag)
+			}
+			keys[tag] = tag
+		}
+	}
+	if len(order) == 0 {
+		return nil, errors.New("no tags match the filter")
+	}
+
+	ranked, err := rank(spec.Policy, order)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranked) == 0 {
+		return nil, errors.New("unable to determine the latest tag from the filtered tags")
+	}
+
+	result := &Result{Latest: keys[ranked[0]]}
+	ranks := make(map[string]int, len(ranked))
+	for i, key := range ranked {
+		ranks[key] = i + 1
+		result.Candidates = append(result.Candidates, Candidate{Tag: keys[key], Key: key, Rank: i + 1})
+	}
+	var ignored []Candidate
+	for _, key := range order {
+		if _, ok := ranks[key]; !ok {
+			ignored = append(ignored, Candidate{Tag: keys[key], Key: key})
+		}
+	}
+	sort.Slice(ignored, func(i, j int) bool { return ignored[i].Tag < ignored[j].Tag })
+	result.Candidates = append(result.Candidates, ignored...)
+	return result, nil
+}
+
+// rank returns the keys the policy can select, from the latest one.
+func rank(policy imagev1.ImagePolicyChoice, keys []string) ([]string, error) {
+	switch {
+	case policy.SemVer != nil:
+		constraint, err := semver.NewConstraint(policy.SemVer.Range)
+		if err != nil {
+			return nil, fmt.Errorf("semver '%s' parse error: %w", policy.SemVer.Range, err)
+		}
+		var versions semver.Collection
+		for _, key := range keys {
+			if v, err := version.ParseVersion(key); err == nil && constraint.Check(v) {
+				versions = append(versions, v)
+			}
+		}
+		sort.Sort(sort.Reverse(versions))
+		ranked := make([]string, 0, len(versions))
+		for _, v := range versions {
+			ranked = append(ranked, v.Original())
+		}
+		return ranked, nil
+	case policy.Alphabetical != nil:
+		order, err := policyOrder(policy.Alphabetical.Order)
+		if err != nil {
+			return nil, err
+		}
+		ranked := append([]string{}, keys...)
+		if order == OrderAsc {
+			sort.Sort(sort.Reverse(sort.StringSlice(ranked)))
+		} else {
+			sort.Strings(ranked)
+		}
+		return ranked, nil
+	case policy.Numerical != nil:
+		order, err := policyOrder(policy.Numerical.Order)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]float64, len(keys))
+		for _, key := range keys {
+			f, err := strconv.ParseFloat(key, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse invalid numeric value '%s'", key)
+			}
+			values[key] = f
+		}
+		ranked := append([]string{}, keys...)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if order == OrderAsc {
+				return values[ranked[i]] > values[ranked[j]]
+			}
+			return values[ranked[i]] < values[ranked[j]]
+		})
+		return ranked, nil
+	default:
+		return nil, errors.New("the policy must be one of semver, alphabetical or numerical")
+	}
+}
+
+func policyOrder(order string) (string, error) {
+	switch order {
+	case "", OrderAsc:
+		return OrderAsc, nil
+	case OrderDesc:
+		return OrderDesc, nil
+	default:
+		return "", fmt.Errorf("invalid order '%s', must be one of [%s, %s]", order, OrderAsc, OrderDesc)
+	}
+}
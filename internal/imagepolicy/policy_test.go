@@ -0,0 +1,203 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagepolicy
+
+import (
+	"reflect"
+	"testing"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       imagev1.ImagePolicySpec
+		tags       []string
+		latest     string
+		candidates []Candidate
+		wantErr    string
+	}{
+		{
+			name: "semver range",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				SemVer: &imagev1.SemVerPolicy{Range: "1.x"},
+			}},
+			tags:   []string{"1.0.0", "v1.2.0", "1.1.0", "2.0.0", "latest"},
+			latest: "v1.2.0",
+			candidates: []Candidate{
+				{Tag: "v1.2.0", Key: "v1.2.0", Rank: 1},
+				{Tag: "1.1.0", Key: "1.1.0", Rank: 2},
+				{Tag: "1.0.0", Key: "1.0.0", Rank: 3},
+				{Tag: "2.0.0", Key: "2.0.0"},
+				{Tag: "latest", Key: "latest"},
+			},
+		},
+		{
+			name: "semver with extract",
+			spec: imagev1.ImagePolicySpec{
+				Policy: imagev1.ImagePolicyChoice{
+					SemVer: &imagev1.SemVerPolicy{Range: ">=1.0.0"},
+				},
+				FilterTags: &imagev1.TagFilter{Pattern: `^(?P<version>[0-9.]+)-alpine$`, Extract: "$version"},
+			},
+			tags:   []string{"1.0.0-alpine", "1.1.0-alpine", "1.2.0", "1.1.0"},
+			latest: "1.1.0-alpine",
+			candidates: []Candidate{
+				{Tag: "1.1.0-alpine", Key: "1.1.0", Rank: 1},
+				{Tag: "1.0.0-alpine", Key: "1.0.0", Rank: 2},
+			},
+		},
+		{
+			name: "alphabetical asc by default",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				Alphabetical: &imagev1.AlphabeticalPolicy{},
+			}},
+			tags:   []string{"b", "c", "a"},
+			latest: "c",
+			candidates: []Candidate{
+				{Tag: "c", Key: "c", Rank: 1},
+				{Tag: "b", Key: "b", Rank: 2},
+				{Tag: "a", Key: "a", Rank: 3},
+			},
+		},
+		{
+			name: "alphabetical desc",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				Alphabetical: &imagev1.AlphabeticalPolicy{Order: OrderDesc},
+			}},
+			tags:   []string{"b", "c", "a"},
+			latest: "a",
+			candidates: []Candidate{
+				{Tag: "a", Key: "a", Rank: 1},
+				{Tag: "b", Key: "b", Rank: 2},
+				{Tag: "c", Key: "c", Rank: 3},
+			},
+		},
+		{
+			name: "numerical with timestamp extract",
+			spec: imagev1.ImagePolicySpec{
+				Policy: imagev1.ImagePolicyChoice{
+					Numerical: &imagev1.NumericalPolicy{Order: OrderAsc},
+				},
+				FilterTags: &imagev1.TagFilter{Pattern: `^main-[a-f0-9]+-(?P<ts>[0-9]+)`, Extract: "$ts"},
+			},
+			tags:   []string{"main-abc1234-9", "main-def5678-10", "dev-0123456-11"},
+			latest: "main-def5678-10",
+			candidates: []Candidate{
+				{Tag: "main-def5678-10", Key: "10", Rank: 1},
+				{Tag: "main-abc1234-9", Key: "9", Rank: 2},
+			},
+		},
+		{
+			name: "the last tag with the same key wins",
+			spec: imagev1.ImagePolicySpec{
+				Policy: imagev1.ImagePolicyChoice{
+					Numerical: &imagev1.NumericalPolicy{},
+				},
+				FilterTags: &imagev1.TagFilter{Pattern: `^[a-z]+-(?P<n>[0-9]+)$`, Extract: "$n"},
+			},
+			tags:   []string{"a-1", "b-1"},
+			latest: "b-1",
+			candidates: []Candidate{
+				{Tag: "b-1", Key: "1", Rank: 1},
+			},
+		},
+		{
+			name: "numerical with invalid number",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				Numerical: &imagev1.NumericalPolicy{},
+			}},
+			tags:    []string{"1", "latest"},
+			wantErr: "failed to parse invalid numeric value 'latest'",
+		},
+		{
+			name: "no semver match",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				SemVer: &imagev1.SemVerPolicy{Range: "3.x"},
+			}},
+			tags:    []string{"1.0.0"},
+			wantErr: "unable to determine the latest tag from the filtered tags",
+		},
+		{
+			name: "no filter match",
+			spec: imagev1.ImagePolicySpec{
+				Policy: imagev1.ImagePolicyChoice{
+					Alphabetical: &imagev1.AlphabeticalPolicy{},
+				},
+				FilterTags: &imagev1.TagFilter{Pattern: `^main-`},
+			},
+			tags:    []string{"dev-1"},
+			wantErr: "no tags match the filter",
+		},
+		{
+			name: "invalid order",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				Alphabetical: &imagev1.AlphabeticalPolicy{Order: "up"},
+			}},
+			tags:    []string{"a"},
+			wantErr: "invalid order 'up', must be one of [asc, desc]",
+		},
+		{
+			name:    "no policy",
+			tags:    []string{"a"},
+			wantErr: "the policy must be one of semver, alphabetical or numerical",
+		},
+		{
+			name: "no tags",
+			spec: imagev1.ImagePolicySpec{Policy: imagev1.ImagePolicyChoice{
+				Alphabetical: &imagev1.AlphabeticalPolicy{},
+			}},
+			wantErr: "no tags to evaluate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Evaluate(tt.spec, tt.tags)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Latest != tt.latest {
+				t.Errorf("expected latest tag %q, got %q", tt.latest, result.Latest)
+			}
+			if !reflect.DeepEqual(result.Candidates, tt.candidates) {
+				t.Errorf("expected candidates %v, got %v", tt.candidates, result.Candidates)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tags, err := Filter([]string{"1.0.0", "sha256-abc.sig", "1.1.0"}, DefaultExclusionList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0.0", "1.1.0"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected %v, got %v", want, tags)
+	}
+
+	if _, err := Filter(nil, []string{"("}); err == nil {
+		t.Error("expected an error for an invalid exclusion regex")
+	}
+}
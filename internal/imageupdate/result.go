@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imageupdate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// DefaultCommitTemplate is the commit message of image-automation-controller
+// when the ImageUpdateAutomation has no template.
+const DefaultCommitTemplate = "Update from image update automation"
+
+// ImageRef is an image updated by a policy, as given to the commit message
+// template.
+type ImageRef interface {
+	// String returns the image reference, e.g. 'ghcr.io/org/app:v1.0.0'.
+	String() string
+	// Identifier returns the tag of the image.
+	Identifier() string
+	// Repository returns the repository of the image, e.g. 'org/app'.
+	Repository() string
+	// Registry returns the registry of the image, e.g. 'ghcr.io'.
+	Registry() string
+	// Name returns the image without the tag, e.g. 'ghcr.io/org/app'.
+	Name() string
+	// Policy returns the ImagePolicy which selected the image.
+	Policy() types.NamespacedName
+}
+
+type imageRef struct {
+	name.Reference
+	policy types.NamespacedName
+}
+
+func (i imageRef) Name() string {
+	return i.Context().Name()
+}
+
+func (i imageRef) Repository() string {
+	return i.Context().RepositoryStr()
+}
+
+func (i imageRef) Registry() string {
+	return i.Context().RegistryStr()
+}
+
+func (i imageRef) Policy() types.NamespacedName {
+	return i.policy
+}
+
+// ObjectIdentifier identifies the object holding an updated field.
+type ObjectIdentifier struct {
+	yaml.ResourceIdentifier
+}
+
+// FileResult is the images updated in the objects of a file.
+type FileResult struct {
+	Objects map[ObjectIdentifier][]ImageRef
+}
+
+// Result is the images updated in the files, by file path relative to the
+// update path.
+type Result struct {
+	Files map[string]FileResult
+}
+
+// Images returns the updated images, sorted by reference.
+func (r Result) Images() []ImageRef {
+	seen := make(map[string]bool)
+	var images []ImageRef
+	for _, file := range r.Files {
+		for _, refs := range file.Objects {
+			for _, ref := range refs {
+				if !seen[ref.String()] {
+					seen[ref.String()] = true
+					images = append(images, ref)
+				}
+			}
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].String() < images[j].String() })
+	return images
+}
+
+// Objects returns the updated objects of all the files and their images.
+func (r Result) Objects() map[ObjectIdentifier][]ImageRef {
+	objects := make(map[ObjectIdentifier][]ImageRef)
+	for _, file := range r.Files {
+		for id, refs := range file.Objects {
+			objects[id] = append(objects[id], refs...)
+		}
+	}
+	return objects
+}
+
+// TemplateData is the value given to the commit message template, as in
+// image-automation-controller.
+type TemplateData struct {
+	AutomationObject types.NamespacedName
+	Updated          Result
+}
+
+// CommitMessage executes the commit message template, or the default one if
+// the template is empty, with the result of the update.
+func CommitMessage(tmpl string, automation types.NamespacedName, result Result) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultCommitTemplate
+	}
+	t, err := template.New("commit message").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("unable to create commit message template from spec: %w", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, TemplateData{AutomationObject: automation, Updated: result}); err != nil {
+		return "", fmt.Errorf("failed to run template from spec: %w", err)
+	}
+	return b.String(), nil
+}
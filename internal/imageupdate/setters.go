@@ -0,0 +1,210 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imageupdate applies the latest images of ImagePolicies to the
+// setter markers of YAML files, with the semantics of
+// image-automation-controller.
+package imageupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+)
+
+// SetterToken is the key of the setter markers in the YAML comments, e.g.
+// '# {"$imagepolicy": "flux-system:podinfo:tag"}'.
+const SetterToken = "$imagepolicy"
+
+// FileChange is a file changed by the setters.
+type FileChange struct {
+	// Path is the slash separated path of the file relative to the root
+	// directory.
+	Path string
+	// Before is the content of the file before the update.
+	Before []byte
+	// After is the content of the file after the update.
+	After []byte
+}
+
+// setterValue is the value of a setter and the image it is set from.
+type setterValue struct {
+	value string
+	ref   imageRef
+}
+
+// UpdateWithSetters applies the latest images of the policies to the
+// setter markers of the YAML files found in the path of the root
+// directory, without writing the files. The policies without a latest image
+// are ignored. The setters of a policy are '<namespace>:<name>' for the
+// image, '<namespace>:<name>:tag' for its tag and '<namespace>:<name>:name'
+// for the image without the tag. It returns the changed files sorted by
+// path, and the result given to the commit message template.
+func UpdateWithSetters(root, path string, policies []imagev1.ImagePolicy) ([]FileChange, Result, error) {
+	result := Result{Files: make(map[string]FileResult)}
+
+	setters := make(map[string]setterValue)
+	for _, policy := range policies {
+		image := policy.Status.LatestImage
+		if image == "" {
+			continue
+		}
+		ref, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			return nil, result, fmt.Errorf("invalid latest image '%s' of ImagePolicy %s/%s: %w",
+				image, policy.Namespace, policy.Name, err)
+		}
+		r := imageRef{Reference: ref, policy: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}}
+		tag := ref.Identifier()
+		// The image name is the image without the tag, as written in the
+		// status of the policy.
+		imageName := image[:len(image)-len(tag)-1]
+
+		prefix := policy.Namespace + ":" + policy.Name
+		setters[prefix] = setterValue{value: image, ref: r}
+		setters[prefix+":tag"] = setterValue{value: tag, ref: r}
+		setters[prefix+":name"] = setterValue{value: imageName, ref: r}
+	}
+
+	updatePath := filepath.Join(root, path)
+	var changes []FileChange
+	err := filepath.WalkDir(updatePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		before, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(before, []byte(SetterToken)) {
+			return nil
+		}
+
+		nodes, err := (&kio.ByteReader{Reader: bytes.NewReader(before), PreserveSeqIndent: true}).Read()
+		if err != nil {
+			// Files with setter markers which are not plain YAML are
+			// ignored, e.g. Helm templates.
+			return nil
+		}
+
+		objects := make(map[ObjectIdentifier][]ImageRef)
+		for _, node := range nodes {
+			var id ObjectIdentifier
+			if meta, err := node.GetMeta(); err == nil {
+				id = ObjectIdentifier{meta.GetIdentifier()}
+			}
+			for _, ref := range applySetters(node.YNode(), setters) {
+				objects[id] = appendRef(objects[id], ref)
+			}
+		}
+		if len(objects) == 0 {
+			return nil
+		}
+
+		var after bytes.Buffer
+		if err := (kio.ByteWriter{Writer: &after}).Write(nodes); err != nil {
+			return fmt.Errorf("failed to write %s: %w", p, err)
+		}
+
+		rel, err := filepath.Rel(updatePath, p)
+		if err != nil {
+			return err
+		}
+		result.Files[filepath.ToSlash(rel)] = FileResult{Objects: objects}
+
+		rel, err = filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, FileChange{Path: filepath.ToSlash(rel), Before: before, After: after.Bytes()})
+		return nil
+	})
+	if err != nil {
+		return nil, result, err
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, result, nil
+}
+
+// applySetters sets the scalar values marked with a setter of the policies
+// in the node and returns the images of the changed values.
+func applySetters(node *yaml.Node, setters map[string]setterValue) []imageRef {
+	var refs []imageRef
+	if node.Kind == yaml.ScalarNode {
+		setter, ok := setterName(node.LineComment)
+		if !ok {
+			return nil
+		}
+		v, ok := setters[setter]
+		if !ok || node.Value == v.value {
+			return nil
+		}
+		node.Value = v.value
+		return append(refs, v.ref)
+	}
+	for _, n := range node.Content {
+		refs = append(refs, applySetters(n, setters)...)
+	}
+	return refs
+}
+
+// setterName returns the setter of a marker comment, e.g.
+// '# {"$imagepolicy": "flux-system:podinfo:tag"}'.
+func setterName(comment string) (string, bool) {
+	comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "#"))
+	if !strings.Contains(comment, SetterToken) {
+		return "", false
+	}
+	var marker map[string]interface{}
+	if err := json.Unmarshal([]byte(comment), &marker); err != nil {
+		return "", false
+	}
+	setter, ok := marker[SetterToken].(string)
+	return setter, ok
+}
+
+func appendRef(refs []ImageRef, ref imageRef) []ImageRef {
+	for _, r := range refs {
+		if r.String() == ref.String() {
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imageupdate
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+)
+
+func testPolicies() []imagev1.ImagePolicy {
+	return []imagev1.ImagePolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux-system"},
+			Status:     imagev1.ImagePolicyStatus{LatestImage: "ghcr.io/stefanprodan/podinfo:6.2.0"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown", Namespace: "flux-system"},
+		},
+	}
+}
+
+func TestUpdateWithSetters(t *testing.T) {
+	changes, result, err := UpdateWithSetters("testdata", "apps", testPolicies())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Path != "apps/podinfo/deployment.yaml" {
+		t.Fatalf("expected a change of apps/podinfo/deployment.yaml, got %v", changes)
+	}
+	after := string(changes[0].After)
+	for _, want := range []string{
+		"# podinfo deployment\n",
+		`image: ghcr.io/stefanprodan/podinfo:6.2.0 # {"$imagepolicy": "flux-system:podinfo"}`,
+		`image: busybox:1.35 # {"$imagepolicy": "flux-system:unknown"}`,
+		`repository: ghcr.io/stefanprodan/podinfo # {"$imagepolicy": "flux-system:podinfo:name"}`,
+		`tag: 6.2.0 # {"$imagepolicy": "flux-system:podinfo:tag"}`,
+		"      - name: podinfo\n",
+	} {
+		if !strings.Contains(after, want) {
+			t.Errorf("expected %q in the updated file:\n%s", want, after)
+		}
+	}
+
+	file, ok := result.Files["podinfo/deployment.yaml"]
+	if !ok || len(result.Files) != 1 {
+		t.Fatalf("expected the result of podinfo/deployment.yaml, got %v", result.Files)
+	}
+	if len(file.Objects) != 2 {
+		t.Errorf("expected 2 updated objects, got %d", len(file.Objects))
+	}
+	for id, refs := range result.Objects() {
+		if id.Name != "podinfo" || len(refs) != 1 {
+			t.Errorf("unexpected object %v with images %v", id, refs)
+		}
+	}
+
+	images := result.Images()
+	if len(images) != 1 {
+		t.Fatalf("expected 1 image, got %v", images)
+	}
+	image := images[0]
+	if image.String() != "ghcr.io/stefanprodan/podinfo:6.2.0" ||
+		image.Identifier() != "6.2.0" ||
+		image.Name() != "ghcr.io/stefanprodan/podinfo" ||
+		image.Repository() != "stefanprodan/podinfo" ||
+		image.Registry() != "ghcr.io" ||
+		image.Policy() != (types.NamespacedName{Namespace: "flux-system", Name: "podinfo"}) {
+		t.Errorf("unexpected image %v", image)
+	}
+}
+
+func TestUpdateWithSetters_UpToDate(t *testing.T) {
+	policies := testPolicies()
+	policies[0].Status.LatestImage = "ghcr.io/stefanprodan/podinfo:6.0.0"
+	changes, result, err := UpdateWithSetters("testdata", "", policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 || len(result.Files) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	_, result, err := UpdateWithSetters("testdata", "", testPolicies())
+	if err != nil {
+		t.Fatal(err)
+	}
+	automation := types.NamespacedName{Namespace: "flux-system", Name: "flux-system"}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "default template",
+			want: DefaultCommitTemplate,
+		},
+		{
+			name: "template",
+			template: `Automation: {{ .AutomationObject }}
+{{ range $filename, $_ := .Updated.Files -}}
+- {{ $filename }}
+{{ end -}}
+{{ range .Updated.Images -}}
+- {{ . }} ({{ .Policy.Name }})
+{{ end -}}`,
+			want: `Automation: flux-system/flux-system
+- apps/podinfo/deployment.yaml
+- ghcr.io/stefanprodan/podinfo:6.2.0 (podinfo)
+`,
+		},
+		{
+			name:     "invalid template",
+			template: "{{ .Updated.Unknown }}",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CommitMessage(tt.template, automation, result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected message:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
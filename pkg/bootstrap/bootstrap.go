@@ -34,6 +34,7 @@ import (
 	"github.com/fluxcd/pkg/apis/meta"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
 
+	"github.com/fluxcd/flux2/pkg/log"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sync"
@@ -77,24 +78,98 @@ type RepositoryReconciler interface {
 
 type PostGenerateSecretFunc func(ctx context.Context, secret corev1.Secret, options sourcesecret.Options) error
 
+// RunOption configures the behaviour of Run.
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	journal JournalStore
+	restart bool
+	logger  log.Logger
+}
+
+// WithJournal records the completed steps in the given JournalStore, and
+// skips the steps recorded by a previous run with the same configuration.
+func WithJournal(store JournalStore) RunOption {
+	return func(o *runOptions) {
+		o.journal = store
+	}
+}
+
+// WithRestart ignores the steps recorded by a previous run, and runs all
+// steps again.
+func WithRestart() RunOption {
+	return func(o *runOptions) {
+		o.restart = true
+	}
+}
+
+// WithRunLogger sets the logger used to report about the journal.
+func WithRunLogger(logger log.Logger) RunOption {
+	return func(o *runOptions) {
+		o.logger = logger
+	}
+}
+
 func Run(ctx context.Context, reconciler Reconciler, manifestsBase string,
 	installOpts install.Options, secretOpts sourcesecret.Options, syncOpts sync.Options,
-	pollInterval, timeout time.Duration) error {
+	pollInterval, timeout time.Duration, opts ...RunOption) error {
+
+	o := runOptions{logger: log.NopLogger{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	journal, err := loadJournal(ctx, o, journalFingerprint(installOpts, secretOpts, syncOpts))
+	if err != nil {
+		return err
+	}
+
+	// runStep runs the step unless it has been completed by a previous
+	// run, and records it in the journal on success.
+	runStep := func(step Step, fn func() error) error {
+		if journal.IsCompleted(step) {
+			o.logger.Successf("%s step completed at %s, skipping", step, journal.Completed[step].Format(time.RFC3339))
+			return nil
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+		if o.journal != nil {
+			journal.Completed[step] = time.Now().UTC()
+			if err := o.journal.Save(ctx, journal); err != nil {
+				o.logger.Warningf("failed to record %s step in bootstrap journal: %s", step, err)
+			}
+		}
+		return nil
+	}
 
-	var err error
 	if r, ok := reconciler.(RepositoryReconciler); ok {
-		if err = r.ReconcileRepository(ctx); err != nil && !errors.Is(err, ErrReconciledWithWarning) {
+		// The repository is always reconciled, as the subsequent steps
+		// depend on the repository details it resolves.
+		delete(journal.Completed, StepRepository)
+		if err = runStep(StepRepository, func() error {
+			if err := r.ReconcileRepository(ctx); err != nil && !errors.Is(err, ErrReconciledWithWarning) {
+				return err
+			}
+			return nil
+		}); err != nil {
 			return err
 		}
 	}
 
-	if err := reconciler.ReconcileComponents(ctx, manifestsBase, installOpts, secretOpts); err != nil {
+	if err := runStep(StepComponents, func() error {
+		return reconciler.ReconcileComponents(ctx, manifestsBase, installOpts, secretOpts)
+	}); err != nil {
 		return err
 	}
-	if err := reconciler.ReconcileSourceSecret(ctx, secretOpts); err != nil {
+	if err := runStep(StepSecret, func() error {
+		return reconciler.ReconcileSourceSecret(ctx, secretOpts)
+	}); err != nil {
 		return err
 	}
-	if err := reconciler.ReconcileSyncConfig(ctx, syncOpts); err != nil {
+	if err := runStep(StepSync, func() error {
+		return reconciler.ReconcileSyncConfig(ctx, syncOpts)
+	}); err != nil {
 		return err
 	}
 
@@ -109,10 +184,50 @@ func Run(ctx context.Context, reconciler Reconciler, manifestsBase string,
 		// Composing a "smart" error message here from the returned
 		// errors does not result in any useful information for the
 		// user, as both methods log the failures they run into.
-		err = fmt.Errorf("bootstrap failed with %d health check failure(s)", healthErrCount)
+		return fmt.Errorf("bootstrap failed with %d health check failure(s)", healthErrCount)
 	}
 
-	return err
+	// The health checks passed and the bootstrap is complete, start
+	// from the beginning on the next run
+	if o.journal != nil {
+		if err := o.journal.Delete(ctx); err != nil {
+			o.logger.Warningf("failed to delete bootstrap journal: %s", err)
+		}
+	}
+	return nil
+}
+
+// loadJournal returns the journal of a previous run from the configured
+// store if it matches the fingerprint, or a new empty journal.
+func loadJournal(ctx context.Context, o runOptions, fingerprint string) (*Journal, error) {
+	journal := &Journal{
+		Fingerprint: fingerprint,
+		Completed:   map[Step]time.Time{},
+	}
+	if o.journal == nil {
+		return journal, nil
+	}
+
+	if o.restart {
+		if err := o.journal.Delete(ctx); err != nil {
+			return nil, fmt.Errorf("failed to delete bootstrap journal: %w", err)
+		}
+		return journal, nil
+	}
+
+	previous, err := o.journal.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bootstrap journal: %w", err)
+	}
+	if previous == nil {
+		return journal, nil
+	}
+	if previous.Fingerprint != fingerprint {
+		o.logger.Warningf("configuration changed since the previous bootstrap run, ignoring journal")
+		return journal, nil
+	}
+	o.logger.Actionf("resuming bootstrap from journal")
+	return previous, nil
 }
 
 func mustInstallManifests(ctx context.Context, kube client.Client, namespace string) bool {
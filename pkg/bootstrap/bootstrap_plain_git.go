@@ -17,12 +17,14 @@ limitations under the License.
 package bootstrap
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -34,6 +36,7 @@ import (
 	"sigs.k8s.io/cli-utils/pkg/object"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/kustomize/api/konfig"
+	kustypes "sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/yaml"
 
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
@@ -42,6 +45,7 @@ import (
 
 	"github.com/fluxcd/flux2/internal/utils"
 	"github.com/fluxcd/flux2/pkg/log"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
 	"github.com/fluxcd/flux2/pkg/manifestgen/install"
 	"github.com/fluxcd/flux2/pkg/manifestgen/kustomization"
 	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
@@ -58,9 +62,13 @@ type PlainGitBootstrapper struct {
 	signature             git.Signature
 	commitMessageAppendix string
 
-	gpgKeyRing    openpgp.EntityList
-	gpgPassphrase string
-	gpgKeyID      string
+	signer CommitSigner
+
+	componentPatches []kustypes.Patch
+
+	sopsAge bool
+
+	gitLock gosync.Locker
 
 	restClientGetter  genericclioptions.RESTClientGetter
 	restClientOptions *runclient.Options
@@ -108,33 +116,12 @@ func NewPlainGitProvider(git repository.Client, kube client.Client, opts ...GitO
 }
 
 func (b *PlainGitBootstrapper) ReconcileComponents(ctx context.Context, manifestsBase string, options install.Options, _ sourcesecret.Options) error {
-	// Clone if not already
-	if _, err := b.gitClient.Head(); err != nil {
-		if err != git.ErrNoGitRepository {
-			return err
-		}
+	unlock := b.lockGit()
+	defer unlock()
 
-		b.logger.Actionf("cloning branch %q from Git repository %q", b.branch, b.url)
-		var cloned bool
-		if err = retry(1, 2*time.Second, func() (err error) {
-			_, err = b.gitClient.Clone(ctx, b.url, repository.CloneOptions{
-				CheckoutStrategy: repository.CheckoutStrategy{
-					Branch: b.branch,
-				},
-			})
-			if err != nil {
-				b.logger.Warningf(" clone failure: %s", err)
-			}
-			if err == nil {
-				cloned = true
-			}
-			return
-		}); err != nil {
-			return fmt.Errorf("failed to clone repository: %w", err)
-		}
-		if cloned {
-			b.logger.Successf("cloned repository")
-		}
+	// Clone if not already
+	if err := b.cloneIfNotExists(ctx); err != nil {
+		return err
 	}
 
 	// Generate component manifests
@@ -145,25 +132,26 @@ func (b *PlainGitBootstrapper) ReconcileComponents(ctx context.Context, manifest
 	}
 	b.logger.Successf("generated component manifests")
 
-	// Write generated files and make a commit
-	var signer *openpgp.Entity
-	if b.gpgKeyRing != nil {
-		signer, err = getOpenPgpEntity(b.gpgKeyRing, b.gpgPassphrase, b.gpgKeyID)
+	// Verify the component patches before committing anything
+	var patched []byte
+	if len(b.componentPatches) > 0 {
+		b.logger.Actionf("verifying component patches")
+		patched, err = kustomization.VerifyPatches(manifests.Content, b.componentPatches)
 		if err != nil {
-			return fmt.Errorf("failed to generate OpenPGP entity: %w", err)
+			return fmt.Errorf("component patches verification failed: %w", err)
 		}
+		b.logger.Successf("verified component patches")
 	}
+
+	// Write generated files and make a commit
 	commitMsg := fmt.Sprintf("Add Flux %s component manifests", options.Version)
 	if b.commitMessageAppendix != "" {
 		commitMsg = commitMsg + "\n\n" + b.commitMessageAppendix
 	}
 
-	commit, err := b.gitClient.Commit(git.Commit{
-		Author:  b.signature,
-		Message: commitMsg,
-	}, repository.WithFiles(map[string]io.Reader{
+	commit, err := b.commit(commitMsg, map[string]io.Reader{
 		manifests.Path: strings.NewReader(manifests.Content),
-	}), repository.WithSigner(signer))
+	})
 	if err != nil && err != git.ErrNoStagedFiles {
 		return fmt.Errorf("failed to commit sync manifests: %w", err)
 	}
@@ -178,13 +166,28 @@ func (b *PlainGitBootstrapper) ReconcileComponents(ctx context.Context, manifest
 		b.logger.Successf("component manifests are up to date")
 	}
 
-	// Conditionally install manifests
+	// Conditionally install manifests, the lock is held while applying as
+	// the manifests are read from the shared clone
 	if mustInstallManifests(ctx, b.kube, options.Namespace) {
 		b.logger.Actionf("installing components in %q namespace", options.Namespace)
 
 		componentsYAML := filepath.Join(b.gitClient.Path(), manifests.Path)
 		kfile := filepath.Join(filepath.Dir(componentsYAML), konfig.DefaultKustomizationFileName())
-		if _, err := os.Stat(kfile); err == nil {
+		if patched != nil {
+			// Apply the components with the verified patches
+			tmpDir, err := manifestgen.MkdirTempAbs("", "flux-components-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+			patchedYAML := filepath.Join(tmpDir, filepath.Base(manifests.Path))
+			if err := os.WriteFile(patchedYAML, patched, 0o600); err != nil {
+				return err
+			}
+			if _, err := utils.Apply(ctx, b.restClientGetter, b.restClientOptions, tmpDir, patchedYAML); err != nil {
+				return err
+			}
+		} else if _, err := os.Stat(kfile); err == nil {
 			// Apply the components and their patches
 			if _, err := utils.Apply(ctx, b.restClientGetter, b.restClientOptions, b.gitClient.Path(), kfile); err != nil {
 				return err
@@ -252,31 +255,27 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 		return fmt.Errorf("sync path configuration (%q) would overwrite path (%q) of existing Kustomization", options.TargetPath, curPath)
 	}
 
+	unlock := b.lockGit()
+	defer unlock()
+
 	// Clone if not already
-	if _, err := b.gitClient.Head(); err != nil {
-		if err == git.ErrNoGitRepository {
-			b.logger.Actionf("cloning branch %q from Git repository %q", b.branch, b.url)
-			var cloned bool
-			if err = retry(1, 2*time.Second, func() (err error) {
-				_, err = b.gitClient.Clone(ctx, b.url, repository.CloneOptions{
-					CheckoutStrategy: repository.CheckoutStrategy{
-						Branch: b.branch,
-					},
-				})
-				if err == nil {
-					cloned = true
-				}
-				return
-			}); err != nil {
-				return fmt.Errorf("failed to clone repository: %w", err)
-			}
-			if cloned {
-				b.logger.Successf("cloned repository")
-			}
-		}
+	if err := b.cloneIfNotExists(ctx); err != nil {
 		return err
 	}
 
+	files := map[string]io.Reader{}
+
+	// Generate the SOPS age key and configuration
+	if b.sopsAge {
+		sopsFiles, err := b.reconcileSOPSAge(ctx, options)
+		if err != nil {
+			return err
+		}
+		for k, v := range sopsFiles {
+			files[k] = v
+		}
+	}
+
 	// Generate sync manifests and write to Git repository
 	b.logger.Actionf("generating sync manifests")
 	manifests, err := sync.Generate(options)
@@ -299,6 +298,7 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 		FileSystem: fs,
 		BaseDir:    b.gitClient.Path(),
 		TargetPath: filepath.Dir(manifests.Path),
+		Patches:    b.componentPatches,
 	})
 	if err != nil {
 		return fmt.Errorf("%s generation failed: %w", konfig.DefaultKustomizationFileName(), err)
@@ -306,24 +306,13 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 	b.logger.Successf("generated sync manifests")
 
 	// Write generated files and make a commit
-	var signer *openpgp.Entity
-	if b.gpgKeyRing != nil {
-		signer, err = getOpenPgpEntity(b.gpgKeyRing, b.gpgPassphrase, b.gpgKeyID)
-		if err != nil {
-			return fmt.Errorf("failed to generate OpenPGP entity: %w", err)
-		}
-	}
 	commitMsg := fmt.Sprintf("Add Flux sync manifests")
 	if b.commitMessageAppendix != "" {
 		commitMsg = commitMsg + "\n\n" + b.commitMessageAppendix
 	}
 
-	commit, err := b.gitClient.Commit(git.Commit{
-		Author:  b.signature,
-		Message: commitMsg,
-	}, repository.WithFiles(map[string]io.Reader{
-		kusManifests.Path: strings.NewReader(kusManifests.Content),
-	}), repository.WithSigner(signer))
+	files[kusManifests.Path] = strings.NewReader(kusManifests.Content)
+	commit, err := b.commit(commitMsg, files)
 	if err != nil && err != git.ErrNoStagedFiles {
 		return fmt.Errorf("failed to commit sync manifests: %w", err)
 	}
@@ -351,6 +340,7 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 				}); err != nil {
 					return fmt.Errorf("failed to clone repository: %w", err)
 				}
+				unlock()
 				return b.ReconcileSyncConfig(ctx, options)
 			}
 			return fmt.Errorf("failed to push sync manifests: %w", err)
@@ -359,7 +349,8 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 		b.logger.Successf("sync manifests are up to date")
 	}
 
-	// Apply to cluster
+	// Apply to cluster, the lock is held while applying as the manifests
+	// are read from the shared clone
 	b.logger.Actionf("applying sync manifests")
 	if _, err := utils.Apply(ctx, b.restClientGetter, b.restClientOptions, b.gitClient.Path(), filepath.Join(b.gitClient.Path(), kusManifests.Path)); err != nil {
 		return err
@@ -370,8 +361,62 @@ func (b *PlainGitBootstrapper) ReconcileSyncConfig(ctx context.Context, options
 	return nil
 }
 
+// reconcileSOPSAge ensures the decryption Secret of the sync options holds
+// an age key, and returns the SOPS configuration files with a creation rule
+// for the sync path encrypting with the age key.
+func (b *PlainGitBootstrapper) reconcileSOPSAge(ctx context.Context, options sync.Options) (map[string]io.Reader, error) {
+	if options.DecryptionProvider != "sops" || options.DecryptionSecret == "" {
+		return nil, fmt.Errorf("SOPS age requires the sync decryption provider to be 'sops' with a secret")
+	}
+
+	secretKey := client.ObjectKey{Name: options.DecryptionSecret, Namespace: options.Namespace}
+	b.logger.Actionf("reconciling SOPS age secret %q", secretKey)
+	recipient, created, err := reconcileSOPSAgeSecret(ctx, b.kube, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile SOPS age secret: %w", err)
+	}
+	if created {
+		b.logger.Successf("generated SOPS age key with public key %q", recipient)
+	} else {
+		b.logger.Successf("SOPS age secret exists with public key %q", recipient)
+	}
+
+	existing, err := readFileIfExists(filepath.Join(b.gitClient.Path(), SOPSConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+	sopsConfig, err := generateSOPSConfig(existing, options.TargetPath, recipient)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]io.Reader{
+		SOPSConfigFileName: bytes.NewReader(sopsConfig),
+	}
+
+	// The SOPS configuration is not a Kubernetes manifest, exclude it from
+	// the source when it is in the sync path
+	if sopsPathRegex(options.TargetPath) == sopsPathRegex("") {
+		existing, err := readFileIfExists(filepath.Join(b.gitClient.Path(), sourceIgnoreFileName))
+		if err != nil {
+			return nil, err
+		}
+		if sourceIgnore := addSourceIgnore(existing, "/"+SOPSConfigFileName); sourceIgnore != nil {
+			files[sourceIgnoreFileName] = bytes.NewReader(sourceIgnore)
+		}
+	}
+	return files, nil
+}
+
 func (b *PlainGitBootstrapper) ReportKustomizationHealth(ctx context.Context, options sync.Options, pollInterval, timeout time.Duration) error {
+	// Clone if not already, as the previous steps may have been
+	// completed by an earlier run
+	unlock := b.lockGit()
+	if err := b.cloneIfNotExists(ctx); err != nil {
+		unlock()
+		return err
+	}
 	head, err := b.gitClient.Head()
+	unlock()
 	if err != nil {
 		return err
 	}
@@ -424,6 +469,80 @@ func (b *PlainGitBootstrapper) ReportComponentsHealth(ctx context.Context, insta
 	return nil
 }
 
+// lockGit acquires the Git lock, if one is configured for sharing the
+// Git repository with other bootstrappers. It returns a function to
+// release the lock, which is safe to call more than once.
+func (b *PlainGitBootstrapper) lockGit() func() {
+	if b.gitLock == nil {
+		return func() {}
+	}
+	b.gitLock.Lock()
+	var once gosync.Once
+	return func() {
+		once.Do(b.gitLock.Unlock)
+	}
+}
+
+// cloneIfNotExists clones the branch of the Git repository, unless it has
+// already been cloned.
+func (b *PlainGitBootstrapper) cloneIfNotExists(ctx context.Context) error {
+	if _, err := b.gitClient.Head(); err == nil {
+		return nil
+	} else if err != git.ErrNoGitRepository {
+		return err
+	}
+
+	b.logger.Actionf("cloning branch %q from Git repository %q", b.branch, b.url)
+	var cloned bool
+	if err := retry(1, 2*time.Second, func() (err error) {
+		_, err = b.gitClient.Clone(ctx, b.url, repository.CloneOptions{
+			CheckoutStrategy: repository.CheckoutStrategy{
+				Branch: b.branch,
+			},
+		})
+		if err != nil {
+			b.logger.Warningf(" clone failure: %s", err)
+		}
+		if err == nil {
+			cloned = true
+		}
+		return
+	}); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	if cloned {
+		b.logger.Successf("cloned repository")
+	}
+	return nil
+}
+
+// commit writes the given files to the Git repository and commits them
+// with the configured author and signer. When the signer is not backed by
+// OpenPGP, the commit is created unsigned and then replaced by a signed copy.
+func (b *PlainGitBootstrapper) commit(message string, files map[string]io.Reader) (string, error) {
+	opts := []repository.CommitOption{repository.WithFiles(files)}
+	if s, ok := b.signer.(*OpenPGPSigner); ok {
+		entity, err := s.Entity()
+		if err != nil {
+			return "", err
+		}
+		opts = append(opts, repository.WithSigner(entity))
+	}
+
+	commit, err := b.gitClient.Commit(git.Commit{
+		Author:  b.signature,
+		Message: message,
+	}, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := b.signer.(*OpenPGPSigner); b.signer != nil && !ok {
+		return signHead(b.gitClient.Path(), b.signer)
+	}
+	return commit, nil
+}
+
 func getOpenPgpEntity(keyRing openpgp.EntityList, passphrase, keyID string) (*openpgp.Entity, error) {
 	if len(keyRing) == 0 {
 		return nil, fmt.Errorf("empty GPG key ring")
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/manifestgen/sourcesecret"
+	"github.com/fluxcd/flux2/pkg/manifestgen/sync"
+)
+
+// Step is a bootstrap step recorded in the Journal.
+type Step string
+
+const (
+	StepRepository Step = "repository"
+	StepComponents Step = "components"
+	StepSecret     Step = "secret"
+	StepSync       Step = "sync"
+)
+
+// Journal records the bootstrap steps completed by a run, so that a
+// subsequent run with the same configuration can resume from the step
+// that failed. The health checks are not recorded, as they run last and
+// the journal is removed once they pass.
+type Journal struct {
+	// Fingerprint is a checksum of the configuration the steps were
+	// completed with.
+	Fingerprint string `json:"fingerprint"`
+	// Completed holds the completion time of each completed step.
+	Completed map[Step]time.Time `json:"completed"`
+}
+
+// IsCompleted returns true if the step has been recorded as completed.
+func (j *Journal) IsCompleted(step Step) bool {
+	_, ok := j.Completed[step]
+	return ok
+}
+
+// JournalStore persists the Journal between bootstrap runs.
+type JournalStore interface {
+	// Load returns the stored Journal, or nil if none exists.
+	Load(ctx context.Context) (*Journal, error)
+	// Save stores the Journal.
+	Save(ctx context.Context, journal *Journal) error
+	// Delete removes the stored Journal, if any.
+	Delete(ctx context.Context) error
+}
+
+const (
+	// JournalConfigMapName is the default name of the ConfigMap used
+	// by the ConfigMapJournalStore.
+	JournalConfigMapName = "flux-bootstrap-journal"
+	journalDataKey       = "journal.json"
+)
+
+// ConfigMapJournalStore stores the Journal in a ConfigMap.
+type ConfigMapJournalStore struct {
+	kube   client.Client
+	objKey client.ObjectKey
+}
+
+// NewConfigMapJournalStore returns a ConfigMapJournalStore for the
+// ConfigMap with the given name and namespace.
+func NewConfigMapJournalStore(kube client.Client, name, namespace string) *ConfigMapJournalStore {
+	return &ConfigMapJournalStore{
+		kube:   kube,
+		objKey: client.ObjectKey{Name: name, Namespace: namespace},
+	}
+}
+
+// Load implements JournalStore.
+func (s *ConfigMapJournalStore) Load(ctx context.Context) (*Journal, error) {
+	var cm corev1.ConfigMap
+	if err := s.kube.Get(ctx, s.objKey, &cm); err != nil {
+		if apierr.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data, ok := cm.Data[journalDataKey]
+	if !ok {
+		return nil, nil
+	}
+	return decodeJournal([]byte(data))
+}
+
+// Save implements JournalStore. The ConfigMap is not created while its
+// namespace does not exist, which is the case until the components have
+// been installed. As the Journal is saved as a whole, the steps completed
+// before are recorded on the first Save after the namespace is created.
+func (s *ConfigMapJournalStore) Save(ctx context.Context, journal *Journal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+
+	var existing corev1.ConfigMap
+	if err := s.kube.Get(ctx, s.objKey, &existing); err != nil {
+		if !apierr.IsNotFound(err) {
+			return err
+		}
+		cm := corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.objKey.Name,
+				Namespace: s.objKey.Namespace,
+			},
+			Data: map[string]string{journalDataKey: string(data)},
+		}
+		if err := s.kube.Create(ctx, &cm); err != nil && !apierr.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	if existing.Data == nil {
+		existing.Data = map[string]string{}
+	}
+	existing.Data[journalDataKey] = string(data)
+	return s.kube.Update(ctx, &existing)
+}
+
+// Delete implements JournalStore.
+func (s *ConfigMapJournalStore) Delete(ctx context.Context) error {
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.objKey.Name,
+			Namespace: s.objKey.Namespace,
+		},
+	}
+	if err := s.kube.Delete(ctx, &cm); err != nil && !apierr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// FileJournalStore stores the Journal in a local file.
+type FileJournalStore struct {
+	path string
+}
+
+// NewFileJournalStore returns a FileJournalStore for the file at the
+// given path.
+func NewFileJournalStore(path string) *FileJournalStore {
+	return &FileJournalStore{path: path}
+}
+
+// Load implements JournalStore.
+func (s *FileJournalStore) Load(_ context.Context) (*Journal, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeJournal(data)
+}
+
+// Save implements JournalStore.
+func (s *FileJournalStore) Save(_ context.Context, journal *Journal) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// Delete implements JournalStore.
+func (s *FileJournalStore) Delete(_ context.Context) error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func decodeJournal(data []byte) (*Journal, error) {
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("failed to decode bootstrap journal: %w", err)
+	}
+	if j.Completed == nil {
+		j.Completed = map[Step]time.Time{}
+	}
+	return &j, nil
+}
+
+// journalFingerprint returns a checksum of the configuration options which
+// affect the outcome of the bootstrap steps. Options which only affect the
+// way a run is performed, like timeouts, are excluded so that a failed run
+// can be resumed with e.g. a longer timeout. The fingerprint is stored in
+// the cluster, secret values like the Git password are excluded, the public
+// key identifies the deploy key.
+func journalFingerprint(installOpts install.Options, secretOpts sourcesecret.Options, syncOpts sync.Options) string {
+	installOpts.Timeout = 0
+	if u, err := url.Parse(syncOpts.URL); err == nil && u.User != nil {
+		u.User = url.User(u.User.Username())
+		syncOpts.URL = u.String()
+	}
+
+	secret := struct {
+		Name                string
+		Namespace           string
+		SSHHostname         string
+		PrivateKeyAlgorithm sourcesecret.PrivateKeyAlgorithm
+		RSAKeyBits          int
+		ECDSACurve          string
+		PublicKey           []byte
+		Username            string
+		CAFile              []byte
+		TargetPath          string
+	}{
+		Name:                secretOpts.Name,
+		Namespace:           secretOpts.Namespace,
+		SSHHostname:         secretOpts.SSHHostname,
+		PrivateKeyAlgorithm: secretOpts.PrivateKeyAlgorithm,
+		RSAKeyBits:          secretOpts.RSAKeyBits,
+		Username:            secretOpts.Username,
+		CAFile:              secretOpts.CAFile,
+		TargetPath:          secretOpts.TargetPath,
+	}
+	if secretOpts.ECDSACurve != nil {
+		secret.ECDSACurve = secretOpts.ECDSACurve.Params().Name
+	}
+	if secretOpts.Keypair != nil {
+		secret.PublicKey = secretOpts.Keypair.PublicKey
+	}
+
+	data, _ := json.Marshal(struct {
+		Install install.Options
+		Secret  interface{}
+		Sync    sync.Options
+	}{installOpts, secret, syncOpts})
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
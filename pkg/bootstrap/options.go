@@ -19,8 +19,10 @@ package bootstrap
 import (
 	"fmt"
 	"os"
+	gosync "sync"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	kustypes "sigs.k8s.io/kustomize/api/types"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/fluxcd/pkg/git"
@@ -122,26 +124,78 @@ func (o loggerOption) applyGitProvider(b *GitProviderBootstrapper) {
 }
 
 func WithGitCommitSigning(gpgKeyRing openpgp.EntityList, passphrase, keyID string) Option {
-	return gitCommitSigningOption{
-		gpgKeyRing:    gpgKeyRing,
-		gpgPassphrase: passphrase,
-		gpgKeyID:      keyID,
+	if gpgKeyRing == nil {
+		return commitSignerOption{}
 	}
+	return commitSignerOption{
+		signer: NewOpenPGPSigner(gpgKeyRing, passphrase, keyID),
+	}
+}
+
+func WithCommitSigner(signer CommitSigner) Option {
+	return commitSignerOption{signer}
+}
+
+type commitSignerOption struct {
+	signer CommitSigner
 }
 
-type gitCommitSigningOption struct {
-	gpgKeyRing    openpgp.EntityList
-	gpgPassphrase string
-	gpgKeyID      string
+func (o commitSignerOption) applyGit(b *PlainGitBootstrapper) {
+	if o.signer != nil {
+		b.signer = o.signer
+	}
 }
 
-func (o gitCommitSigningOption) applyGit(b *PlainGitBootstrapper) {
-	b.gpgKeyRing = o.gpgKeyRing
-	b.gpgPassphrase = o.gpgPassphrase
-	b.gpgKeyID = o.gpgKeyID
+func (o commitSignerOption) applyGitProvider(b *GitProviderBootstrapper) {
+	o.applyGit(b.PlainGitBootstrapper)
+}
+
+func WithComponentPatches(patches []kustypes.Patch) Option {
+	return componentPatchesOption(patches)
+}
+
+type componentPatchesOption []kustypes.Patch
+
+func (o componentPatchesOption) applyGit(b *PlainGitBootstrapper) {
+	b.componentPatches = o
+}
+
+func (o componentPatchesOption) applyGitProvider(b *GitProviderBootstrapper) {
+	o.applyGit(b.PlainGitBootstrapper)
+}
+
+// WithGitLock sets the lock guarding the Git operations, for multiple
+// bootstrappers sharing the same Git repository client concurrently.
+func WithGitLock(lock gosync.Locker) Option {
+	return gitLockOption{lock}
+}
+
+type gitLockOption struct {
+	lock gosync.Locker
+}
+
+func (o gitLockOption) applyGit(b *PlainGitBootstrapper) {
+	b.gitLock = o.lock
+}
+
+func (o gitLockOption) applyGitProvider(b *GitProviderBootstrapper) {
+	o.applyGit(b.PlainGitBootstrapper)
+}
+
+// WithSOPSAge enables the generation of an age key in the decryption Secret
+// of the sync options, and of a SOPS configuration which encrypts the
+// Secrets in the sync path with it.
+func WithSOPSAge() Option {
+	return sopsAgeOption(true)
+}
+
+type sopsAgeOption bool
+
+func (o sopsAgeOption) applyGit(b *PlainGitBootstrapper) {
+	b.sopsAge = bool(o)
 }
 
-func (o gitCommitSigningOption) applyGitProvider(b *GitProviderBootstrapper) {
+func (o sopsAgeOption) applyGitProvider(b *GitProviderBootstrapper) {
 	o.applyGit(b.PlainGitBootstrapper)
 }
 
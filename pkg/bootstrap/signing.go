@@ -0,0 +1,256 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	gogit "github.com/fluxcd/go-git/v5"
+	"github.com/fluxcd/go-git/v5/plumbing"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// CommitSigner signs the commits made to the Git repository during
+// bootstrap.
+type CommitSigner interface {
+	// Sign returns an armored detached signature for the given commit
+	// payload, as it is expected in the 'gpgsig' header of a Git commit.
+	Sign(payload io.Reader) (string, error)
+}
+
+// OpenPGPSigner signs commits using an OpenPGP key from a key ring.
+type OpenPGPSigner struct {
+	keyRing    openpgp.EntityList
+	passphrase string
+	keyID      string
+}
+
+// NewOpenPGPSigner returns an OpenPGPSigner for the given key ring.
+// The key matching the keyID is used, or the first key in the key ring
+// if no keyID is provided.
+func NewOpenPGPSigner(keyRing openpgp.EntityList, passphrase, keyID string) *OpenPGPSigner {
+	return &OpenPGPSigner{
+		keyRing:    keyRing,
+		passphrase: passphrase,
+		keyID:      keyID,
+	}
+}
+
+// Entity returns the decrypted OpenPGP entity used for signing.
+func (s *OpenPGPSigner) Entity() (*openpgp.Entity, error) {
+	entity, err := getOpenPgpEntity(s.keyRing, s.passphrase, s.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate OpenPGP entity: %w", err)
+	}
+	return entity, nil
+}
+
+// Sign implements CommitSigner.
+func (s *OpenPGPSigner) Sign(payload io.Reader) (string, error) {
+	entity, err := s.Entity()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, entity, payload, nil); err != nil {
+		return "", fmt.Errorf("failed to sign commit: %w", err)
+	}
+	return b.String(), nil
+}
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigVersion   = 1
+	sshSigNamespace = "git"
+	sshSigHashAlgo  = "sha512"
+	sshSigArmorHead = "-----BEGIN SSH SIGNATURE-----"
+	sshSigArmorTail = "-----END SSH SIGNATURE-----"
+)
+
+// SSHSigner signs commits using an SSH key, producing signatures in the
+// format of 'ssh-keygen -Y sign' (see PROTOCOL.sshsig in OpenSSH).
+type SSHSigner struct {
+	signer ssh.Signer
+}
+
+// NewSSHSigner returns an SSHSigner for the given ssh.Signer.
+func NewSSHSigner(signer ssh.Signer) *SSHSigner {
+	return &SSHSigner{signer: signer}
+}
+
+// LoadSSHSignerFromPath returns an SSHSigner for the private key at the
+// given path, decrypted with the passphrase if one is provided.
+func LoadSSHSignerFromPath(path, passphrase string) (*SSHSigner, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH signing key: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse SSH signing key: %w", err)
+	}
+	return NewSSHSigner(signer), nil
+}
+
+// LoadSSHAgentSignerFromPath returns an SSHSigner which delegates the
+// signing to the SSH agent listening on SSH_AUTH_SOCK, using the key
+// matching the public key at the given path.
+func LoadSSHAgentSignerFromPath(path string) (*SSHSigner, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH signing key: %w", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse SSH public key: %w", err)
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set, unable to connect to SSH agent")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to SSH agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list SSH agent keys: %w", err)
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+			return NewSSHSigner(signer), nil
+		}
+	}
+	return nil, fmt.Errorf("no key matching %s found in SSH agent", ssh.FingerprintSHA256(pub))
+}
+
+// Sign implements CommitSigner.
+func (s *SSHSigner) Sign(payload io.Reader) (string, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, payload); err != nil {
+		return "", err
+	}
+
+	signedData := bytes.NewBufferString(sshSigMagic)
+	signedData.Write(ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sshSigNamespace, "", sshSigHashAlgo, h.Sum(nil)}))
+
+	var sig *ssh.Signature
+	var err error
+	if as, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// 'ssh-rsa' (SHA-1) signatures are rejected by Git and OpenSSH
+		sig, err = as.SignWithAlgorithm(rand.Reader, signedData.Bytes(), ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, signedData.Bytes())
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign commit: %w", err)
+	}
+
+	blob := bytes.NewBufferString(sshSigMagic)
+	_ = binary.Write(blob, binary.BigEndian, uint32(sshSigVersion))
+	blob.Write(ssh.Marshal(struct {
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}{s.signer.PublicKey().Marshal(), sshSigNamespace, "", sshSigHashAlgo, ssh.Marshal(sig)}))
+
+	return armorSSHSignature(blob.Bytes()), nil
+}
+
+func armorSSHSignature(blob []byte) string {
+	enc := base64.StdEncoding.EncodeToString(blob)
+	var sb strings.Builder
+	sb.WriteString(sshSigArmorHead + "\n")
+	for len(enc) > 70 {
+		sb.WriteString(enc[:70] + "\n")
+		enc = enc[70:]
+	}
+	sb.WriteString(enc + "\n")
+	sb.WriteString(sshSigArmorTail + "\n")
+	return sb.String()
+}
+
+// signHead replaces the HEAD commit of the Git repository at the given
+// path with a copy signed by the signer, and moves the current branch to
+// it. It returns the hash of the signed commit.
+func signHead(path string, signer CommitSigner) (string, error) {
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+
+	payload := repo.Storer.NewEncodedObject()
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		return "", err
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	sig, err := signer.Sign(r)
+	if err != nil {
+		return "", err
+	}
+	commit.PGPSignature = sig
+
+	signed := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(signed); err != nil {
+		return "", err
+	}
+	hash, err := repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return "", fmt.Errorf("failed to store signed commit: %w", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash)); err != nil {
+		return "", fmt.Errorf("failed to update %s: %w", head.Name().Short(), err)
+	}
+	return hash.String(), nil
+}
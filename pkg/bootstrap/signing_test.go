@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/fluxcd/go-git/v5"
+	"github.com/fluxcd/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+)
+
+func Test_SSHSignerSign(t *testing.T) {
+	for _, algo := range []string{"rsa", "ecdsa", "ed25519"} {
+		t.Run(algo, func(t *testing.T) {
+			key, err := ssh.ParsePrivateKey(testdata.PEMBytes[algo])
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			payload := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\ncommit message\n"
+			armored, err := NewSSHSigner(key).Sign(strings.NewReader(payload))
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if !strings.HasPrefix(armored, sshSigArmorHead+"\n") || !strings.HasSuffix(armored, sshSigArmorTail+"\n") {
+				t.Fatalf("signature is not armored:\n%s", armored)
+			}
+
+			if err := verifySSHSignature(key.PublicKey(), armored, payload); err != nil {
+				t.Errorf("signature verification failed: %s", err)
+			}
+			if err := verifySSHSignature(key.PublicKey(), armored, payload+"tampered"); err == nil {
+				t.Errorf("expected verification of tampered payload to fail")
+			}
+		})
+	}
+}
+
+func Test_signHead(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("flux"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := wt.Commit("initial commit", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "Flux", Email: "flux@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.ParsePrivateKey(testdata.PEMBytes["ed25519"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := signHead(dir, NewSSHSigner(key))
+	if err != nil {
+		t.Fatalf("signHead() error = %v", err)
+	}
+	if hash == unsigned.String() {
+		t.Fatalf("expected HEAD to point to a new commit")
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash().String() != hash {
+		t.Errorf("HEAD %s != %s", head.Hash(), hash)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Message != "initial commit" {
+		t.Errorf("unexpected commit message %q", commit.Message)
+	}
+
+	payload := repo.Storer.NewEncodedObject()
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		t.Fatal(err)
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySSHSignature(key.PublicKey(), commit.PGPSignature, b.String()); err != nil {
+		t.Errorf("signature verification failed: %s", err)
+	}
+}
+
+func verifySSHSignature(pub ssh.PublicKey, armored, payload string) error {
+	enc := strings.TrimPrefix(strings.TrimSpace(armored), sshSigArmorHead)
+	enc = strings.TrimSuffix(enc, sshSigArmorTail)
+	blob, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(enc, "\n", ""))
+	if err != nil {
+		return err
+	}
+
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob[len(sshSigMagic):], &sig); err != nil {
+		return err
+	}
+	var s ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &s); err != nil {
+		return err
+	}
+
+	h := sha512.Sum512([]byte(payload))
+	signedData := bytes.NewBufferString(sshSigMagic)
+	signedData.Write(ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h[:]}))
+	return pub.Verify(signedData.Bytes(), &s)
+}
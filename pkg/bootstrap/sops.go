@@ -0,0 +1,192 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SOPSAgeSecretName is the default name of the Secret holding the
+	// age key used by the sync Kustomization to decrypt SOPS secrets.
+	SOPSAgeSecretName = "sops-age"
+	// SOPSConfigFileName is the name of the SOPS configuration file
+	// committed to the repository root.
+	SOPSConfigFileName = ".sops.yaml"
+	// sopsAgeSecretKey is the key of the age identity in the Secret, the
+	// kustomize-controller looks up age keys by the '.agekey' suffix.
+	sopsAgeSecretKey     = "age.agekey"
+	sourceIgnoreFileName = ".sourceignore"
+)
+
+// reconcileSOPSAgeSecret returns the age recipient of the identity stored
+// in the Secret, and generates the identity first if the Secret does not
+// exist. An existing identity is never replaced, as secrets encrypted with
+// it would no longer be decryptable in-cluster.
+func reconcileSOPSAgeSecret(ctx context.Context, kube client.Client, objKey client.ObjectKey) (string, bool, error) {
+	var existing corev1.Secret
+	if err := kube.Get(ctx, objKey, &existing); err != nil {
+		if !apierr.IsNotFound(err) {
+			return "", false, err
+		}
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return "", false, fmt.Errorf("failed to generate age key: %w", err)
+		}
+		secret := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objKey.Name,
+				Namespace: objKey.Namespace,
+			},
+			StringData: map[string]string{
+				sopsAgeSecretKey: formatAgeIdentity(identity),
+			},
+		}
+		if err := kube.Create(ctx, &secret); err != nil {
+			return "", false, err
+		}
+		return identity.Recipient().String(), true, nil
+	}
+
+	keys := make([]string, 0, len(existing.Data))
+	for k := range existing.Data {
+		if strings.HasSuffix(k, ".agekey") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		identities, err := age.ParseIdentities(strings.NewReader(string(existing.Data[k])))
+		if err != nil {
+			return "", false, fmt.Errorf("failed to parse age key %q of secret %q: %w", k, objKey, err)
+		}
+		for _, i := range identities {
+			if x, ok := i.(*age.X25519Identity); ok {
+				return x.Recipient().String(), false, nil
+			}
+		}
+	}
+	return "", false, fmt.Errorf("secret %q does not contain an age key", objKey)
+}
+
+// formatAgeIdentity returns the identity in the format of age-keygen.
+func formatAgeIdentity(identity *age.X25519Identity) string {
+	return fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().UTC().Format(time.RFC3339), identity.Recipient(), identity)
+}
+
+// sopsCreationRule is the SOPS creation rule which encrypts the data of the
+// Kubernetes Secrets in a sync path with the age recipient.
+func sopsCreationRule(targetPath, recipient string) map[string]interface{} {
+	return map[string]interface{}{
+		"path_regex":      sopsPathRegex(targetPath),
+		"encrypted_regex": "^(data|stringData)$",
+		"age":             recipient,
+	}
+}
+
+// sopsPathRegex returns the regex of the YAML files in the sync path,
+// relative to the repository root.
+func sopsPathRegex(targetPath string) string {
+	p := strings.Trim(path.Clean("/"+strings.TrimPrefix(targetPath, "./")), "/")
+	if p == "" {
+		return `.*\.ya?ml$`
+	}
+	return "^" + regexp.QuoteMeta(p) + `/.*\.ya?ml$`
+}
+
+// generateSOPSConfig returns the SOPS configuration with the creation rule
+// for the sync path added to, or updated in, the existing configuration.
+// As SOPS uses the first matching rule, the rules of nested paths are put
+// before the rule of the repository root.
+func generateSOPSConfig(existing []byte, targetPath, recipient string) ([]byte, error) {
+	cfg := map[string]interface{}{}
+	if len(existing) > 0 {
+		if err := yaml.Unmarshal(existing, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse existing %s: %w", SOPSConfigFileName, err)
+		}
+	}
+
+	var rules []interface{}
+	if v, ok := cfg["creation_rules"]; ok && v != nil {
+		if rules, ok = v.([]interface{}); !ok {
+			return nil, fmt.Errorf("invalid creation_rules in existing %s", SOPSConfigFileName)
+		}
+	}
+
+	rule := sopsCreationRule(targetPath, recipient)
+	var updated bool
+	for i, r := range rules {
+		if m, ok := r.(map[string]interface{}); ok && m["path_regex"] == rule["path_regex"] {
+			for k, v := range rule {
+				m[k] = v
+			}
+			rules[i] = m
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		if rule["path_regex"] == sopsPathRegex("") {
+			rules = append(rules, rule)
+		} else {
+			rules = append([]interface{}{rule}, rules...)
+		}
+	}
+	cfg["creation_rules"] = rules
+
+	return yaml.Marshal(cfg)
+}
+
+// addSourceIgnore returns the .sourceignore content with the pattern
+// appended, or nil if it is already present.
+func addSourceIgnore(existing []byte, pattern string) []byte {
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return []byte(content + pattern + "\n")
+}
+
+// readFileIfExists returns the content of the file, or nil if it does not
+// exist.
+func readFileIfExists(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return data, nil
+}
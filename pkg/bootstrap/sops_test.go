@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_reconcileSOPSAgeSecret(t *testing.T) {
+	ctx := context.Background()
+	objKey := client.ObjectKey{Name: SOPSAgeSecretName, Namespace: "flux-system"}
+
+	// A missing Secret is created with a new age key
+	kube := fake.NewClientBuilder().Build()
+	recipient, created, err := reconcileSOPSAgeSecret(ctx, kube, objKey)
+	if err != nil {
+		t.Fatalf("reconcileSOPSAgeSecret() error = %v", err)
+	}
+	if !created || !strings.HasPrefix(recipient, "age1") {
+		t.Fatalf("expected a new age key, got %q (created %v)", recipient, created)
+	}
+	var secret corev1.Secret
+	if err := kube.Get(ctx, objKey, &secret); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(secret.StringData[sopsAgeSecretKey]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := identities[0].(*age.X25519Identity).Recipient().String(); got != recipient {
+		t.Errorf("recipient %q does not match the stored identity %q", recipient, got)
+	}
+
+	// An existing age key is kept
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: objKey.Name, Namespace: objKey.Namespace},
+		Data:       map[string][]byte{"cluster.agekey": []byte(formatAgeIdentity(identity))},
+	}
+	kube = fake.NewClientBuilder().WithObjects(existing).Build()
+	recipient, created, err = reconcileSOPSAgeSecret(ctx, kube, objKey)
+	if err != nil {
+		t.Fatalf("reconcileSOPSAgeSecret() error = %v", err)
+	}
+	if created || recipient != identity.Recipient().String() {
+		t.Errorf("expected existing age key to be used, got %q (created %v)", recipient, created)
+	}
+
+	// A Secret without age key is an error
+	existing.Data = map[string][]byte{"sops.asc": []byte("gpg")}
+	kube = fake.NewClientBuilder().WithObjects(existing).Build()
+	if _, _, err := reconcileSOPSAgeSecret(ctx, kube, objKey); err == nil {
+		t.Errorf("expected error for secret without age key")
+	}
+}
+
+func Test_generateSOPSConfig(t *testing.T) {
+	existing := []byte(`creation_rules:
+- path_regex: ^clusters/staging/.*\.ya?ml$
+  age: age1old
+  encrypted_regex: ^(data|stringData)$
+`)
+	tests := []struct {
+		name       string
+		existing   []byte
+		targetPath string
+		want       []string
+	}{
+		{
+			name:       "new root config",
+			targetPath: "./",
+			want:       []string{`.*\.ya?ml$`},
+		},
+		{
+			name:       "nested path is put first",
+			existing:   existing,
+			targetPath: "clusters/prod",
+			want:       []string{`^clusters/prod/.*\.ya?ml$`, `^clusters/staging/.*\.ya?ml$`},
+		},
+		{
+			name:       "root path is put last",
+			existing:   existing,
+			targetPath: "",
+			want:       []string{`^clusters/staging/.*\.ya?ml$`, `.*\.ya?ml$`},
+		},
+		{
+			name:       "existing path is updated",
+			existing:   existing,
+			targetPath: "./clusters/staging/",
+			want:       []string{`^clusters/staging/.*\.ya?ml$`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := generateSOPSConfig(tt.existing, tt.targetPath, "age1new")
+			if err != nil {
+				t.Fatalf("generateSOPSConfig() error = %v", err)
+			}
+			var cfg struct {
+				CreationRules []struct {
+					PathRegex string `json:"path_regex"`
+					Age       string `json:"age"`
+				} `json:"creation_rules"`
+			}
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range cfg.CreationRules {
+				got = append(got, r.PathRegex)
+				if r.PathRegex == sopsPathRegex(tt.targetPath) && r.Age != "age1new" {
+					t.Errorf("expected rule %q to use the new recipient, got %q", r.PathRegex, r.Age)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("rules %v != %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addSourceIgnore(t *testing.T) {
+	if got := string(addSourceIgnore(nil, "/.sops.yaml")); got != "/.sops.yaml\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := string(addSourceIgnore([]byte("*.md"), "/.sops.yaml")); got != "*.md\n/.sops.yaml\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := addSourceIgnore([]byte("*.md\n/.sops.yaml\n"), "/.sops.yaml"); got != nil {
+		t.Errorf("expected no change, got %q", got)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package check runs the checks of the Flux installation and returns typed
+// results, for the CLI and for programs that verify clusters at scale.
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/version"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+	"github.com/fluxcd/flux2/pkg/manifestgen/install"
+	"github.com/fluxcd/flux2/pkg/status"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Result is a finding of a check.
+type Result struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+	// Status is the outcome of the check.
+	Status Status `json:"status"`
+	// Message describes the finding.
+	Message string `json:"message"`
+	// Hint tells how to remediate the finding if the status is not pass.
+	Hint string `json:"hint,omitempty"`
+	// Component is the name of the Flux component the finding is about.
+	Component string `json:"component,omitempty"`
+	// Versions holds the versions found by the check, e.g. the Kubernetes
+	// version or the image tags of the containers of a component.
+	Versions map[string]string `json:"versions,omitempty"`
+	// Images are the container images of the component.
+	Images []string `json:"images,omitempty"`
+}
+
+// Failed returns true if any of the results has the fail status.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Options holds the configuration of the checks.
+type Options struct {
+	// Namespace is the namespace Flux is installed in.
+	Namespace string
+	// KubernetesConstraints are the semver constraints of the supported
+	// Kubernetes versions.
+	KubernetesConstraints []string
+	// PollInterval is how often the status of the components is polled.
+	PollInterval time.Duration
+	// Timeout is how long to wait for the components to be ready.
+	Timeout time.Duration
+}
+
+// MakeDefaultOptions returns the default check options.
+func MakeDefaultOptions() Options {
+	return Options{
+		Namespace:             "flux-system",
+		KubernetesConstraints: []string{">=1.20.6-0"},
+		PollInterval:          5 * time.Second,
+		Timeout:               time.Minute,
+	}
+}
+
+// Checker runs the checks against a cluster.
+type Checker struct {
+	kubeConfig *rest.Config
+	kubeClient client.Client
+	options    Options
+}
+
+// NewChecker returns a Checker for the cluster of the given config and client.
+func NewChecker(kubeConfig *rest.Config, kubeClient client.Client, options Options) *Checker {
+	return &Checker{
+		kubeConfig: kubeConfig,
+		kubeClient: kubeClient,
+		options:    options,
+	}
+}
+
+// FluxVersion checks the given version of the CLI against the latest Flux
+// release, it returns false if the versions can't be compared.
+func FluxVersion(current string) (Result, bool) {
+	curSv, err := version.ParseVersion(current)
+	if err != nil {
+		return Result{}, false
+	}
+	// Exclude development builds.
+	if curSv.Prerelease() != "" {
+		return Result{}, false
+	}
+	latest, err := install.GetLatestVersion()
+	if err != nil {
+		return Result{}, false
+	}
+	latestSv, err := version.ParseVersion(latest)
+	if err != nil {
+		return Result{}, false
+	}
+
+	result := Result{
+		Name:     "flux",
+		Status:   StatusPass,
+		Message:  fmt.Sprintf("flux %s", curSv),
+		Versions: map[string]string{"cli": curSv.String(), "latest": latestSv.String()},
+	}
+	if latestSv.GreaterThan(curSv) {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("flux %s <%s (new version is available, please upgrade)", curSv, latestSv)
+	}
+	return result, true
+}
+
+// Kubernetes checks the version of the Kubernetes API server against the
+// supported versions.
+func (c *Checker) Kubernetes(ctx context.Context) []Result {
+	fail := func(format string, a ...interface{}) []Result {
+		return []Result{{Name: "kubernetes", Status: StatusFail, Message: fmt.Sprintf(format, a...)}}
+	}
+
+	clientSet, err := kubernetes.NewForConfig(c.kubeConfig)
+	if err != nil {
+		return fail("Kubernetes client initialization failed: %s", err.Error())
+	}
+	kv, err := clientSet.Discovery().ServerVersion()
+	if err != nil {
+		return fail("Kubernetes API call failed: %s", err.Error())
+	}
+	v, err := version.ParseVersion(kv.String())
+	if err != nil {
+		return fail("Kubernetes version can't be determined")
+	}
+
+	for _, constraint := range c.options.KubernetesConstraints {
+		cs, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return fail("invalid Kubernetes version constraint %s: %s", constraint, err.Error())
+		}
+		if cs.Check(v) {
+			return []Result{{
+				Name:     "kubernetes",
+				Status:   StatusPass,
+				Message:  fmt.Sprintf("Kubernetes %s %s", v.String(), constraint),
+				Versions: map[string]string{"kubernetes": v.String()},
+			}}
+		}
+	}
+
+	result := fail("Kubernetes version %s does not match %s", v.Original(), strings.Join(c.options.KubernetesConstraints, " || "))
+	result[0].Versions = map[string]string{"kubernetes": v.String()}
+	return result
+}
+
+// Components checks that the deployments of the Flux components are ready.
+func (c *Checker) Components(ctx context.Context) []Result {
+	var list appsv1.DeploymentList
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	if err := c.kubeClient.List(ctx, &list, client.InNamespace(c.options.Namespace), selector); err != nil {
+		return []Result{{
+			Name:    "components",
+			Status:  StatusFail,
+			Message: fmt.Sprintf("unable to list the controllers in the '%s' namespace: %s", c.options.Namespace, err.Error()),
+		}}
+	}
+	if len(list.Items) == 0 {
+		return []Result{{
+			Name:   "components",
+			Status: StatusFail,
+			Message: fmt.Sprintf("no controllers found in the '%s' namespace with the label selector '%s=%s'",
+				c.options.Namespace, manifestgen.PartOfLabelKey, manifestgen.PartOfLabelValue),
+		}}
+	}
+
+	logger := &resultLogger{}
+	statusChecker, err := status.NewStatusChecker(c.kubeConfig, c.options.PollInterval, c.options.Timeout, logger)
+	if err != nil {
+		return []Result{{
+			Name:    "components",
+			Status:  StatusFail,
+			Message: fmt.Sprintf("status checker initialization failed: %s", err.Error()),
+		}}
+	}
+
+	var results []Result
+	for _, d := range list.Items {
+		result := Result{
+			Name:      "components",
+			Component: d.Name,
+			Versions:  map[string]string{},
+		}
+		for _, container := range d.Spec.Template.Spec.Containers {
+			result.Images = append(result.Images, container.Image)
+			result.Versions[container.Name] = imageVersion(container.Image)
+		}
+
+		*logger = resultLogger{}
+		ref := object.ObjMetadata{
+			Namespace: d.Namespace,
+			Name:      d.Name,
+			GroupKind: schema.GroupKind{Group: "apps", Kind: "Deployment"},
+		}
+		err := statusChecker.Assess(ref)
+		result.Status, result.Message = logger.status, logger.message
+		if err != nil {
+			result.Status = StatusFail
+		}
+		if result.Message == "" {
+			result.Message = fmt.Sprintf("%s: deployment not ready", d.Name)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// CRDs checks that the Flux CRDs are installed and have a stored version.
+func (c *Checker) CRDs(ctx context.Context) []Result {
+	var list apiextensionsv1.CustomResourceDefinitionList
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	if err := c.kubeClient.List(ctx, &list, selector); err != nil {
+		return []Result{{
+			Name:    "crds",
+			Status:  StatusFail,
+			Message: fmt.Sprintf("unable to list the crds: %s", err.Error()),
+		}}
+	}
+	if len(list.Items) == 0 {
+		return []Result{{
+			Name:   "crds",
+			Status: StatusFail,
+			Message: fmt.Sprintf("no crds found with the label selector '%s=%s'",
+				manifestgen.PartOfLabelKey, manifestgen.PartOfLabelValue),
+		}}
+	}
+
+	var results []Result
+	for _, crd := range list.Items {
+		versions := crd.Status.StoredVersions
+		if len(versions) == 0 {
+			results = append(results, Result{
+				Name:    "crds",
+				Status:  StatusFail,
+				Message: fmt.Sprintf("no stored versions for %s", crd.Name),
+			})
+			continue
+		}
+		stored := versions[len(versions)-1]
+		results = append(results, Result{
+			Name:     "crds",
+			Status:   StatusPass,
+			Message:  crd.Name + "/" + stored,
+			Versions: map[string]string{"stored": stored},
+		})
+	}
+	return results
+}
+
+// imageVersion returns the tag or the digest of the image.
+func imageVersion(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// resultLogger records the last message logged by the status checker.
+type resultLogger struct {
+	status  Status
+	message string
+}
+
+func (l *resultLogger) Actionf(format string, a ...interface{})   {}
+func (l *resultLogger) Generatef(format string, a ...interface{}) {}
+func (l *resultLogger) Waitingf(format string, a ...interface{})  {}
+
+func (l *resultLogger) Successf(format string, a ...interface{}) {
+	l.status, l.message = StatusPass, fmt.Sprintf(format, a...)
+}
+
+func (l *resultLogger) Warningf(format string, a ...interface{}) {
+	l.status, l.message = StatusWarn, fmt.Sprintf(format, a...)
+}
+
+func (l *resultLogger) Failuref(format string, a ...interface{}) {
+	l.status, l.message = StatusFail, fmt.Sprintf(format, a...)
+}
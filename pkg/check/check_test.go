@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+func TestChecker_CRDs(t *testing.T) {
+	crd := func(name string, stored ...string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue},
+			},
+			Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: stored},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+		want    []Result
+	}{
+		{
+			name: "no crds",
+			want: []Result{{
+				Name:    "crds",
+				Status:  StatusFail,
+				Message: "no crds found with the label selector 'app.kubernetes.io/part-of=flux'",
+			}},
+		},
+		{
+			name: "stored versions",
+			objects: []client.Object{
+				crd("buckets.source.toolkit.fluxcd.io", "v1beta1", "v1beta2"),
+				crd("kustomizations.kustomize.toolkit.fluxcd.io"),
+			},
+			want: []Result{
+				{
+					Name:     "crds",
+					Status:   StatusPass,
+					Message:  "buckets.source.toolkit.fluxcd.io/v1beta2",
+					Versions: map[string]string{"stored": "v1beta2"},
+				},
+				{
+					Name:    "crds",
+					Status:  StatusFail,
+					Message: "no stored versions for kustomizations.kustomize.toolkit.fluxcd.io",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(tt.objects...).Build()
+			checker := NewChecker(nil, kubeClient, MakeDefaultOptions())
+			got := checker.CRDs(context.Background())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CRDs() = %+v, want %+v", got, tt.want)
+			}
+			if Failed(got) != Failed(tt.want) {
+				t.Errorf("Failed() = %v", Failed(got))
+			}
+		})
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/fluxcd/source-controller:v0.36.1":    "v0.36.1",
+		"localhost:5000/fluxcd/source-controller":     "latest",
+		"ghcr.io/fluxcd/source-controller@sha256:abc": "sha256:abc",
+	}
+	for image, want := range tests {
+		if got := imageVersion(image); got != want {
+			t.Errorf("imageVersion(%s) = %s, want %s", image, got, want)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	notificationv1 "github.com/fluxcd/notification-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+// DiagnosticEnv gives the diagnostic checks access to the cluster.
+type DiagnosticEnv struct {
+	KubeClient client.Client
+	Namespace  string
+	// ServerTime returns the current time of the Kubernetes API server.
+	ServerTime func(ctx context.Context) (time.Time, error)
+}
+
+// DiagnosticCheck is a check of common misconfigurations, its results are
+// named after the check.
+type DiagnosticCheck struct {
+	Name string
+	Run  func(ctx context.Context, env *DiagnosticEnv) ([]Result, error)
+}
+
+// diagnosticChecks is the registry of the diagnostic checks, in the order
+// they are run.
+var diagnosticChecks []DiagnosticCheck
+
+// RegisterDiagnosticCheck adds the check to the diagnostic checks run by
+// Checker.Diagnostics.
+func RegisterDiagnosticCheck(check DiagnosticCheck) {
+	diagnosticChecks = append(diagnosticChecks, check)
+}
+
+func init() {
+	RegisterDiagnosticCheck(DiagnosticCheck{Name: "tenant-rbac", Run: tenantRBACCheck})
+	RegisterDiagnosticCheck(DiagnosticCheck{Name: "network-policies", Run: networkPoliciesCheck})
+	RegisterDiagnosticCheck(DiagnosticCheck{Name: "receiver-endpoints", Run: receiverEndpointsCheck})
+	RegisterDiagnosticCheck(DiagnosticCheck{Name: "crd-stored-versions", Run: crdStoredVersionsCheck})
+	RegisterDiagnosticCheck(DiagnosticCheck{Name: "clock-skew", Run: clockSkewCheck})
+}
+
+// Diagnostics runs the registered diagnostic checks for the tenants RBAC,
+// network policies, webhook receivers, CRD stored versions and clock skew.
+func (c *Checker) Diagnostics(ctx context.Context) []Result {
+	env := &DiagnosticEnv{
+		KubeClient: c.kubeClient,
+		Namespace:  c.options.Namespace,
+		ServerTime: func(ctx context.Context) (time.Time, error) {
+			return apiServerTime(ctx, c.kubeConfig)
+		},
+	}
+	return runDiagnosticChecks(ctx, env, diagnosticChecks)
+}
+
+func runDiagnosticChecks(ctx context.Context, env *DiagnosticEnv, checks []DiagnosticCheck) []Result {
+	var results []Result
+	for _, check := range checks {
+		checkResults, err := check.Run(ctx, env)
+		if err != nil {
+			checkResults = []Result{{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("check could not run: %s", err),
+				Hint:    "make sure the current user can read the objects of the check",
+			}}
+		}
+		for _, r := range checkResults {
+			r.Name = check.Name
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// tenantRBACCheck verifies that the service accounts impersonated by the
+// Kustomizations and HelmReleases exist and are bound to a role. The kinds
+// whose CRDs are not installed are skipped.
+func tenantRBACCheck(ctx context.Context, env *DiagnosticEnv) ([]Result, error) {
+	users := map[client.ObjectKey][]string{}
+
+	var ksList kustomizev1.KustomizationList
+	if err := env.KubeClient.List(ctx, &ksList); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	for _, ks := range ksList.Items {
+		if sa := ks.Spec.ServiceAccountName; sa != "" {
+			key := client.ObjectKey{Namespace: ks.Namespace, Name: sa}
+			users[key] = append(users[key], fmt.Sprintf("Kustomization/%s", ks.Name))
+		}
+	}
+	var hrList helmv2.HelmReleaseList
+	if err := env.KubeClient.List(ctx, &hrList); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	for _, hr := range hrList.Items {
+		if sa := hr.Spec.ServiceAccountName; sa != "" {
+			key := client.ObjectKey{Namespace: hr.Namespace, Name: sa}
+			users[key] = append(users[key], fmt.Sprintf("HelmRelease/%s", hr.Name))
+		}
+	}
+	if len(users) == 0 {
+		return []Result{{Status: StatusPass, Message: "no tenant service accounts in use"}}, nil
+	}
+
+	var crbList rbacv1.ClusterRoleBindingList
+	if err := env.KubeClient.List(ctx, &crbList); err != nil {
+		return nil, err
+	}
+
+	keys := make([]client.ObjectKey, 0, len(users))
+	for k := range users {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	var results []Result
+	for _, key := range keys {
+		usedBy := strings.Join(users[key], ", ")
+		if err := env.KubeClient.Get(ctx, key, &corev1.ServiceAccount{}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			results = append(results, Result{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("service account %s used by %s does not exist", key, usedBy),
+				Hint:    fmt.Sprintf("create the service account with a role binding, e.g. with 'flux create tenant --with-namespace=%s'", key.Namespace),
+			})
+			continue
+		}
+
+		var rbList rbacv1.RoleBindingList
+		if err := env.KubeClient.List(ctx, &rbList, client.InNamespace(key.Namespace)); err != nil {
+			return nil, err
+		}
+		bound := false
+		for _, rb := range rbList.Items {
+			if bindsServiceAccount(rb.Subjects, rb.Namespace, key) {
+				bound = true
+				break
+			}
+		}
+		for _, crb := range crbList.Items {
+			if bound {
+				break
+			}
+			bound = bindsServiceAccount(crb.Subjects, "", key)
+		}
+		if !bound {
+			results = append(results, Result{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("service account %s used by %s is not bound to any role", key, usedBy),
+				Hint:    fmt.Sprintf("create a RoleBinding in the %s namespace granting the service account access to the tenant objects", key.Namespace),
+			})
+			continue
+		}
+		results = append(results, Result{
+			Status:  StatusPass,
+			Message: fmt.Sprintf("service account %s is bound to a role", key),
+		})
+	}
+	return results, nil
+}
+
+func bindsServiceAccount(subjects []rbacv1.Subject, bindingNamespace string, sa client.ObjectKey) bool {
+	for _, s := range subjects {
+		if s.Kind != rbacv1.ServiceAccountKind || s.Name != sa.Name {
+			continue
+		}
+		ns := s.Namespace
+		if ns == "" {
+			ns = bindingNamespace
+		}
+		if ns == sa.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	notificationControllerName = "notification-controller"
+	webhookReceiverServiceName = "webhook-receiver"
+)
+
+// networkPoliciesCheck verifies that the network policies in the Flux
+// namespace allow the controllers to send events to notification-controller,
+// and allow the webhooks to reach the receiver if Receivers are in use.
+func networkPoliciesCheck(ctx context.Context, env *DiagnosticEnv) ([]Result, error) {
+	var npList networkingv1.NetworkPolicyList
+	if err := env.KubeClient.List(ctx, &npList, client.InNamespace(env.Namespace)); err != nil {
+		return nil, err
+	}
+	if len(npList.Items) == 0 {
+		return []Result{{Status: StatusPass, Message: fmt.Sprintf("no network policies in the %s namespace", env.Namespace)}}, nil
+	}
+
+	var deployments appsv1.DeploymentList
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	if err := env.KubeClient.List(ctx, &deployments, client.InNamespace(env.Namespace), selector); err != nil {
+		return nil, err
+	}
+	var nc *appsv1.Deployment
+	for i, d := range deployments.Items {
+		if d.Name == notificationControllerName {
+			nc = &deployments.Items[i]
+		}
+	}
+	if nc == nil {
+		return []Result{{Status: StatusPass, Message: "notification-controller is not installed"}}, nil
+	}
+	ncLabels := labels.Set(nc.Spec.Template.Labels)
+
+	var results []Result
+	for _, d := range deployments.Items {
+		if d.Name == notificationControllerName {
+			continue
+		}
+		if !ingressAllowed(npList.Items, ncLabels, labels.Set(d.Spec.Template.Labels), true, "http", 9090) {
+			results = append(results, Result{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("network policies block the events of %s to notification-controller", d.Name),
+				Hint:    fmt.Sprintf("allow ingress to notification-controller from the pods in the %s namespace, e.g. with the 'allow-egress' policy of 'flux install'", env.Namespace),
+			})
+		}
+	}
+
+	var receivers notificationv1.ReceiverList
+	if err := env.KubeClient.List(ctx, &receivers); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	if len(receivers.Items) > 0 && !ingressAllowed(npList.Items, ncLabels, labels.Set{}, false, "http-webhook", 9292) {
+		results = append(results, Result{
+			Status:  StatusWarn,
+			Message: "network policies block the ingress to the webhook receiver from other namespaces",
+			Hint:    "allow ingress to notification-controller from all namespaces, e.g. with the 'allow-webhooks' policy of 'flux install'",
+		})
+	}
+
+	if len(results) == 0 {
+		results = append(results, Result{Status: StatusPass, Message: "network policies allow the traffic to notification-controller"})
+	}
+	return results, nil
+}
+
+// ingressAllowed returns true if the network policies allow the ingress
+// to the pods with the target labels on the given port, from the pods with
+// the source labels in the same namespace if sameNamespace is true, or from
+// pods in other namespaces otherwise.
+func ingressAllowed(policies []networkingv1.NetworkPolicy, target, source labels.Set,
+	sameNamespace bool, portName string, port int32) bool {
+	isolated := false
+	for _, np := range policies {
+		if !policySelects(np.Spec.PodSelector, target) || !policyTypesInclude(np.Spec, networkingv1.PolicyTypeIngress) {
+			continue
+		}
+		isolated = true
+		for _, rule := range np.Spec.Ingress {
+			if rulePortsMatch(rule.Ports, portName, port) && rulePeersMatch(rule.From, source, sameNamespace) {
+				return true
+			}
+		}
+	}
+	return !isolated
+}
+
+func policySelects(selector metav1.LabelSelector, set labels.Set) bool {
+	s, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(set)
+}
+
+func policyTypesInclude(spec networkingv1.NetworkPolicySpec, policyType networkingv1.PolicyType) bool {
+	if len(spec.PolicyTypes) == 0 {
+		return policyType == networkingv1.PolicyTypeIngress
+	}
+	for _, t := range spec.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+func rulePortsMatch(ports []networkingv1.NetworkPolicyPort, portName string, port int32) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, p := range ports {
+		if p.Port == nil {
+			return true
+		}
+		if p.Port.Type == intstr.String && p.Port.StrVal == portName {
+			return true
+		}
+		if p.Port.Type == intstr.String {
+			continue
+		}
+		if p.Port.IntVal == port || p.EndPort != nil && p.Port.IntVal <= port && port <= *p.EndPort {
+			return true
+		}
+	}
+	return false
+}
+
+func rulePeersMatch(peers []networkingv1.NetworkPolicyPeer, source labels.Set, sameNamespace bool) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			// Pod IPs are not known to the check, assume the CIDR
+			// matches only for external traffic.
+			if !sameNamespace {
+				return true
+			}
+			continue
+		}
+		if peer.NamespaceSelector == nil {
+			// Pods in the namespace of the policy
+			if sameNamespace && (peer.PodSelector == nil || policySelects(*peer.PodSelector, source)) {
+				return true
+			}
+			continue
+		}
+		// Namespace labels are not known to the check, only an empty
+		// selector is assumed to match all namespaces.
+		if len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0 &&
+			(peer.PodSelector == nil || policySelects(*peer.PodSelector, source)) {
+			return true
+		}
+	}
+	return false
+}
+
+// receiverEndpointsCheck verifies that the webhook receiver service has
+// ready endpoints if Receivers are in use.
+func receiverEndpointsCheck(ctx context.Context, env *DiagnosticEnv) ([]Result, error) {
+	var receivers notificationv1.ReceiverList
+	if err := env.KubeClient.List(ctx, &receivers); err != nil {
+		if meta.IsNoMatchError(err) {
+			return []Result{{Status: StatusPass, Message: "the Receiver CRD is not installed"}}, nil
+		}
+		return nil, err
+	}
+	if len(receivers.Items) == 0 {
+		return []Result{{Status: StatusPass, Message: "no receivers in use"}}, nil
+	}
+
+	key := client.ObjectKey{Namespace: env.Namespace, Name: webhookReceiverServiceName}
+	if err := env.KubeClient.Get(ctx, key, &corev1.Service{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return []Result{{
+			Status:  StatusFail,
+			Message: fmt.Sprintf("service %s does not exist, %d receiver(s) can't be reached", key, len(receivers.Items)),
+			Hint:    "install notification-controller with 'flux install' to create the webhook receiver service",
+		}}, nil
+	}
+
+	var endpoints corev1.Endpoints
+	if err := env.KubeClient.Get(ctx, key, &endpoints); err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	ready := 0
+	for _, s := range endpoints.Subsets {
+		ready += len(s.Addresses)
+	}
+	if ready == 0 {
+		return []Result{{
+			Status:  StatusFail,
+			Message: fmt.Sprintf("service %s has no ready endpoints, %d receiver(s) can't be reached", key, len(receivers.Items)),
+			Hint:    "check that the notification-controller pods are ready and match the selector of the service",
+		}}, nil
+	}
+	return []Result{{
+		Status:  StatusPass,
+		Message: fmt.Sprintf("service %s has %d ready endpoint(s)", key, ready),
+	}}, nil
+}
+
+// crdStoredVersionsCheck verifies that the objects of the Flux CRDs are
+// stored in the current storage version.
+func crdStoredVersionsCheck(ctx context.Context, env *DiagnosticEnv) ([]Result, error) {
+	var list apiextensionsv1.CustomResourceDefinitionList
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	if err := env.KubeClient.List(ctx, &list, selector); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, crd := range list.Items {
+		var storage string
+		served := map[string]bool{}
+		for _, v := range crd.Spec.Versions {
+			if v.Storage {
+				storage = v.Name
+			}
+			served[v.Name] = v.Served
+		}
+		var stale []string
+		for _, v := range crd.Status.StoredVersions {
+			if v != storage {
+				stale = append(stale, v)
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		status := StatusWarn
+		for _, v := range stale {
+			if !served[v] {
+				status = StatusFail
+			}
+		}
+		results = append(results, Result{
+			Status: status,
+			Message: fmt.Sprintf("%s objects may be stored in the deprecated version(s) %s instead of %s",
+				crd.Name, strings.Join(stale, ", "), storage),
+			Hint: fmt.Sprintf("rewrite the %s objects in the storage version %s and remove the deprecated versions from the CRD status.storedVersions",
+				crd.Spec.Names.Kind, storage),
+		})
+	}
+	if len(results) == 0 {
+		results = append(results, Result{Status: StatusPass, Message: "all CRDs are stored in their storage version"})
+	}
+	return results, nil
+}
+
+const (
+	maxClockSkew = 30 * time.Second
+	// nodeLeaseNamespace is the namespace of the leases the kubelets renew
+	// with the time of their node.
+	nodeLeaseNamespace = "kube-node-lease"
+)
+
+// clockSkewCheck verifies that the clocks of this machine and of the nodes
+// do not drift from the clock of the Kubernetes API server.
+func clockSkewCheck(ctx context.Context, env *DiagnosticEnv) ([]Result, error) {
+	start := time.Now()
+	serverTime, err := env.ServerTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Compare with the local time at the middle of the request
+	localTime := start.Add(time.Since(start) / 2)
+
+	var results []Result
+	skew := localTime.Sub(serverTime)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		results = append(results, Result{
+			Status:  StatusWarn,
+			Message: fmt.Sprintf("the local clock is %s off the Kubernetes API server clock", skew.Round(time.Second)),
+			Hint:    "synchronize the local clock with NTP, a clock skew breaks the verification of signatures and tokens",
+		})
+	}
+
+	var leases coordinationv1.LeaseList
+	if err := env.KubeClient.List(ctx, &leases, client.InNamespace(nodeLeaseNamespace)); err != nil {
+		return nil, err
+	}
+	for _, lease := range leases.Items {
+		if lease.Spec.RenewTime == nil {
+			continue
+		}
+		// Leases are renewed every few seconds, only a renew time in the
+		// future gives away a node clock ahead of the API server.
+		if ahead := lease.Spec.RenewTime.Sub(serverTime); ahead > maxClockSkew {
+			results = append(results, Result{
+				Status:  StatusFail,
+				Message: fmt.Sprintf("the clock of node %s is %s ahead of the Kubernetes API server clock", lease.Name, ahead.Round(time.Second)),
+				Hint:    "synchronize the node clocks with NTP, a clock skew breaks the leader election of the controllers and the expiry of tokens",
+			})
+		}
+	}
+
+	if len(results) == 0 {
+		results = append(results, Result{Status: StatusPass, Message: "no clock skew detected"})
+	}
+	return results, nil
+}
+
+// apiServerTime returns the time of the Kubernetes API server from the Date
+// header of a request to the version endpoint.
+func apiServerTime(ctx context.Context, cfg *rest.Config) (time.Time, error) {
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	u, _, err := rest.DefaultServerURL(cfg.Host, "", schema.GroupVersion{}, rest.IsConfigTransportTLS(*cfg))
+	if err != nil {
+		return time.Time{}, err
+	}
+	u.Path = "/version"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("the Kubernetes API server response has no Date header")
+	}
+	return http.ParseTime(date)
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	notificationv1 "github.com/fluxcd/notification-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+func TestDiagnosticChecks(t *testing.T) {
+	tenantKs := func(name, sa string) *kustomizev1.Kustomization {
+		return &kustomizev1.Kustomization{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+			Spec:       kustomizev1.KustomizationSpec{ServiceAccountName: sa},
+		}
+	}
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: "apps"}}
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: "apps"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "tenant"}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+	}
+	receiver := &notificationv1.Receiver{ObjectMeta: metav1.ObjectMeta{Name: "github", Namespace: "flux-system"}}
+	webhookService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: webhookReceiverServiceName, Namespace: "flux-system"}}
+	webhookEndpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookReceiverServiceName, Namespace: "flux-system"},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}}},
+	}
+	denyAll := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-all", Namespace: "flux-system"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	allowEgress := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-egress", Namespace: "flux-system"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+		},
+	}
+	allowWebhooks := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-webhooks", Namespace: "flux-system"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": notificationControllerName}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}}}},
+		},
+	}
+	crd := func(stored ...string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "kustomizations.kustomize.toolkit.fluxcd.io",
+				Labels: map[string]string{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue},
+			},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Kustomization"},
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+					{Name: "v1beta1", Served: false},
+					{Name: "v1beta2", Served: true, Storage: true},
+				},
+			},
+			Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: stored},
+		}
+	}
+	nodeLease := func(renew time.Time) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: nodeLeaseNamespace},
+			Spec:       coordinationv1.LeaseSpec{RenewTime: &metav1.MicroTime{Time: renew}},
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		check      func(ctx context.Context, env *DiagnosticEnv) ([]Result, error)
+		objects    []client.Object
+		serverTime time.Time
+		want       []Status
+		wantMsg    string
+	}{
+		{
+			name:    "tenant service account missing",
+			check:   tenantRBACCheck,
+			objects: []client.Object{tenantKs("app", "tenant")},
+			want:    []Status{StatusFail},
+			wantMsg: "does not exist",
+		},
+		{
+			name:    "tenant service account without role",
+			check:   tenantRBACCheck,
+			objects: []client.Object{tenantKs("app", "tenant"), serviceAccount},
+			want:    []Status{StatusFail},
+			wantMsg: "not bound to any role",
+		},
+		{
+			name:    "tenant service account bound",
+			check:   tenantRBACCheck,
+			objects: []client.Object{tenantKs("app", "tenant"), tenantKs("infra", "tenant"), serviceAccount, roleBinding},
+			want:    []Status{StatusPass},
+		},
+		{
+			name:    "network policies blocking events",
+			check:   networkPoliciesCheck,
+			objects: append(fluxDeployments(), denyAll),
+			want:    []Status{StatusFail},
+			wantMsg: "block the events of source-controller",
+		},
+		{
+			name:    "network policies blocking webhooks",
+			check:   networkPoliciesCheck,
+			objects: append(fluxDeployments(), allowEgress, receiver),
+			want:    []Status{StatusWarn},
+			wantMsg: "webhook receiver",
+		},
+		{
+			name:    "network policies of flux install",
+			check:   networkPoliciesCheck,
+			objects: append(fluxDeployments(), allowEgress, allowWebhooks, receiver),
+			want:    []Status{StatusPass},
+		},
+		{
+			name:    "receiver without endpoints",
+			check:   receiverEndpointsCheck,
+			objects: []client.Object{receiver, webhookService},
+			want:    []Status{StatusFail},
+			wantMsg: "no ready endpoints",
+		},
+		{
+			name:    "receiver with endpoints",
+			check:   receiverEndpointsCheck,
+			objects: []client.Object{receiver, webhookService, webhookEndpoints},
+			want:    []Status{StatusPass},
+		},
+		{
+			name:    "CRD stored in a removed version",
+			check:   crdStoredVersionsCheck,
+			objects: []client.Object{crd("v1beta1", "v1beta2")},
+			want:    []Status{StatusFail},
+			wantMsg: "v1beta1",
+		},
+		{
+			name:    "CRD stored in the storage version",
+			check:   crdStoredVersionsCheck,
+			objects: []client.Object{crd("v1beta2")},
+			want:    []Status{StatusPass},
+		},
+		{
+			name:       "local clock skew",
+			check:      clockSkewCheck,
+			serverTime: now.Add(-5 * time.Minute),
+			want:       []Status{StatusWarn},
+			wantMsg:    "local clock",
+		},
+		{
+			name:       "node clock ahead",
+			check:      clockSkewCheck,
+			objects:    []client.Object{nodeLease(now.Add(10 * time.Minute))},
+			serverTime: now,
+			want:       []Status{StatusFail},
+			wantMsg:    "node-1",
+		},
+		{
+			name:       "no clock skew",
+			check:      clockSkewCheck,
+			objects:    []client.Object{nodeLease(now.Add(-5 * time.Second))},
+			serverTime: now,
+			want:       []Status{StatusPass},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &DiagnosticEnv{
+				KubeClient: fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(tt.objects...).Build(),
+				Namespace:  "flux-system",
+				ServerTime: func(_ context.Context) (time.Time, error) {
+					return tt.serverTime, nil
+				},
+			}
+			results, err := tt.check(context.Background(), env)
+			if err != nil {
+				t.Fatalf("check error = %v", err)
+			}
+			var got []Status
+			for _, r := range results {
+				got = append(got, r.Status)
+				if r.Status != StatusPass && r.Hint == "" {
+					t.Errorf("expected a remediation hint for %q", r.Message)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("results %+v, want statuses %v", results, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("result %d status %s != %s: %s", i, got[i], tt.want[i], results[i].Message)
+				}
+			}
+			if tt.wantMsg != "" && !strings.Contains(results[0].Message, tt.wantMsg) {
+				t.Errorf("expected message to contain %q, got %q", tt.wantMsg, results[0].Message)
+			}
+		})
+	}
+}
+
+// noFluxKindsClient behaves like a cluster where the kustomize, helm and
+// notification CRDs are not installed.
+type noFluxKindsClient struct {
+	client.Client
+}
+
+func (c noFluxKindsClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, c.Scheme())
+	if err != nil {
+		return err
+	}
+	switch gvk.Group {
+	case kustomizev1.GroupVersion.Group, helmv2.GroupVersion.Group, notificationv1.GroupVersion.Group:
+		kind := schema.GroupKind{Group: gvk.Group, Kind: strings.TrimSuffix(gvk.Kind, "List")}
+		return &meta.NoKindMatchError{GroupKind: kind, SearchedVersions: []string{gvk.Version}}
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestDiagnosticChecks_KindsNotInstalled(t *testing.T) {
+	allowEgress := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-egress", Namespace: "flux-system"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+		},
+	}
+	objects := append(fluxDeployments(), allowEgress)
+	env := &DiagnosticEnv{
+		KubeClient: noFluxKindsClient{fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(objects...).Build()},
+		Namespace:  "flux-system",
+		ServerTime: func(_ context.Context) (time.Time, error) {
+			return time.Now(), nil
+		},
+	}
+	checks := []DiagnosticCheck{
+		{Name: "tenant-rbac", Run: tenantRBACCheck},
+		{Name: "network-policies", Run: networkPoliciesCheck},
+		{Name: "receiver-endpoints", Run: receiverEndpointsCheck},
+	}
+	for _, r := range runDiagnosticChecks(context.Background(), env, checks) {
+		if r.Status != StatusPass {
+			t.Errorf("%s: expected the kinds not installed to be skipped, got %s: %s", r.Name, r.Status, r.Message)
+		}
+	}
+}
+
+func fluxDeployments() []client.Object {
+	var objects []client.Object
+	for _, name := range []string{"source-controller", notificationControllerName} {
+		objects = append(objects, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "flux-system",
+				Labels:    map[string]string{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				},
+			},
+		})
+	}
+	return objects
+}
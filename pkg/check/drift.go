@@ -0,0 +1,424 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/ssa"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+// Versions compares the version of the CLI with the versions of the
+// components and CRDs installed in the cluster and, if any, with the
+// versions of the desired manifests, e.g. the manifests in the bootstrap
+// repository. A difference with the desired manifests is a failure, a
+// difference with the CLI is a warning.
+func (c *Checker) Versions(ctx context.Context, clientVersion string, desired []*unstructured.Unstructured) []Result {
+	fail := func(format string, a ...interface{}) []Result {
+		return []Result{{Name: "drift", Status: StatusFail, Message: fmt.Sprintf(format, a...)}}
+	}
+
+	var ns corev1.Namespace
+	if err := c.kubeClient.Get(ctx, client.ObjectKey{Name: c.options.Namespace}, &ns); err != nil {
+		return fail("unable to get the '%s' namespace: %s", c.options.Namespace, err.Error())
+	}
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	var deployments appsv1.DeploymentList
+	if err := c.kubeClient.List(ctx, &deployments, client.InNamespace(c.options.Namespace), selector); err != nil {
+		return fail("unable to list the controllers in the '%s' namespace: %s", c.options.Namespace, err.Error())
+	}
+	var crds apiextensionsv1.CustomResourceDefinitionList
+	if err := c.kubeClient.List(ctx, &crds, selector); err != nil {
+		return fail("unable to list the crds: %s", err.Error())
+	}
+
+	desiredVersion := ""
+	desiredImages := map[string][]string{}
+	desiredCRDs := map[string]string{}
+	for _, obj := range desired {
+		switch obj.GetKind() {
+		case "Namespace":
+			desiredVersion = obj.GetLabels()[manifestgen.VersionLabelKey]
+		case "Deployment":
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+			var images []string
+			for _, c := range containers {
+				if container, ok := c.(map[string]interface{}); ok {
+					image, _ := container["image"].(string)
+					images = append(images, image)
+				}
+			}
+			if len(images) > 0 {
+				desiredImages[obj.GetName()] = images
+			}
+		case "CustomResourceDefinition":
+			desiredCRDs[obj.GetName()] = obj.GetLabels()[manifestgen.VersionLabelKey]
+		}
+	}
+
+	clusterVersion := ns.Labels[manifestgen.VersionLabelKey]
+	flux := Result{
+		Name:     "drift",
+		Status:   StatusPass,
+		Versions: map[string]string{"client": clientVersion, "cluster": clusterVersion},
+	}
+	flux.Message = fmt.Sprintf("flux client %s, cluster %s", clientVersion, versionOrUnknown(clusterVersion))
+	if len(desired) > 0 {
+		flux.Versions["desired"] = desiredVersion
+		flux.Message += fmt.Sprintf(", desired %s", versionOrUnknown(desiredVersion))
+	}
+	switch {
+	case len(desired) > 0 && clusterVersion != desiredVersion:
+		flux.Status = StatusFail
+		flux.Hint = "apply the desired manifests or update them with 'flux bootstrap'"
+	case clusterVersion != clientVersion:
+		flux.Status = StatusWarn
+		flux.Hint = "upgrade the cluster with 'flux upgrade' or use the CLI of the cluster version"
+	}
+	results := []Result{flux}
+
+	installed := map[string]bool{}
+	for _, d := range deployments.Items {
+		installed[d.Name] = true
+		containers := d.Spec.Template.Spec.Containers
+		if len(containers) == 0 {
+			continue
+		}
+		images := make([]string, 0, len(containers))
+		for _, container := range containers {
+			images = append(images, container.Image)
+		}
+		result := Result{
+			Name:      "drift",
+			Status:    StatusPass,
+			Component: d.Name,
+			Images:    images,
+			Versions:  map[string]string{"cluster": imageVersion(images[0])},
+		}
+		result.Message = fmt.Sprintf("%s: cluster %s", d.Name, result.Versions["cluster"])
+		if len(desired) > 0 {
+			want, ok := desiredImages[d.Name]
+			switch {
+			case !ok:
+				result.Status = StatusWarn
+				result.Message += ", not in the desired manifests"
+			case !sameImages(images, want):
+				result.Status = StatusFail
+				result.Versions["desired"] = imageVersion(want[0])
+				result.Message += fmt.Sprintf(", desired %s", result.Versions["desired"])
+				if result.Versions["desired"] == result.Versions["cluster"] {
+					result.Message += fmt.Sprintf(" from %s", strings.Join(missingImages(want, images), ", "))
+				}
+			default:
+				result.Versions["desired"] = imageVersion(want[0])
+			}
+		}
+		results = append(results, result)
+	}
+	components := make([]string, 0, len(desiredImages))
+	for name := range desiredImages {
+		components = append(components, name)
+	}
+	sort.Strings(components)
+	for _, name := range components {
+		if !installed[name] {
+			results = append(results, Result{
+				Name:      "drift",
+				Status:    StatusFail,
+				Component: name,
+				Message:   fmt.Sprintf("%s: not installed, desired %s", name, imageVersion(desiredImages[name][0])),
+			})
+		}
+	}
+
+	crdDrift := false
+	installedCRDs := map[string]bool{}
+	for _, crd := range crds.Items {
+		installedCRDs[crd.Name] = true
+		version := crd.Labels[manifestgen.VersionLabelKey]
+		if want, ok := desiredCRDs[crd.Name]; ok && want != version {
+			crdDrift = true
+			results = append(results, Result{
+				Name:     "drift",
+				Status:   StatusFail,
+				Message:  fmt.Sprintf("%s: cluster %s, desired %s", crd.Name, versionOrUnknown(version), versionOrUnknown(want)),
+				Versions: map[string]string{"cluster": version, "desired": want},
+			})
+			continue
+		}
+		if version != clusterVersion {
+			crdDrift = true
+			results = append(results, Result{
+				Name:     "drift",
+				Status:   StatusWarn,
+				Message:  fmt.Sprintf("%s: cluster %s, controllers %s", crd.Name, versionOrUnknown(version), versionOrUnknown(clusterVersion)),
+				Hint:     "the CRDs and the controllers should be installed from the same version",
+				Versions: map[string]string{"cluster": version},
+			})
+		}
+	}
+	for _, name := range sortedKeys(desiredCRDs) {
+		if !installedCRDs[name] {
+			crdDrift = true
+			results = append(results, Result{
+				Name:    "drift",
+				Status:  StatusFail,
+				Message: fmt.Sprintf("%s: not installed, desired %s", name, versionOrUnknown(desiredCRDs[name])),
+			})
+		}
+	}
+	if !crdDrift && len(crds.Items) > 0 {
+		results = append(results, Result{
+			Name:     "drift",
+			Status:   StatusPass,
+			Message:  fmt.Sprintf("%d crds: cluster %s", len(crds.Items), versionOrUnknown(clusterVersion)),
+			Versions: map[string]string{"cluster": clusterVersion},
+		})
+	}
+	return results
+}
+
+// Modifications detects the changes made outside of the desired manifests
+// to the controller deployments, e.g. with 'kubectl edit', by comparing the
+// deployments in the cluster with a server-side apply dry-run of the
+// desired deployments. The fields set by other field managers than the
+// ones applying the manifests, which the dry-run keeps, are reported too.
+func (c *Checker) Modifications(ctx context.Context, desired []*unstructured.Unstructured) []Result {
+	manager := ssa.NewResourceManager(c.kubeClient, nil, ssa.Owner{
+		Field: "flux",
+		Group: "fluxcd.io",
+	})
+
+	var results []Result
+	for _, obj := range desired {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		result := Result{
+			Name:      "modifications",
+			Status:    StatusPass,
+			Component: obj.GetName(),
+		}
+		change, live, merged, err := manager.Diff(ctx, obj, ssa.DiffOptions{})
+		switch {
+		case err != nil:
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("%s: dry-run failed: %s", obj.GetName(), err.Error())
+		case change.Action == ssa.CreatedAction:
+			// reported as not installed by the version checks
+			continue
+		default:
+			var fields []string
+			if change.Action == ssa.ConfiguredAction {
+				fields = changedFields(live.Object, merged.Object)
+				if len(fields) == 0 {
+					fields = []string{"spec"}
+				}
+			}
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(obj.GroupVersionKind())
+			if err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), existing); err == nil {
+				fields = append(fields, foreignFields(existing.GetManagedFields())...)
+			}
+			if len(fields) == 0 {
+				result.Message = fmt.Sprintf("%s: no changes", obj.GetName())
+				break
+			}
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("%s: modified outside of the manifests: %s", obj.GetName(), strings.Join(fields, ", "))
+			result.Hint = "reconcile the Kustomization that applies the manifests or run 'flux install' to revert the changes"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// changedFields returns the paths of the spec, labels and annotations
+// fields that differ between the live and the merged object.
+func changedFields(live, merged map[string]interface{}) []string {
+	var fields []string
+	var walk func(path string, a, b interface{})
+	walk = func(path string, a, b interface{}) {
+		am, aok := a.(map[string]interface{})
+		bm, bok := b.(map[string]interface{})
+		if !aok || !bok {
+			if !reflect.DeepEqual(a, b) {
+				fields = append(fields, path)
+			}
+			return
+		}
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range keys {
+			walk(path+"."+k, am[k], bm[k])
+		}
+	}
+
+	for _, path := range [][]string{{"metadata", "labels"}, {"metadata", "annotations"}, {"spec"}} {
+		a, _, _ := unstructured.NestedFieldNoCopy(live, path...)
+		b, _, _ := unstructured.NestedFieldNoCopy(merged, path...)
+		walk(strings.Join(path, "."), a, b)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// sameImages returns true if the containers of the cluster and of the
+// desired manifests have the same images, in any order.
+func sameImages(cluster, desired []string) bool {
+	return len(missingImages(cluster, desired)) == 0 && len(missingImages(desired, cluster)) == 0
+}
+
+// missingImages returns the images of a that aren't in b.
+func missingImages(a, b []string) []string {
+	found := map[string]int{}
+	for _, image := range b {
+		found[image]++
+	}
+	var missing []string
+	for _, image := range a {
+		if found[image] > 0 {
+			found[image]--
+			continue
+		}
+		missing = append(missing, image)
+	}
+	return missing
+}
+
+// manifestManagers are the field managers that apply the manifests of the
+// components, and the ones of the Kubernetes control plane.
+var manifestManagers = map[string]bool{
+	"flux":                    true,
+	"kustomize-controller":    true,
+	"kube-controller-manager": true,
+	"before-first-apply":      true,
+}
+
+// foreignFields returns the spec, labels and annotations fields set by
+// other field managers than the manifest managers, and not also owned by
+// one of them, with the name of their manager.
+func foreignFields(managedFields []metav1.ManagedFieldsEntry) []string {
+	owned := map[string]bool{}
+	foreign := map[string]string{}
+	for _, entry := range managedFields {
+		if entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+		var set map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &set); err != nil {
+			continue
+		}
+		for _, path := range fieldPaths("", set) {
+			if !strings.HasPrefix(path, "spec.") &&
+				!strings.HasPrefix(path, "metadata.labels.") &&
+				!strings.HasPrefix(path, "metadata.annotations.") {
+				continue
+			}
+			if manifestManagers[entry.Manager] {
+				owned[path] = true
+			} else if _, ok := foreign[path]; !ok {
+				foreign[path] = entry.Manager
+			}
+		}
+	}
+
+	var fields []string
+	for path, manager := range foreign {
+		if !owned[path] {
+			fields = append(fields, fmt.Sprintf("%s (%s)", path, manager))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// fieldPaths returns the paths of the leaves of a managed fields set, the
+// list items are identified by their key, e.g. containers[name=manager].
+func fieldPaths(prefix string, set map[string]interface{}) []string {
+	var paths []string
+	for k, v := range set {
+		var path string
+		switch {
+		case k == ".":
+			continue
+		case strings.HasPrefix(k, "f:"):
+			path = strings.TrimPrefix(k, "f:")
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+		case strings.HasPrefix(k, "k:"):
+			var key map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(k, "k:")), &key); err != nil {
+				continue
+			}
+			var pairs []string
+			for name, value := range key {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", name, value))
+			}
+			sort.Strings(pairs)
+			path = fmt.Sprintf("%s[%s]", prefix, strings.Join(pairs, ","))
+		case strings.HasPrefix(k, "v:"):
+			path = fmt.Sprintf("%s[%s]", prefix, strings.TrimPrefix(k, "v:"))
+		default:
+			continue
+		}
+		if children, ok := v.(map[string]interface{}); ok && len(children) > 0 {
+			if _, self := children["."]; !self || len(children) > 1 {
+				paths = append(paths, fieldPaths(path, children)...)
+				continue
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func versionOrUnknown(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
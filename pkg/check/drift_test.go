@@ -0,0 +1,234 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/ssa"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+func TestChecker_Versions(t *testing.T) {
+	labels := func(version string) map[string]string {
+		return map[string]string{
+			manifestgen.PartOfLabelKey:  manifestgen.PartOfLabelValue,
+			manifestgen.VersionLabelKey: version,
+		}
+	}
+	objects := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "flux-system", Labels: labels("v0.41.0")}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system", Labels: labels("v0.41.0")},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "manager", Image: "ghcr.io/fluxcd/source-controller:v0.36.0"}},
+			}}},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "helm-controller", Namespace: "flux-system", Labels: labels("v0.41.0")},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "manager", Image: "ghcr.io/fluxcd/helm-controller:v0.31.0"},
+					{Name: "proxy", Image: "ghcr.io/example/proxy:v1.0.0"},
+				},
+			}}},
+		},
+		&apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{
+			Name: "gitrepositories.source.toolkit.fluxcd.io", Labels: labels("v0.40.0"),
+		}},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(objects...).Build()
+	checker := NewChecker(nil, kubeClient, MakeDefaultOptions())
+
+	desired, err := ssa.ReadObjects(strings.NewReader(`---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: flux-system
+  labels:
+    app.kubernetes.io/version: v0.41.2
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+  namespace: flux-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: ghcr.io/fluxcd/source-controller:v0.36.1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helm-controller
+  namespace: flux-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: ghcr.io/fluxcd/helm-controller:v0.31.0
+      - name: proxy
+        image: ghcr.io/example/proxy:v1.1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kustomize-controller
+  namespace: flux-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: ghcr.io/fluxcd/kustomize-controller:v0.35.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		client  string
+		desired []*unstructured.Unstructured
+		want    []string
+	}{
+		{
+			name:   "no desired manifests",
+			client: "v0.41.0",
+			want: []string{
+				"pass: flux client v0.41.0, cluster v0.41.0",
+				"pass: helm-controller: cluster v0.31.0",
+				"pass: source-controller: cluster v0.36.0",
+				"warn: gitrepositories.source.toolkit.fluxcd.io: cluster v0.40.0, controllers v0.41.0",
+			},
+		},
+		{
+			name:    "drift from the desired manifests",
+			client:  "v0.41.2",
+			desired: desired,
+			want: []string{
+				"fail: flux client v0.41.2, cluster v0.41.0, desired v0.41.2",
+				"fail: helm-controller: cluster v0.31.0, desired v0.31.0 from ghcr.io/example/proxy:v1.1.0",
+				"fail: source-controller: cluster v0.36.0, desired v0.36.1",
+				"fail: kustomize-controller: not installed, desired v0.35.1",
+				"warn: gitrepositories.source.toolkit.fluxcd.io: cluster v0.40.0, controllers v0.41.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range checker.Versions(context.Background(), tt.client, tt.desired) {
+				got = append(got, string(r.Status)+": "+r.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Versions() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "source-controller",
+			"labels": map[string]interface{}{"app": "source-controller"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"args": []interface{}{"--log-level=debug"}}},
+				},
+			},
+		},
+		"status": map[string]interface{}{"replicas": int64(2)},
+	}
+	merged := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "source-controller",
+			"labels": map[string]interface{}{"app": "source-controller"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"args": []interface{}{"--log-level=info"}}},
+				},
+			},
+		},
+		"status": map[string]interface{}{"replicas": int64(1)},
+	}
+
+	got := changedFields(live, merged)
+	want := []string{"spec.replicas", "spec.template.spec.containers"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
+
+func TestForeignFields(t *testing.T) {
+	managedFields := []metav1.ManagedFieldsEntry{
+		{
+			Manager:   "kustomize-controller",
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:app":{}}},` +
+				`"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"manager\"}":{".":{},"f:args":{},"f:name":{}}}}}}}`)},
+		},
+		{
+			Manager:   "kubectl-edit",
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{"f:example.com/owner":{}}},` +
+				`"f:spec":{"f:replicas":{},"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"manager\"}":` +
+				`{"f:args":{},"f:env":{".":{},"k:{\"name\":\"DEBUG\"}":{".":{},"f:name":{},"f:value":{}}}}}}}}}`)},
+		},
+		{
+			Manager:     "kube-controller-manager",
+			Operation:   metav1.ManagedFieldsOperationUpdate,
+			Subresource: "status",
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:replicas":{}}}`)},
+		},
+	}
+
+	got := foreignFields(managedFields)
+	want := []string{
+		"metadata.annotations.example.com/owner (kubectl-edit)",
+		"spec.replicas (kubectl-edit)",
+		"spec.template.spec.containers[name=manager].env[name=DEBUG].name (kubectl-edit)",
+		"spec.template.spec.containers[name=manager].env[name=DEBUG].value (kubectl-edit)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foreignFields() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
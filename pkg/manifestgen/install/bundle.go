@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/fluxcd/pkg/untar"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+// BundleMetadataFile is the name of the file holding the Bundle metadata
+// in an install bundle archive.
+const BundleMetadataFile = "bundle.json"
+
+// Bundle describes an install bundle, a tarball with the manifests of a
+// Flux version, which allows generating the install manifests without
+// network access.
+type Bundle struct {
+	// Version of the bundled manifests.
+	Version string `json:"version"`
+	// Components available in the bundle.
+	Components []string `json:"components"`
+	// Images of the bundled components, to be mirrored to the registry
+	// the bundle is installed from.
+	Images []string `json:"images"`
+}
+
+// ExportBundle writes an install bundle with the manifests of the version
+// and the images of all the components to w. The manifests are read from
+// manifestsBase, or downloaded from Options.BaseURL if it is empty.
+// The images are listed for Options.Registry.
+func ExportBundle(options Options, manifestsBase string, w io.Writer) (*Bundle, error) {
+	tmpDir, err := manifestgen.MkdirTempAbs("", "flux-bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("temp dir error: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if manifestsBase == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+		defer cancel()
+		manifestsBase = filepath.Join(tmpDir, "download")
+		if err := os.Mkdir(manifestsBase, 0o700); err != nil {
+			return nil, err
+		}
+		if err := fetch(ctx, options.BaseURL, options.Version, manifestsBase); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(manifestsBase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifests: %w", err)
+	}
+	files := map[string][]byte{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".yaml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(manifestsBase, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = data
+	}
+
+	bundle := &Bundle{Version: options.Version}
+	defaults := MakeDefaultOptions()
+	for _, c := range append(defaults.Components, defaults.ComponentsExtra...) {
+		if _, ok := files[c+".yaml"]; ok {
+			bundle.Components = append(bundle.Components, c)
+		}
+	}
+	if len(bundle.Components) == 0 {
+		return nil, fmt.Errorf("no component manifests found in %s", manifestsBase)
+	}
+
+	// Build the manifests of all the components to list their images
+	buildDir := filepath.Join(tmpDir, "build")
+	if err := os.Mkdir(buildDir, 0o700); err != nil {
+		return nil, err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(buildDir, name), data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	options.Components = bundle.Components
+	if err := generate(buildDir, options); err != nil {
+		return nil, err
+	}
+	output := filepath.Join(tmpDir, "output.yaml")
+	if err := build(buildDir, output); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Images, err = ListImages(content); err != nil {
+		return nil, err
+	}
+
+	metadata, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files[BundleMetadataFile] = metadata
+
+	if err := writeTarball(w, files); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+// ExtractBundle extracts the install bundle at bundlePath into dir, which
+// can then be used as the manifests base of Generate.
+func ExtractBundle(bundlePath, dir string) (*Bundle, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := untar.Untar(f, dir); err != nil {
+		return nil, fmt.Errorf("failed to extract bundle %s: %w", bundlePath, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, BundleMetadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle %s: %w", bundlePath, err)
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle metadata: %w", err)
+	}
+	if bundle.Version == "" {
+		return nil, fmt.Errorf("invalid bundle metadata: version is missing")
+	}
+	return &bundle, nil
+}
+
+// ListImages returns the sorted unique container images of the Deployments
+// in the given multi-doc YAML manifests.
+func ListImages(manifests []byte) ([]string, error) {
+	objects, err := ssa.ReadObjects(bytes.NewReader(manifests))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var images []string
+	for _, obj := range objects {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s of %s: %w", field, obj.GetName(), err)
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := container["image"].(string); ok && image != "" && !seen[image] {
+					seen[image] = true
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// writeTarball writes the files to a gzipped tarball, in lexical order
+// and with fixed metadata so that the output is reproducible.
+func writeTarball(w io.Writer, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:     strings.TrimPrefix(filepath.ToSlash(name), "/"),
+			Mode:     0o644,
+			Size:     int64(len(files[name])),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
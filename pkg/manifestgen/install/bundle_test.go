@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRBAC = `---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: crd-controller
+rules:
+- apiGroups: ['source.toolkit.fluxcd.io']
+  resources: ['*']
+  verbs: ['*']
+`
+
+const testSourceController = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+spec:
+  selector:
+    matchLabels:
+      app: source-controller
+  template:
+    metadata:
+      labels:
+        app: source-controller
+    spec:
+      containers:
+      - name: manager
+        image: fluxcd/source-controller:v0.36.1
+        args:
+        - --events-addr
+        - --watch-all-namespaces
+        - --log-level
+        - --log-encoding=json
+        - --enable-leader-election
+        - --storage-path=/data
+        - --storage-adv-addr
+`
+
+func TestBundle(t *testing.T) {
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(base, "rbac.yaml"), testRBAC)
+	writeTestFile(t, filepath.Join(base, "source-controller.yaml"), testSourceController)
+
+	opts := MakeDefaultOptions()
+	opts.Version = "v0.41.0"
+	opts.NetworkPolicy = false
+
+	var buf bytes.Buffer
+	bundle, err := ExportBundle(opts, base, &buf)
+	if err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+	if !reflect.DeepEqual(bundle.Components, []string{"source-controller"}) {
+		t.Errorf("unexpected components %v", bundle.Components)
+	}
+	if !reflect.DeepEqual(bundle.Images, []string{"ghcr.io/fluxcd/source-controller:v0.36.1"}) {
+		t.Errorf("unexpected images %v", bundle.Images)
+	}
+
+	// The bundle is reproducible
+	var buf2 bytes.Buffer
+	if _, err := ExportBundle(opts, base, &buf2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Errorf("expected identical bundles")
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	writeTestFile(t, bundlePath, buf.String())
+	dir := t.TempDir()
+	extracted, err := ExtractBundle(bundlePath, dir)
+	if err != nil {
+		t.Fatalf("ExtractBundle() error = %v", err)
+	}
+	if !reflect.DeepEqual(extracted, bundle) {
+		t.Errorf("extracted bundle %+v != %+v", extracted, bundle)
+	}
+
+	// The install manifests are generated from the bundle with the images
+	// rewritten to the registry
+	opts.Components = []string{"source-controller"}
+	opts.Registry = "registry.internal/flux"
+	opts.BaseURL = "http://unreachable.invalid"
+	manifest, err := Generate(opts, dir)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(manifest.Content, "image: registry.internal/flux/source-controller:v0.36.1") {
+		t.Errorf("expected image to be rewritten to the registry:\n%s", manifest.Content)
+	}
+}
+
+func TestExtractBundle_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTarball(&buf, map[string][]byte{"source-controller.yaml": []byte(testSourceController)}); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	writeTestFile(t, bundlePath, buf.String())
+	if _, err := ExtractBundle(bundlePath, t.TempDir()); err == nil {
+		t.Errorf("expected error for bundle without metadata")
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -18,6 +18,7 @@ package install
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -48,3 +49,26 @@ func TestGenerate(t *testing.T) {
 
 	fmt.Println(output)
 }
+
+func TestGenerate_ImageDigests(t *testing.T) {
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(base, "rbac.yaml"), testRBAC)
+	writeTestFile(t, filepath.Join(base, "source-controller.yaml"), testSourceController)
+
+	opts := MakeDefaultOptions()
+	opts.Components = []string{"source-controller"}
+	opts.NetworkPolicy = false
+	opts.Registry = "registry.internal/flux"
+	opts.ImageDigests = map[string]string{
+		"source-controller": "sha256:ef3ef3a2dd4e3b1fe1ab1a2eaf8ed5b4d3b0c8d7ab3b2cc3a5bb2fd68c4bd9f2",
+	}
+	output, err := Generate(opts, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := "image: registry.internal/flux/source-controller@" + opts.ImageDigests["source-controller"]
+	if !strings.Contains(output.Content, img) {
+		t.Errorf("component image '%s' not found:\n%s", img, output.Content)
+	}
+}
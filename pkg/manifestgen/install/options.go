@@ -36,6 +36,11 @@ type Options struct {
 	TargetPath             string
 	ClusterDomain          string
 	TolerationKeys         []string
+
+	// ImageDigests maps component names to the digests of their images,
+	// the manifests reference the images by digest instead of by tag for
+	// the components in the map.
+	ImageDigests map[string]string
 }
 
 func MakeDefaultOptions() Options {
@@ -28,6 +28,7 @@ var kustomizationTmpl = `---
 {{- $eventsAddr := .EventsAddr }}
 {{- $watchAllNamespaces := .WatchAllNamespaces }}
 {{- $registry := .Registry }}
+{{- $digests := .ImageDigests }}
 {{- $logLevel := .LogLevel }}
 {{- $clusterDomain := .ClusterDomain }}
 apiVersion: kustomize.config.k8s.io/v1beta1
@@ -105,12 +106,17 @@ patchesJson6902:
 {{- end }}
 {{- end }}
 
-{{- if $registry }}
+{{- if or $registry $digests }}
 images:
 {{- range $i, $component := .Components }}
   - name: fluxcd/{{$component}}
+{{- if $registry }}
     newName: {{$registry}}/{{$component}}
 {{- end }}
+{{- with index $digests $component }}
+    digest: {{.}}
+{{- end }}
+{{- end }}
 {{- end }}
 `
 
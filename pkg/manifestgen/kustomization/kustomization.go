@@ -36,7 +36,8 @@ import (
 
 // Generate scans the given directory for Kubernetes manifests and creates a
 // konfig.DefaultKustomizationFileName file, including all discovered manifests
-// as resources.
+// as resources. The Options.Patches are merged into the patches of the
+// generated or existing file.
 func Generate(options Options) (*manifestgen.Manifest, error) {
 	kfile := filepath.Join(options.TargetPath, konfig.DefaultKustomizationFileName())
 	abskfile := filepath.Join(options.BaseDir, kfile)
@@ -112,6 +113,7 @@ func Generate(options Options) (*manifestgen.Manifest, error) {
 		}
 
 		kus.Resources = resources
+		kus.Patches = options.Patches
 		kd, err := yaml.Marshal(kus)
 		if err != nil {
 			return nil, err
@@ -127,6 +129,18 @@ func Generate(options Options) (*manifestgen.Manifest, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(options.Patches) > 0 {
+		var kus kustypes.Kustomization
+		if err := yaml.Unmarshal(kd, &kus); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", kfile, err)
+		}
+		if patches := mergePatches(kus.Patches, options.Patches); len(patches) > len(kus.Patches) {
+			kus.Patches = patches
+			if kd, err = yaml.Marshal(kus); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return &manifestgen.Manifest{
 		Path:    kfile,
 		Content: string(kd),
@@ -16,12 +16,16 @@ limitations under the License.
 
 package kustomization
 
-import "sigs.k8s.io/kustomize/api/filesys"
+import (
+	"sigs.k8s.io/kustomize/api/filesys"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+)
 
 type Options struct {
 	FileSystem filesys.FileSystem
 	BaseDir    string
 	TargetPath string
+	Patches    []kustypes.Patch
 }
 
 func MakeDefaultOptions() Options {
@@ -0,0 +1,224 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kustomization
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+// LoadPatches reads Kustomize patches from the given paths. A path to a
+// directory loads all the YAML files in it, in lexical order.
+// A file may either contain a list of Kustomize patches, in the format of
+// the 'patches' field of a kustomization.yaml, or a single strategic merge
+// or JSON6902 patch. Patches referring to a file are inlined, so that the
+// result does not depend on the location of the patch files.
+func LoadPatches(paths ...string) ([]kustypes.Patch, error) {
+	var patches []kustypes.Patch
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read patches: %w", err)
+		}
+		if !fi.IsDir() {
+			ps, err := loadPatchFile(p)
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, ps...)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read patches directory: %w", err)
+		}
+		var files []string
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if ext := filepath.Ext(e.Name()); ext == ".yaml" || ext == ".yml" {
+				files = append(files, filepath.Join(p, e.Name()))
+			}
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			ps, err := loadPatchFile(f)
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, ps...)
+		}
+	}
+	return patches, nil
+}
+
+func loadPatchFile(path string) ([]kustypes.Patch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read patch file: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("patch file %q is empty", path)
+	}
+
+	var patches []kustypes.Patch
+	if err := yaml.UnmarshalStrict(data, &patches); err != nil || !isPatchList(patches) {
+		return []kustypes.Patch{{Patch: string(data)}}, nil
+	}
+
+	for i, p := range patches {
+		if p.Path == "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(filepath.Dir(path), p.Path))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read patch referenced in %q: %w", path, err)
+		}
+		patches[i].Path = ""
+		patches[i].Patch = string(content)
+	}
+	return patches, nil
+}
+
+// isPatchList returns true if all the entries are Kustomize patches, to
+// tell apart a patch list from a JSON6902 patch, which is a YAML list too.
+func isPatchList(patches []kustypes.Patch) bool {
+	if len(patches) == 0 {
+		return false
+	}
+	for _, p := range patches {
+		if p.Path == "" && p.Patch == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// mergePatches appends the patches which are not already present in
+// existing.
+func mergePatches(existing, patches []kustypes.Patch) []kustypes.Patch {
+	result := existing
+	for _, p := range patches {
+		var found bool
+		for _, e := range existing {
+			if reflect.DeepEqual(e, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// VerifyPatches builds the given multi-doc YAML manifests with the patches
+// and returns the patched manifests. It returns an error if any of the
+// patches fails to apply, or does not result in any change to the
+// manifests, e.g. because its target does not match any object.
+func VerifyPatches(manifests string, patches []kustypes.Patch) ([]byte, error) {
+	tmpDir, err := manifestgen.MkdirTempAbs("", "flux-patches-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const resourcesFile = "resources.yaml"
+	if err := os.WriteFile(filepath.Join(tmpDir, resourcesFile), []byte(manifests), 0o600); err != nil {
+		return nil, err
+	}
+
+	build := func(patches []kustypes.Patch) ([]byte, error) {
+		kus := kustypes.Kustomization{
+			TypeMeta: kustypes.TypeMeta{
+				APIVersion: kustypes.KustomizationVersion,
+				Kind:       kustypes.KustomizationKind,
+			},
+			Resources: []string{resourcesFile},
+			Patches:   patches,
+		}
+		kd, err := yaml.Marshal(kus)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, konfig.DefaultKustomizationFileName()), kd, 0o600); err != nil {
+			return nil, err
+		}
+		return BuildWithRoot(tmpDir, tmpDir)
+	}
+
+	unpatched, err := build(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manifests: %w", err)
+	}
+	for i, p := range patches {
+		out, err := build([]kustypes.Patch{p})
+		if err != nil {
+			return nil, fmt.Errorf("patch %d (%s) failed to apply: %w", i+1, describePatch(p), err)
+		}
+		if bytes.Equal(out, unpatched) {
+			return nil, fmt.Errorf("patch %d (%s) does not change any object", i+1, describePatch(p))
+		}
+	}
+
+	out, err := build(patches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build patched manifests: %w", err)
+	}
+	return out, nil
+}
+
+func describePatch(p kustypes.Patch) string {
+	if p.Target != nil {
+		var parts []string
+		for _, s := range []string{p.Target.Kind, p.Target.Name, p.Target.LabelSelector} {
+			if s != "" {
+				parts = append(parts, s)
+			}
+		}
+		if len(parts) > 0 {
+			return "target " + strings.Join(parts, "/")
+		}
+	}
+	var obj struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal([]byte(p.Patch), &obj); err == nil && obj.Kind != "" {
+		return fmt.Sprintf("%s/%s", obj.Kind, obj.Metadata.Name)
+	}
+	return "inline"
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kustomization
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/kustomize/filesys"
+	kustypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+)
+
+const testDeployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+  namespace: flux-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        image: ghcr.io/fluxcd/source-controller:v0.36.1
+`
+
+const testStrategicMergePatch = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+  namespace: flux-system
+spec:
+  template:
+    spec:
+      nodeSelector:
+        role: flux
+`
+
+const testPatchList = `- patch: |
+    - op: add
+      path: /spec/template/spec/containers/0/args
+      value: ["--concurrent=10"]
+  target:
+    kind: Deployment
+    name: source-controller
+`
+
+func TestLoadPatches(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b-smp.yaml"), testStrategicMergePatch)
+	writeFile(t, filepath.Join(dir, "a-list.yaml"), testPatchList)
+	writeFile(t, filepath.Join(dir, "README.md"), "not a patch")
+
+	patches, err := LoadPatches(dir)
+	if err != nil {
+		t.Fatalf("LoadPatches() error = %v", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %d", len(patches))
+	}
+	if patches[0].Target == nil || patches[0].Target.Name != "source-controller" {
+		t.Errorf("expected patch list entry first, got %+v", patches[0])
+	}
+	if patches[1].Patch != testStrategicMergePatch || patches[1].Target != nil {
+		t.Errorf("expected inline strategic merge patch, got %+v", patches[1])
+	}
+
+	patches, err = LoadPatches(filepath.Join(dir, "b-smp.yaml"), "")
+	if err != nil {
+		t.Fatalf("LoadPatches() error = %v", err)
+	}
+	if len(patches) != 1 {
+		t.Errorf("expected 1 patch, got %d", len(patches))
+	}
+
+	if _, err := LoadPatches(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("expected error for missing patch file")
+	}
+}
+
+func TestVerifyPatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		patches []kustypes.Patch
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "strategic merge and JSON6902 patches",
+			patches: []kustypes.Patch{
+				{Patch: testStrategicMergePatch},
+				{
+					Patch:  `[{"op": "add", "path": "/spec/template/spec/containers/0/args", "value": ["--concurrent=10"]}]`,
+					Target: &kustypes.Selector{ResId: resId("Deployment", "source-controller")},
+				},
+			},
+			want: []string{"role: flux", "--concurrent=10"},
+		},
+		{
+			name: "patch without matching target",
+			patches: []kustypes.Patch{
+				{
+					Patch:  `[{"op": "add", "path": "/spec/replicas", "value": 2}]`,
+					Target: &kustypes.Selector{ResId: resId("Deployment", "helm-controller")},
+				},
+			},
+			wantErr: "does not change any object",
+		},
+		{
+			name: "invalid patch",
+			patches: []kustypes.Patch{
+				{
+					Patch:  `[{"op": "replace", "path": "/spec/missing/field", "value": 2}]`,
+					Target: &kustypes.Selector{ResId: resId("Deployment", "source-controller")},
+				},
+			},
+			wantErr: "failed to apply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPatches(testDeployment, tt.patches)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyPatches() error = %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(got), w) {
+					t.Errorf("expected patched manifests to contain %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_MergesPatches(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "flux-system", "gotk-components.yaml"), testDeployment)
+
+	fs, err := filesys.MakeFsOnDiskSecureBuild(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches := []kustypes.Patch{{Patch: testStrategicMergePatch}}
+	opts := Options{FileSystem: fs, BaseDir: dir, TargetPath: "flux-system", Patches: patches}
+
+	manifest, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	writeFile(t, filepath.Join(dir, manifest.Path), manifest.Content)
+
+	// Generating again must not duplicate the patches already present
+	manifest, err = Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	var kus kustypes.Kustomization
+	if err := yaml.Unmarshal([]byte(manifest.Content), &kus); err != nil {
+		t.Fatal(err)
+	}
+	if len(kus.Resources) != 1 || kus.Resources[0] != "gotk-components.yaml" {
+		t.Errorf("unexpected resources %v", kus.Resources)
+	}
+	if len(kus.Patches) != 1 {
+		t.Errorf("expected 1 patch, got %d", len(kus.Patches))
+	}
+}
+
+func resId(kind, name string) resid.ResId {
+	return resid.ResId{Gvk: resid.Gvk{Kind: kind}, Name: name}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -23,4 +23,8 @@ const (
 	PartOfLabelValue = "flux"
 	InstanceLabelKey = "app.kubernetes.io/instance"
 	VersionLabelKey  = "app.kubernetes.io/version"
+
+	// ComponentLabelKey is set to the name of the component on the objects
+	// of a Flux component, excluding the shared RBAC and network policies.
+	ComponentLabelKey = "app.kubernetes.io/component"
 )
@@ -33,6 +33,12 @@ type Options struct {
 	TargetPath        string
 	ManifestFile      string
 	RecurseSubmodules bool
+
+	// DecryptionProvider is the decryption provider of the sync
+	// Kustomization, decryption is disabled if empty.
+	DecryptionProvider string
+	// DecryptionSecret is the name of the Secret holding the decryption keys.
+	DecryptionSecret string
 }
 
 func MakeDefaultOptions() Options {
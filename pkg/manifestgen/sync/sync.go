@@ -99,6 +99,17 @@ func Generate(options Options) (*manifestgen.Manifest, error) {
 		},
 	}
 
+	if options.DecryptionProvider != "" {
+		kustomization.Spec.Decryption = &kustomizev1.Decryption{
+			Provider: options.DecryptionProvider,
+		}
+		if options.DecryptionSecret != "" {
+			kustomization.Spec.Decryption.SecretRef = &meta.LocalObjectReference{
+				Name: options.DecryptionSecret,
+			}
+		}
+	}
+
 	ksData, err := yaml.Marshal(kustomization)
 	if err != nil {
 		return nil, err
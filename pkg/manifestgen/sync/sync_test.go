@@ -43,3 +43,25 @@ func TestGenerate(t *testing.T) {
 
 	fmt.Println(output.Content)
 }
+
+func TestGenerate_Decryption(t *testing.T) {
+	opts := MakeDefaultOptions()
+	output, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output.Content, "decryption:") {
+		t.Errorf("expected no decryption by default")
+	}
+
+	opts.DecryptionProvider = "sops"
+	opts.DecryptionSecret = "sops-age"
+	output, err = Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "  decryption:\n    provider: sops\n    secretRef:\n      name: sops-age\n"
+	if !strings.Contains(output.Content, want) {
+		t.Errorf("decryption not found in:\n%s", output.Content)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package printers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/fluxcd/go-git/v5/plumbing"
+	"github.com/fluxcd/go-git/v5/plumbing/filemode"
+	gitdiff "github.com/fluxcd/go-git/v5/plumbing/format/diff"
+)
+
+// FileDiff is the content of a file before and after a change.
+type FileDiff struct {
+	// Path is the slash separated path of the file.
+	Path string
+	// From is the content of the file before the change, nil if the file
+	// is created.
+	From []byte
+	// To is the content of the file after the change, nil if the file is
+	// deleted.
+	To []byte
+}
+
+// UnifiedDiffPrinter is a printer that prints file diffs in the unified
+// format.
+type UnifiedDiffPrinter struct{}
+
+// NewUnifiedDiffPrinter returns a new UnifiedDiffPrinter.
+func NewUnifiedDiffPrinter() *UnifiedDiffPrinter {
+	return &UnifiedDiffPrinter{}
+}
+
+// Print prints the given FileDiff or []FileDiff args to the given writer.
+func (p *UnifiedDiffPrinter) Print(w io.Writer, args ...interface{}) error {
+	var patches []gitdiff.FilePatch
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case FileDiff:
+			patches = append(patches, newFilePatch(arg))
+		case []FileDiff:
+			for _, d := range arg {
+				patches = append(patches, newFilePatch(d))
+			}
+		default:
+			return fmt.Errorf("unsupported type %T", arg)
+		}
+	}
+	if len(patches) == 0 {
+		return nil
+	}
+	return gitdiff.NewUnifiedEncoder(w, gitdiff.DefaultContextLines).Encode(patch(patches))
+}
+
+// patch implements the go-git patch interfaces for encoding the diffs in
+// the unified format.
+type patch []gitdiff.FilePatch
+
+func (p patch) FilePatches() []gitdiff.FilePatch { return p }
+func (p patch) Message() string                  { return "" }
+
+type filePatch struct {
+	from, to gitdiff.File
+	chunks   []gitdiff.Chunk
+}
+
+func newFilePatch(d FileDiff) gitdiff.FilePatch {
+	fp := &filePatch{}
+	if d.From != nil {
+		fp.from = file{path: d.Path, hash: plumbing.ComputeHash(plumbing.BlobObject, d.From)}
+	}
+	if d.To != nil {
+		fp.to = file{path: d.Path, hash: plumbing.ComputeHash(plumbing.BlobObject, d.To)}
+	}
+	for _, c := range diffLines(string(d.From), string(d.To)) {
+		op := gitdiff.Equal
+		switch c.Type {
+		case diffmatchpatch.DiffInsert:
+			op = gitdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = gitdiff.Delete
+		}
+		fp.chunks = append(fp.chunks, chunk{content: c.Text, op: op})
+	}
+	return fp
+}
+
+// diffLines returns the line diffs between the texts. The lines are mapped
+// to runes and compared with DiffMainRunes, since the line mode of
+// diffmatchpatch mismatches lines in go-diff v1.3.1.
+func diffLines(from, to string) []diffmatchpatch.Diff {
+	lines := make(map[rune]string)
+	index := make(map[string]rune)
+	mapLines := func(text string) []rune {
+		var runes []rune
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				continue
+			}
+			r, ok := index[line]
+			if !ok {
+				r = rune(len(lines))
+				// Skip the surrogates, which are not valid runes.
+				if r >= 0xD800 {
+					r += 0x800
+				}
+				index[line] = r
+				lines[r] = line
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+
+	diffs := diffmatchpatch.New().DiffMainRunes(mapLines(from), mapLines(to), false)
+	for i, d := range diffs {
+		var b strings.Builder
+		for _, r := range d.Text {
+			b.WriteString(lines[r])
+		}
+		diffs[i].Text = b.String()
+	}
+	return diffs
+}
+
+func (p *filePatch) IsBinary() bool                      { return false }
+func (p *filePatch) Files() (gitdiff.File, gitdiff.File) { return p.from, p.to }
+func (p *filePatch) Chunks() []gitdiff.Chunk             { return p.chunks }
+
+type file struct {
+	path string
+	hash plumbing.Hash
+}
+
+func (f file) Hash() plumbing.Hash     { return f.hash }
+func (f file) Mode() filemode.FileMode { return filemode.Regular }
+func (f file) Path() string            { return f.path }
+
+type chunk struct {
+	content string
+	op      gitdiff.Operation
+}
+
+func (c chunk) Content() string         { return c.content }
+func (c chunk) Type() gitdiff.Operation { return c.op }
@@ -0,0 +1,59 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package printers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiffPrinter(t *testing.T) {
+	var from, to strings.Builder
+	for i := 0; i < 15; i++ {
+		fmt.Fprintf(&from, "line: %d\n", i)
+		if i == 12 {
+			fmt.Fprintf(&to, "line: %d-updated\n", i)
+			continue
+		}
+		fmt.Fprintf(&to, "line: %d\n", i)
+	}
+
+	var out bytes.Buffer
+	diff := FileDiff{Path: "file.yaml", From: []byte(from.String()), To: []byte(to.String())}
+	if err := NewUnifiedDiffPrinter().Print(&out, diff); err != nil {
+		t.Fatal(err)
+	}
+	want := `@@ -10,6 +10,6 @@ line: 8
+ line: 9
+ line: 10
+ line: 11
+-line: 12
++line: 12-updated
+ line: 13
+ line: 14
+`
+	if !strings.HasSuffix(out.String(), want) {
+		t.Errorf("expected the diff to end with:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	if err := NewUnifiedDiffPrinter().Print(&out, []FileDiff{}); err != nil || out.Len() != 0 {
+		t.Errorf("expected no output, got %q (%v)", out.String(), err)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uninstall
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/flux2/pkg/log"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+// RemainingCustomResources returns the number of custom resources of each
+// kind of the CRDs installed by the given components.
+func RemainingCustomResources(ctx context.Context, kubeClient client.Client, components []string) (map[string]int, error) {
+	crds, err := componentCRDs(ctx, kubeClient, components)
+	if err != nil {
+		return nil, err
+	}
+	remaining := map[string]int{}
+	for _, crd := range crds {
+		list, err := listCustomResources(ctx, kubeClient, crd)
+		if err != nil {
+			return nil, err
+		}
+		if len(list.Items) > 0 {
+			remaining[crd.Spec.Names.Kind] = len(list.Items)
+		}
+	}
+	return remaining, nil
+}
+
+// SelectedComponents removes the deployments, services and service accounts of the given components,
+// and removes their service accounts from the subjects of the Flux cluster role bindings.
+func SelectedComponents(ctx context.Context, logger log.Logger, kubeClient client.Client, namespace string, components []string, dryRun bool) error {
+	var aggregateErr []error
+	opts, dryRunStr := getDeleteOptions(dryRun)
+	for _, component := range components {
+		selector := client.MatchingLabels{
+			manifestgen.PartOfLabelKey:    manifestgen.PartOfLabelValue,
+			manifestgen.ComponentLabelKey: component,
+		}
+		{
+			var list appsv1.DeploymentList
+			if err := kubeClient.List(ctx, &list, client.InNamespace(namespace), selector); err == nil {
+				for _, r := range list.Items {
+					if err := kubeClient.Delete(ctx, &r, opts); err != nil {
+						logger.Failuref("Deployment/%s/%s deletion failed: %s", r.Namespace, r.Name, err.Error())
+						aggregateErr = append(aggregateErr, err)
+					} else {
+						logger.Successf("Deployment/%s/%s deleted %s", r.Namespace, r.Name, dryRunStr)
+					}
+				}
+			}
+		}
+		{
+			var list corev1.ServiceList
+			if err := kubeClient.List(ctx, &list, client.InNamespace(namespace), selector); err == nil {
+				for _, r := range list.Items {
+					if err := kubeClient.Delete(ctx, &r, opts); err != nil {
+						logger.Failuref("Service/%s/%s deletion failed: %s", r.Namespace, r.Name, err.Error())
+						aggregateErr = append(aggregateErr, err)
+					} else {
+						logger.Successf("Service/%s/%s deleted %s", r.Namespace, r.Name, dryRunStr)
+					}
+				}
+			}
+		}
+		{
+			var list corev1.ServiceAccountList
+			if err := kubeClient.List(ctx, &list, client.InNamespace(namespace), selector); err == nil {
+				for _, r := range list.Items {
+					if err := kubeClient.Delete(ctx, &r, opts); err != nil {
+						logger.Failuref("ServiceAccount/%s/%s deletion failed: %s", r.Namespace, r.Name, err.Error())
+						aggregateErr = append(aggregateErr, err)
+					} else {
+						logger.Successf("ServiceAccount/%s/%s deleted %s", r.Namespace, r.Name, dryRunStr)
+					}
+				}
+			}
+		}
+	}
+
+	updateOpts, _ := getUpdateOptions(dryRun)
+	selector := client.MatchingLabels{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}
+	var list rbacv1.ClusterRoleBindingList
+	if err := kubeClient.List(ctx, &list, selector); err == nil {
+		for _, r := range list.Items {
+			subjects := make([]rbacv1.Subject, 0, len(r.Subjects))
+			for _, s := range r.Subjects {
+				if s.Kind == rbacv1.ServiceAccountKind && s.Namespace == namespace && containsString(components, s.Name) {
+					continue
+				}
+				subjects = append(subjects, s)
+			}
+			if len(subjects) == len(r.Subjects) {
+				continue
+			}
+			r.Subjects = subjects
+			if err := kubeClient.Update(ctx, &r, updateOpts); err != nil {
+				logger.Failuref("ClusterRoleBinding/%s update failed: %s", r.Name, err.Error())
+				aggregateErr = append(aggregateErr, err)
+			} else {
+				logger.Successf("ClusterRoleBinding/%s subjects removed %s", r.Name, dryRunStr)
+			}
+		}
+	}
+	return errors.Reduce(errors.Flatten(errors.NewAggregate(aggregateErr)))
+}
+
+// SelectedCustomResources removes the custom resources of the CRDs installed by the given components,
+// after removing their finalizers.
+func SelectedCustomResources(ctx context.Context, logger log.Logger, kubeClient client.Client, components []string, dryRun bool) error {
+	var aggregateErr []error
+	crds, err := componentCRDs(ctx, kubeClient, components)
+	if err != nil {
+		return err
+	}
+	updateOpts, _ := getUpdateOptions(dryRun)
+	deleteOpts, dryRunStr := getDeleteOptions(dryRun)
+	for _, crd := range crds {
+		list, err := listCustomResources(ctx, kubeClient, crd)
+		if err != nil {
+			aggregateErr = append(aggregateErr, err)
+			continue
+		}
+		for _, r := range list.Items {
+			if len(r.GetFinalizers()) > 0 {
+				r.SetFinalizers([]string{})
+				if err := kubeClient.Update(ctx, &r, updateOpts); err != nil {
+					logger.Failuref("%s/%s/%s removing finalizers failed: %s", r.GetKind(), r.GetNamespace(), r.GetName(), err.Error())
+					aggregateErr = append(aggregateErr, err)
+					continue
+				}
+			}
+			if err := kubeClient.Delete(ctx, &r, deleteOpts); err != nil {
+				logger.Failuref("%s/%s/%s deletion failed: %s", r.GetKind(), r.GetNamespace(), r.GetName(), err.Error())
+				aggregateErr = append(aggregateErr, err)
+			} else {
+				logger.Successf("%s/%s/%s deleted %s", r.GetKind(), r.GetNamespace(), r.GetName(), dryRunStr)
+			}
+		}
+	}
+	return errors.Reduce(errors.Flatten(errors.NewAggregate(aggregateErr)))
+}
+
+// SelectedCustomResourceDefinitions removes the CRDs installed by the given components.
+func SelectedCustomResourceDefinitions(ctx context.Context, logger log.Logger, kubeClient client.Client, components []string, dryRun bool) error {
+	var aggregateErr []error
+	opts, dryRunStr := getDeleteOptions(dryRun)
+	crds, err := componentCRDs(ctx, kubeClient, components)
+	if err != nil {
+		return err
+	}
+	for _, r := range crds {
+		if err := kubeClient.Delete(ctx, &r, opts); err != nil {
+			logger.Failuref("CustomResourceDefinition/%s deletion failed: %s", r.Name, err.Error())
+			aggregateErr = append(aggregateErr, err)
+		} else {
+			logger.Successf("CustomResourceDefinition/%s deleted %s", r.Name, dryRunStr)
+		}
+	}
+	return errors.Reduce(errors.Flatten(errors.NewAggregate(aggregateErr)))
+}
+
+func componentCRDs(ctx context.Context, kubeClient client.Client, components []string) ([]apiextensionsv1.CustomResourceDefinition, error) {
+	var crds []apiextensionsv1.CustomResourceDefinition
+	for _, component := range components {
+		var list apiextensionsv1.CustomResourceDefinitionList
+		selector := client.MatchingLabels{
+			manifestgen.PartOfLabelKey:    manifestgen.PartOfLabelValue,
+			manifestgen.ComponentLabelKey: component,
+		}
+		if err := kubeClient.List(ctx, &list, selector); err != nil {
+			return nil, err
+		}
+		crds = append(crds, list.Items...)
+	}
+	return crds, nil
+}
+
+func listCustomResources(ctx context.Context, kubeClient client.Client, crd apiextensionsv1.CustomResourceDefinition) (*unstructured.UnstructuredList, error) {
+	version := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			version = v.Name
+		}
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   crd.Spec.Group,
+		Version: version,
+		Kind:    crd.Spec.Names.ListKind,
+	})
+	if err := kubeClient.List(ctx, list, client.InNamespace("")); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
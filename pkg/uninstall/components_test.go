@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uninstall
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/log"
+	"github.com/fluxcd/flux2/pkg/manifestgen"
+)
+
+func TestSelectedComponents(t *testing.T) {
+	labels := func(component string) map[string]string {
+		return map[string]string{
+			manifestgen.PartOfLabelKey:    manifestgen.PartOfLabelValue,
+			manifestgen.ComponentLabelKey: component,
+		}
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "imagepolicies.image.toolkit.fluxcd.io", Labels: labels("image-reflector-controller")},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "image.toolkit.fluxcd.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "ImagePolicy", ListKind: "ImagePolicyList"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1beta2", Served: true, Storage: true},
+			},
+		},
+	}
+	policy := &imagev1.ImagePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "apps", Finalizers: []string{"finalizers.fluxcd.io"}},
+	}
+	reflector := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "image-reflector-controller", Namespace: "flux-system", Labels: labels("image-reflector-controller")}}
+	source := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system", Labels: labels("source-controller")}}
+	crb := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "crd-controller", Labels: map[string]string{manifestgen.PartOfLabelKey: manifestgen.PartOfLabelValue}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "crd-controller"},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: "source-controller", Namespace: "flux-system"},
+			{Kind: rbacv1.ServiceAccountKind, Name: "image-reflector-controller", Namespace: "flux-system"},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(crd, policy, reflector, source, crb).Build()
+	ctx := context.Background()
+	components := []string{"image-reflector-controller"}
+
+	remaining, err := RemainingCustomResources(ctx, kubeClient, components)
+	if err != nil {
+		t.Fatalf("RemainingCustomResources() error = %v", err)
+	}
+	if want := map[string]int{"ImagePolicy": 1}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("RemainingCustomResources() = %v, want %v", remaining, want)
+	}
+
+	if err := SelectedCustomResources(ctx, log.NopLogger{}, kubeClient, components, false); err != nil {
+		t.Fatalf("SelectedCustomResources() error = %v", err)
+	}
+	if err := SelectedComponents(ctx, log.NopLogger{}, kubeClient, "flux-system", components, false); err != nil {
+		t.Fatalf("SelectedComponents() error = %v", err)
+	}
+	if err := SelectedCustomResourceDefinitions(ctx, log.NopLogger{}, kubeClient, components, false); err != nil {
+		t.Fatalf("SelectedCustomResourceDefinitions() error = %v", err)
+	}
+
+	for _, obj := range []client.Object{policy, reflector, crd} {
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s to be deleted, got %v", obj.GetName(), err)
+		}
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(source), source); err != nil {
+		t.Errorf("expected source-controller to be kept, got %v", err)
+	}
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(crb), crb); err != nil {
+		t.Fatal(err)
+	}
+	if len(crb.Subjects) != 1 || crb.Subjects[0].Name != "source-controller" {
+		t.Errorf("unexpected subjects %v", crb.Subjects)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/ssa"
+)
+
+// Snapshot holds the live state of the objects changed by an upgrade, for
+// rolling them back. The CRDs and namespaces are not part of the snapshot,
+// as the objects of the new CRD versions can't be served by the old ones,
+// but the stored versions of the CRDs are restored.
+type Snapshot struct {
+	// Objects are the live objects in an apply-ready form.
+	Objects []*unstructured.Unstructured
+	// Created are the objects that did not exist before the upgrade.
+	Created []*unstructured.Unstructured
+	// StoredVersions are the stored versions of the CRDs by name, before
+	// they are migrated.
+	StoredVersions map[string][]string
+}
+
+// TakeSnapshot records the live state of the objects about to be applied,
+// and the stored versions of the installed CRDs. It must be taken before
+// the stored versions are migrated.
+func TakeSnapshot(ctx context.Context, kubeClient client.Client, objects []*unstructured.Unstructured,
+	crds []apiextensionsv1.CustomResourceDefinition) (*Snapshot, error) {
+	snapshot := &Snapshot{StoredVersions: make(map[string][]string, len(crds))}
+	for _, crd := range crds {
+		snapshot.StoredVersions[crd.Name] = append([]string{}, crd.Status.StoredVersions...)
+	}
+	for _, obj := range objects {
+		if ssa.IsClusterDefinition(obj) {
+			continue
+		}
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+			if apierrors.IsNotFound(err) {
+				snapshot.Created = append(snapshot.Created, obj.DeepCopy())
+				continue
+			}
+			return nil, fmt.Errorf("unable to read %s: %w", ssa.FmtUnstructured(obj), err)
+		}
+		cleanObject(live)
+		snapshot.Objects = append(snapshot.Objects, live)
+	}
+	return snapshot, nil
+}
+
+// Rollback reapplies the objects of the snapshot, deletes the objects
+// created by the upgrade and restores the stored versions of the CRDs.
+func (s *Snapshot) Rollback(ctx context.Context, kubeClient client.Client) (*ssa.ChangeSet, error) {
+	manager := ssa.NewResourceManager(kubeClient, nil, ssa.Owner{
+		Field: "flux",
+		Group: "fluxcd.io",
+	})
+
+	opts := ssa.DefaultApplyOptions()
+	opts.Force = true
+	changeSet, err := manager.ApplyAll(ctx, s.Objects, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Created) > 0 {
+		deleted, err := manager.DeleteAll(ctx, s.Created, ssa.DefaultDeleteOptions())
+		if err != nil {
+			return nil, err
+		}
+		changeSet.Append(deleted.Entries)
+	}
+	if err := s.restoreStoredVersions(ctx, kubeClient); err != nil {
+		return nil, err
+	}
+	return changeSet, nil
+}
+
+// restoreStoredVersions adds back the stored versions of the snapshot to
+// the CRDs, except those removed from the CRDs by the upgrade, which can't
+// be stored versions anymore.
+func (s *Snapshot) restoreStoredVersions(ctx context.Context, kubeClient client.Client) error {
+	for name, stored := range s.StoredVersions {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := kubeClient.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("unable to read %s: %w", name, err)
+		}
+
+		versions := map[string]bool{}
+		for _, v := range crd.Spec.Versions {
+			versions[v.Name] = true
+		}
+		current := map[string]bool{}
+		for _, v := range crd.Status.StoredVersions {
+			current[v] = true
+		}
+		restored := append([]string{}, crd.Status.StoredVersions...)
+		for _, v := range stored {
+			if versions[v] && !current[v] {
+				restored = append(restored, v)
+			}
+		}
+		if len(restored) == len(crd.Status.StoredVersions) {
+			continue
+		}
+
+		patch := client.MergeFrom(crd.DeepCopy())
+		crd.Status.StoredVersions = restored
+		if err := kubeClient.Status().Patch(ctx, crd, patch); err != nil {
+			return fmt.Errorf("unable to restore the stored versions of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// cleanObject removes the status and the server-side metadata of the
+// object, so that it can be applied.
+func cleanObject(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	annotations := obj.GetAnnotations()
+	delete(annotations, "deployment.kubernetes.io/revision")
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/ssa"
+
+	"github.com/fluxcd/flux2/pkg/log"
+)
+
+// RemovedVersion is an API version served by an installed CRD that is no
+// longer served by the CRD of the target version.
+type RemovedVersion struct {
+	CRD     string
+	Kind    string
+	Version string
+	// Stored is true if objects may still be stored in the version.
+	Stored bool
+}
+
+// CRDs returns the CustomResourceDefinitions in the objects.
+func CRDs(objects []*unstructured.Unstructured) ([]apiextensionsv1.CustomResourceDefinition, error) {
+	var crds []apiextensionsv1.CustomResourceDefinition
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &crd); err != nil {
+			return nil, fmt.Errorf("invalid CustomResourceDefinition %s: %w", obj.GetName(), err)
+		}
+		crds = append(crds, crd)
+	}
+	return crds, nil
+}
+
+// RemovedVersions returns the API versions of the installed CRDs that are
+// not served by the target CRDs.
+func RemovedVersions(installed, target []apiextensionsv1.CustomResourceDefinition) []RemovedVersion {
+	targetServed := map[string]map[string]bool{}
+	for _, crd := range target {
+		targetServed[crd.Name] = servedVersions(crd)
+	}
+
+	var removed []RemovedVersion
+	for _, crd := range installed {
+		served, ok := targetServed[crd.Name]
+		if !ok {
+			continue
+		}
+		stored := map[string]bool{}
+		for _, v := range crd.Status.StoredVersions {
+			stored[v] = true
+		}
+		for _, v := range crd.Spec.Versions {
+			if v.Served && !served[v.Name] {
+				removed = append(removed, RemovedVersion{
+					CRD:     crd.Name,
+					Kind:    crd.Spec.Names.Kind,
+					Version: v.Name,
+					Stored:  stored[v.Name],
+				})
+			}
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].CRD == removed[j].CRD {
+			return removed[i].Version < removed[j].Version
+		}
+		return removed[i].CRD < removed[j].CRD
+	})
+	return removed
+}
+
+// Preflight verifies that the target CRDs can be applied once the objects
+// of the installed CRDs are migrated to their storage version.
+func Preflight(installed, target []apiextensionsv1.CustomResourceDefinition) error {
+	targetVersions := map[string]map[string]bool{}
+	for _, crd := range target {
+		versions := map[string]bool{}
+		for _, v := range crd.Spec.Versions {
+			versions[v.Name] = true
+		}
+		targetVersions[crd.Name] = versions
+	}
+	for _, crd := range installed {
+		versions, ok := targetVersions[crd.Name]
+		if !ok {
+			continue
+		}
+		storage := StorageVersion(crd)
+		if storage != "" && !versions[storage] {
+			return fmt.Errorf("the storage version %s of %s is removed by the target version, upgrade to a version that serves both %s and the new versions first",
+				storage, crd.Name, storage)
+		}
+	}
+	return nil
+}
+
+// StorageVersion returns the version the objects of the CRD are stored in.
+func StorageVersion(crd apiextensionsv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// StaleStoredVersions returns the versions objects of the CRD may be stored
+// in, other than its storage version.
+func StaleStoredVersions(crd apiextensionsv1.CustomResourceDefinition) []string {
+	storage := StorageVersion(crd)
+	var stale []string
+	for _, v := range crd.Status.StoredVersions {
+		if v != storage {
+			stale = append(stale, v)
+		}
+	}
+	return stale
+}
+
+// MigrateStoredVersions rewrites the objects of the CRD so that they are
+// stored in the storage version, then removes the other versions from the
+// CRD status.storedVersions.
+func MigrateStoredVersions(ctx context.Context, logger log.Logger, kubeClient client.Client,
+	crd *apiextensionsv1.CustomResourceDefinition, dryRun bool) error {
+	storage := StorageVersion(*crd)
+	if storage == "" {
+		return fmt.Errorf("%s has no storage version", crd.Name)
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   crd.Spec.Group,
+		Version: storage,
+		Kind:    crd.Spec.Names.ListKind,
+	})
+	if err := kubeClient.List(ctx, list); err != nil {
+		return fmt.Errorf("unable to list %s: %w", crd.Spec.Names.Plural, err)
+	}
+
+	dryRunStr := ""
+	if dryRun {
+		dryRunStr = "(dry run)"
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if !dryRun {
+			// An update without changes makes the API server write the
+			// object in the storage version.
+			err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				err := kubeClient.Update(ctx, obj)
+				if apierrors.IsConflict(err) {
+					if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+						return err
+					}
+				}
+				return err
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("%s migration failed: %w", ssa.FmtUnstructured(obj), err)
+			}
+		}
+	}
+	logger.Successf("%d %s migrated to %s %s", len(list.Items), crd.Spec.Names.Plural, storage, dryRunStr)
+
+	if dryRun {
+		return nil
+	}
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Status.StoredVersions = []string{storage}
+	if err := kubeClient.Status().Patch(ctx, crd, patch); err != nil {
+		return fmt.Errorf("unable to update the stored versions of %s: %w", crd.Name, err)
+	}
+	return nil
+}
+
+func servedVersions(crd apiextensionsv1.CustomResourceDefinition) map[string]bool {
+	served := map[string]bool{}
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			served[v.Name] = true
+		}
+	}
+	return served
+}
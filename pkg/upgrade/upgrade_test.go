@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+
+	"github.com/fluxcd/flux2/internal/utils"
+	"github.com/fluxcd/flux2/pkg/log"
+)
+
+func testCRD(storage string, served map[string]bool, stored ...string) apiextensionsv1.CustomResourceDefinition {
+	crd := apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "kustomizations.kustomize.toolkit.fluxcd.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "kustomize.toolkit.fluxcd.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     "Kustomization",
+				ListKind: "KustomizationList",
+				Plural:   "kustomizations",
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: stored},
+	}
+	for _, v := range []string{"v1beta1", "v1beta2", "v1"} {
+		if s, ok := served[v]; ok {
+			crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+				Name:    v,
+				Served:  s,
+				Storage: v == storage,
+			})
+		}
+	}
+	return crd
+}
+
+func TestRemovedVersions(t *testing.T) {
+	installed := testCRD("v1beta2", map[string]bool{"v1beta1": true, "v1beta2": true}, "v1beta1", "v1beta2")
+	target := testCRD("v1", map[string]bool{"v1beta1": false, "v1beta2": true, "v1": true})
+
+	got := RemovedVersions([]apiextensionsv1.CustomResourceDefinition{installed}, []apiextensionsv1.CustomResourceDefinition{target})
+	want := []RemovedVersion{{
+		CRD:     "kustomizations.kustomize.toolkit.fluxcd.io",
+		Kind:    "Kustomization",
+		Version: "v1beta1",
+		Stored:  true,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemovedVersions() = %+v, want %+v", got, want)
+	}
+
+	if err := Preflight([]apiextensionsv1.CustomResourceDefinition{installed}, []apiextensionsv1.CustomResourceDefinition{target}); err != nil {
+		t.Errorf("Preflight() error = %v", err)
+	}
+	withoutStorage := testCRD("v1", map[string]bool{"v1": true})
+	if err := Preflight([]apiextensionsv1.CustomResourceDefinition{installed}, []apiextensionsv1.CustomResourceDefinition{withoutStorage}); err == nil {
+		t.Errorf("expected Preflight() error for a removed storage version")
+	}
+}
+
+func TestMigrateStoredVersions(t *testing.T) {
+	crd := testCRD("v1beta2", map[string]bool{"v1beta1": true, "v1beta2": true}, "v1beta1", "v1beta2")
+	ks := &kustomizev1.Kustomization{ObjectMeta: metav1.ObjectMeta{Name: "apps", Namespace: "flux-system"}}
+	scheme := utils.NewScheme()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&crd, ks).Build()
+
+	if got := StaleStoredVersions(crd); !reflect.DeepEqual(got, []string{"v1beta1"}) {
+		t.Fatalf("StaleStoredVersions() = %v", got)
+	}
+	if err := MigrateStoredVersions(context.Background(), log.NopLogger{}, kubeClient, &crd, false); err != nil {
+		t.Fatalf("MigrateStoredVersions() error = %v", err)
+	}
+
+	var updated apiextensionsv1.CustomResourceDefinition
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(&crd), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated.Status.StoredVersions, []string{"v1beta2"}) {
+		t.Errorf("stored versions = %v, want [v1beta2]", updated.Status.StoredVersions)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	live := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "source-controller",
+			Namespace:   "flux-system",
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "3"},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(utils.NewScheme()).WithObjects(live).Build()
+
+	toUnstructured := func(obj runtime.Object, apiVersion, kind string) *unstructured.Unstructured {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &unstructured.Unstructured{Object: u}
+		result.SetAPIVersion(apiVersion)
+		result.SetKind(kind)
+		return result
+	}
+	objects := []*unstructured.Unstructured{
+		toUnstructured(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system"}}, "apps/v1", "Deployment"),
+		toUnstructured(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "image-reflector-controller", Namespace: "flux-system"}}, "apps/v1", "Deployment"),
+		toUnstructured(&apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "kustomizations.kustomize.toolkit.fluxcd.io"}},
+			"apiextensions.k8s.io/v1", "CustomResourceDefinition"),
+	}
+
+	snapshot, err := TakeSnapshot(context.Background(), kubeClient, objects, nil)
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if len(snapshot.Objects) != 1 || len(snapshot.Created) != 1 {
+		t.Fatalf("snapshot has %d objects and %d created, want 1 and 1", len(snapshot.Objects), len(snapshot.Created))
+	}
+	obj := snapshot.Objects[0]
+	if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "status"); found {
+		t.Errorf("expected the status to be removed")
+	}
+	if obj.GetResourceVersion() != "" || len(obj.GetAnnotations()) != 0 {
+		t.Errorf("expected the server-side metadata to be removed: %v", obj.Object["metadata"])
+	}
+	if snapshot.Created[0].GetName() != "image-reflector-controller" {
+		t.Errorf("unexpected created object %s", snapshot.Created[0].GetName())
+	}
+}
+
+func TestSnapshot_RollbackStoredVersions(t *testing.T) {
+	crd := testCRD("v1beta2", map[string]bool{"v1beta1": true, "v1beta2": true}, "v1beta1", "v1beta2")
+	scheme := utils.NewScheme()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&crd).Build()
+
+	snapshot, err := TakeSnapshot(context.Background(), kubeClient, nil, []apiextensionsv1.CustomResourceDefinition{crd})
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if err := MigrateStoredVersions(context.Background(), log.NopLogger{}, kubeClient, &crd, false); err != nil {
+		t.Fatalf("MigrateStoredVersions() error = %v", err)
+	}
+	if _, err := snapshot.Rollback(context.Background(), kubeClient); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	var restored apiextensionsv1.CustomResourceDefinition
+	if err := kubeClient.Get(context.Background(), client.ObjectKeyFromObject(&crd), &restored); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1beta2", "v1beta1"}; !reflect.DeepEqual(restored.Status.StoredVersions, want) {
+		t.Errorf("stored versions = %v, want %v", restored.Status.StoredVersions, want)
+	}
+}